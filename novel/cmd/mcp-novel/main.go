@@ -1,9 +1,18 @@
 package main
 
 import (
-    "mcpnovel/internal/mcp"
+    "flag"
+
+    "mcpnovel/mcp"
 )
 
 func main() {
+    transport := flag.String("transport", "stdio", "传输方式：stdio 或 http")
+    addr := flag.String("addr", "127.0.0.1:8765", "http 传输的监听地址")
+    flag.Parse()
+    if *transport == "http" {
+        mcp.RunHTTP(*addr)
+        return
+    }
     mcp.Run()
-}
\ No newline at end of file
+}
@@ -0,0 +1,197 @@
+// Package chrono places events in story order: by story time, otherwise by
+// reading order within their novel. An event without a story time takes
+// that of the nearest event before it in reading order that has one, so
+// that the two orders never disagree about it.
+package chrono
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Point is where an event falls in the story. Reading is its 1-based
+// position in its novel's reading order (0 when it is in no novel), and At
+// its story time, or the start of its time segment when it has none.
+// Place is the story time it is ordered by: At, or when it has none, that
+// of the nearest event before it in reading order that has one (after it,
+// when none before does); nil when its novel has none. A point with At but
+// no Place is placed at At.
+type Point struct {
+	EventID uint
+	NovelID uint
+	Reading int
+	At      *time.Time
+	Place   *time.Time
+}
+
+func (p Point) place() *time.Time {
+	if p.Place != nil {
+		return p.Place
+	}
+	return p.At
+}
+
+// Compare reports whether a comes before (-1), with (0) or after (1) b:
+// by place in story time, then by reading order within a novel. ok is
+// false when they cannot be ordered: they are in different novels and not
+// both placed in story time.
+func Compare(a, b Point) (c int, ok bool) {
+	if a.EventID != 0 && a.EventID == b.EventID {
+		return 0, true
+	}
+	pa, pb := a.place(), b.place()
+	if pa != nil && pb != nil && !pa.Equal(*pb) {
+		return pa.Compare(*pb), true
+	}
+	if a.NovelID != 0 && a.NovelID == b.NovelID {
+		return cmp.Compare(a.Reading, b.Reading), true
+	}
+	return 0, pa != nil && pb != nil
+}
+
+// Cmp orders any two points for sorting. It agrees with Compare wherever
+// that orders them one before the other, and puts the rest in a fixed
+// order so that the result does not depend on the order of the input:
+// points placed in story time first, then the others by novel and reading
+// order, with event IDs breaking ties.
+func Cmp(a, b Point) int {
+	if a.EventID != 0 && a.EventID == b.EventID {
+		return 0
+	}
+	pa, pb := a.place(), b.place()
+	if (pa == nil) != (pb == nil) {
+		if pa != nil {
+			return -1
+		}
+		return 1
+	}
+	if pa != nil {
+		if c := pa.Compare(*pb); c != 0 {
+			return c
+		}
+	}
+	if c := cmp.Compare(a.NovelID, b.NovelID); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Reading, b.Reading); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.EventID, b.EventID)
+}
+
+// Before reports whether a certainly comes before b.
+func Before(a, b Point) bool {
+	c, ok := Compare(a, b)
+	return ok && c < 0
+}
+
+// NotAfter reports whether a certainly comes before or with b.
+func NotAfter(a, b Point) bool {
+	c, ok := Compare(a, b)
+	return ok && c <= 0
+}
+
+// Order holds the point of every event, keyed by event ID.
+type Order map[uint]Point
+
+// Load places every event that is not deleted.
+func Load(db *gorm.DB) (Order, error) {
+	var rows []struct {
+		ID            uint
+		NovelID       uint
+		StoryTime     *time.Time
+		TimeSegmentID uint
+	}
+	err := db.Table("events").
+		Select("events.id, events.story_time, events.time_segment_id, COALESCE(volumes.novel_id, 0) AS novel_id").
+		Joins("LEFT JOIN chapters ON chapters.id = events.chapter_id AND chapters.deleted_at IS NULL").
+		Joins("LEFT JOIN volumes ON volumes.id = chapters.volume_id AND volumes.deleted_at IS NULL").
+		Where("events.deleted_at IS NULL").
+		Order("volumes.novel_id, volumes.`index`, volumes.id, chapters.`index`, chapters.id, events.seq, events.id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var segs []struct {
+		ID    uint
+		Start time.Time
+	}
+	if err := db.Table("time_segments").Select("id, start").Where("deleted_at IS NULL").Scan(&segs).Error; err != nil {
+		return nil, err
+	}
+	starts := map[uint]time.Time{}
+	for _, s := range segs {
+		starts[s.ID] = s.Start
+	}
+	o := Order{}
+	novels := map[uint][]uint{}
+	for _, r := range rows {
+		p := Point{EventID: r.ID, NovelID: r.NovelID, At: r.StoryTime}
+		if p.At == nil {
+			if t, ok := starts[r.TimeSegmentID]; ok {
+				p.At = &t
+			}
+		}
+		p.Place = p.At
+		if r.NovelID != 0 {
+			novels[r.NovelID] = append(novels[r.NovelID], r.ID)
+			p.Reading = len(novels[r.NovelID])
+		}
+		o[r.ID] = p
+	}
+	for _, events := range novels {
+		o.place(events)
+	}
+	return o, nil
+}
+
+// place fills in Place for the events of one novel, given in reading order.
+func (o Order) place(events []uint) {
+	var last *time.Time
+	// Events before the first with a story time take its.
+	for _, e := range events {
+		if last = o[e].Place; last != nil {
+			break
+		}
+	}
+	for _, e := range events {
+		p := o[e]
+		if p.Place == nil {
+			p.Place = last
+			o[e] = p
+		} else {
+			last = p.Place
+		}
+	}
+}
+
+// Of is the point of eventID; an unknown event gets a point that orders
+// only against itself.
+func (o Order) Of(eventID uint) Point {
+	if p, ok := o[eventID]; ok {
+		return p
+	}
+	return Point{EventID: eventID}
+}
+
+// Sort puts events in story order (see Cmp).
+func (o Order) Sort(events []uint) {
+	slices.SortStableFunc(events, func(a, b uint) int {
+		return Cmp(o.Of(a), o.Of(b))
+	})
+}
+
+// Latest is the index of the last of events, which are in story order, at
+// or before p, or -1 when none is.
+func (o Order) Latest(events []uint, p Point) int {
+	at := -1
+	for i, e := range events {
+		if c, ok := Compare(o.Of(e), p); ok && c <= 0 {
+			at = i
+		}
+	}
+	return at
+}
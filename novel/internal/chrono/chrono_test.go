@@ -0,0 +1,149 @@
+package chrono
+
+import (
+	"fmt"
+	"math/rand"
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"slices"
+	"testing"
+	"time"
+)
+
+func at(day int) *time.Time {
+	t := time.Date(2000, 1, day, 0, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		c    int
+		ok   bool
+	}{
+		{"same event", Point{EventID: 1, At: at(2)}, Point{EventID: 1, At: at(1)}, 0, true},
+		{"by time", Point{EventID: 1, NovelID: 1, Reading: 2, At: at(1)}, Point{EventID: 2, NovelID: 1, Reading: 1, At: at(2)}, -1, true},
+		{"by place", Point{EventID: 1, NovelID: 1, Reading: 3, At: at(5), Place: at(5)}, Point{EventID: 2, NovelID: 1, Reading: 2, Place: at(10)}, -1, true},
+		{"same place by reading", Point{EventID: 1, NovelID: 1, Reading: 2, Place: at(10)}, Point{EventID: 2, NovelID: 1, Reading: 1, At: at(10), Place: at(10)}, 1, true},
+		{"untimed novel by reading", Point{EventID: 1, NovelID: 1, Reading: 1}, Point{EventID: 2, NovelID: 1, Reading: 2}, -1, true},
+		{"novels by time", Point{EventID: 1, NovelID: 1, Reading: 9, Place: at(1)}, Point{EventID: 2, NovelID: 2, Reading: 1, Place: at(2)}, -1, true},
+		{"novels at the same time", Point{EventID: 1, NovelID: 1, Place: at(1)}, Point{EventID: 2, NovelID: 2, Place: at(1)}, 0, true},
+		{"novels without time", Point{EventID: 1, NovelID: 1, Reading: 1}, Point{EventID: 2, NovelID: 2, Reading: 2, Place: at(1)}, 0, false},
+		{"time segment end", Point{At: at(3)}, Point{EventID: 2, NovelID: 1, Place: at(2)}, 1, true},
+		{"unknown event", Point{EventID: 7}, Point{EventID: 2, NovelID: 1, Place: at(2)}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, ok := Compare(tt.a, tt.b)
+			if c != tt.c || ok != tt.ok {
+				t.Errorf("Compare = %d, %v; want %d, %v", c, ok, tt.c, tt.ok)
+			}
+			if ok && c != 0 && Cmp(tt.a, tt.b) != c {
+				t.Errorf("Cmp = %d; want %d", Cmp(tt.a, tt.b), c)
+			}
+			if r, rok := Compare(tt.b, tt.a); r != -c || rok != ok {
+				t.Errorf("reversed Compare = %d, %v; want %d, %v", r, rok, -c, ok)
+			}
+		})
+	}
+}
+
+// load stores events, each in reading order within its novel and with an
+// optional story day, and loads their order.
+func load(t *testing.T, events [][3]int) Order {
+	t.Helper()
+	db, err := storage.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Volume{}, &models.Chapter{}, &models.Event{}, &models.TimeSegment{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range events {
+		novel, day := e[1], e[2]
+		ev := &models.Event{ID: uint(e[0]), Seq: e[0]}
+		if novel != 0 {
+			v := &models.Volume{ID: uint(novel), NovelID: uint(novel)}
+			ch := &models.Chapter{ID: uint(novel), VolumeID: uint(novel)}
+			if err := db.FirstOrCreate(v).Error; err != nil {
+				t.Fatal(err)
+			}
+			if err := db.FirstOrCreate(ch).Error; err != nil {
+				t.Fatal(err)
+			}
+			ev.ChapterID = ch.ID
+		}
+		if day != 0 {
+			ev.StoryTime = at(day)
+		}
+		if err := db.Create(ev).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	o, err := Load(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestSort(t *testing.T) {
+	// Each event is {ID, novel, story day or 0}; IDs are reading order.
+	tests := []struct {
+		name   string
+		events [][3]int
+		want   []uint
+	}{
+		{"untimed between flashback", [][3]int{{1, 1, 10}, {2, 1, 0}, {3, 1, 5}}, []uint{3, 1, 2}},
+		{"untimed before the first timed", [][3]int{{1, 1, 0}, {2, 1, 0}, {3, 1, 4}, {4, 1, 2}}, []uint{4, 1, 2, 3}},
+		{"untimed follows its predecessor", [][3]int{{1, 1, 3}, {2, 1, 0}, {3, 1, 3}, {4, 1, 0}}, []uint{1, 2, 3, 4}},
+		{"untimed novel", [][3]int{{1, 1, 0}, {2, 1, 0}, {3, 1, 0}}, []uint{1, 2, 3}},
+		{"two novels", [][3]int{{1, 1, 5}, {2, 1, 0}, {3, 2, 1}, {4, 2, 7}, {5, 2, 0}}, []uint{3, 1, 2, 4, 5}},
+		{"untimed novel after timed", [][3]int{{1, 2, 0}, {2, 1, 3}, {3, 2, 0}, {4, 0, 1}}, []uint{4, 2, 1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := load(t, tt.events)
+			for i := 0; i < 20; i++ {
+				ids := slices.Clone(tt.want)
+				rand.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+				o.Sort(ids)
+				if !slices.Equal(ids, tt.want) {
+					t.Fatalf("Sort = %v; want %v", ids, tt.want)
+				}
+			}
+			// Compare must agree with the sorted order wherever it can
+			// order two events one before the other.
+			for i, a := range tt.want {
+				for _, b := range tt.want[i+1:] {
+					if c, ok := Compare(o.Of(a), o.Of(b)); ok && c > 0 {
+						t.Errorf("Compare(%d, %d) = %d after sorting", a, b, c)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestLatest(t *testing.T) {
+	o := load(t, [][3]int{{1, 1, 10}, {2, 1, 0}, {3, 1, 5}, {4, 1, 0}})
+	ids := []uint{1, 2, 3, 4}
+	o.Sort(ids)
+	tests := []struct {
+		p    Point
+		want int
+	}{
+		{o.Of(3), 0},
+		{o.Of(4), 1},
+		{o.Of(1), 2},
+		{o.Of(2), 3},
+		{Point{At: at(1)}, -1},
+		{Point{At: at(7)}, 1},
+	}
+	for _, tt := range tests {
+		if got := o.Latest(ids, tt.p); got != tt.want {
+			t.Errorf("Latest(%+v) = %d; want %d", tt.p, got, tt.want)
+		}
+	}
+}
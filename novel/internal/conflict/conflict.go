@@ -1,39 +1,56 @@
 package conflict
 
 import (
+    "context"
     "errors"
     "fmt"
+    "slices"
+    "strings"
     "time"
     "gorm.io/gorm"
+    "mcpnovel/internal/chrono"
+    "mcpnovel/internal/custody"
     "mcpnovel/internal/models"
+    "mcpnovel/internal/progress"
+    "mcpnovel/internal/travel"
 )
 
 type Detector struct {
     DB *gorm.DB
 }
 
-func (d *Detector) DetectAll() ([]models.Conflict, error) {
+var detectors = []struct {
+    name string
+    run  func(*Detector) ([]models.Conflict, error)
+}{
+    {"时间冲突", (*Detector).TimeOrderConflicts},
+    {"事件冲突", (*Detector).EventPresenceConflicts},
+    {"人物冲突", (*Detector).CharacterStateConflicts},
+    {"地点冲突", (*Detector).LocationStateConflicts},
+    {"引用完整性", (*Detector).ReferenceIntegrityConflicts},
+    {"关系逻辑", (*Detector).RelationshipLogicConflicts},
+    {"状态一致性", (*Detector).StatusConsistencyConflicts},
+    {"物品能力冲突", (*Detector).ItemAbilityConflicts},
+    {"线索冲突", (*Detector).PlotThreadConflicts},
+    {"人物地点关系冲突", (*Detector).CharacterLocationConflicts},
+    {"场景冲突", (*Detector).SceneConflicts},
+    {"生死冲突", (*Detector).LifecycleConflicts},
+    {"组织冲突", (*Detector).MembershipConflicts},
+    {"行程冲突", (*Detector).TravelConflicts},
+    {"物品归属冲突", (*Detector).CustodyConflicts},
+}
+
+func (d *Detector) DetectAll(ctx context.Context) ([]models.Conflict, error) {
     var out []models.Conflict
-    c1, _ := d.TimeOrderConflicts()
-    out = append(out, c1...)
-    c2, _ := d.EventPresenceConflicts()
-    out = append(out, c2...)
-    c3, _ := d.CharacterStateConflicts()
-    out = append(out, c3...)
-    c4, _ := d.LocationStateConflicts()
-    out = append(out, c4...)
-    c5, _ := d.ReferenceIntegrityConflicts()
-    out = append(out, c5...)
-    c6, _ := d.RelationshipLogicConflicts()
-    out = append(out, c6...)
-    c7, _ := d.StatusConsistencyConflicts()
-    out = append(out, c7...)
-    c8, _ := d.ItemAbilityConflicts()
-    out = append(out, c8...)
-    c9, _ := d.PlotThreadConflicts()
-    out = append(out, c9...)
-    c10, _ := d.CharacterLocationConflicts()
-    out = append(out, c10...)
+    dc := &Detector{DB: d.DB.WithContext(ctx)}
+    for i, det := range detectors {
+        if err := ctx.Err(); err != nil {
+            return nil, err
+        }
+        c, _ := det.run(dc)
+        out = append(out, c...)
+        progress.Report(ctx, float64(i+1), float64(len(detectors)), det.name)
+    }
     return out, nil
 }
 
@@ -60,6 +77,9 @@ func (d *Detector) TimeOrderConflicts() ([]models.Conflict, error) {
             if ts.End.Before(ts.Start) {
                 out = append(out, models.Conflict{Type: "时间冲突", Detail: fmt.Sprintf("时间段无效 %d", ts.ID)})
             }
+            if e.StoryTime != nil && (e.StoryTime.Before(ts.Start) || e.StoryTime.After(ts.End)) {
+                out = append(out, models.Conflict{Type: "时间冲突", Detail: fmt.Sprintf("事件时间超出时间段 %d", e.ID)})
+            }
         }
     }
     return out, nil
@@ -122,6 +142,34 @@ func (d *Detector) ReferenceIntegrityConflicts() ([]models.Conflict, error) {
             out = append(out, models.Conflict{Type: "引用完整性", Detail: fmt.Sprintf("事件章节不存在 %d", e.ID)})
         }
     }
+    var parts []models.EventParticipant
+    if err := d.DB.Find(&parts).Error; err != nil {
+        return nil, err
+    }
+    for _, p := range parts {
+        var e models.Event
+        if err := d.DB.First(&e, p.EventID).Error; err != nil {
+            out = append(out, models.Conflict{Type: "引用完整性", Detail: fmt.Sprintf("参与记录事件不存在 %d", p.ID)})
+        }
+        var c models.Character
+        if err := d.DB.First(&c, p.CharacterID).Error; err != nil {
+            out = append(out, models.Conflict{Type: "引用完整性", Detail: fmt.Sprintf("事件参与人物不存在 %d-%d", p.EventID, p.CharacterID)})
+        }
+    }
+    var links []models.EventItem
+    if err := d.DB.Find(&links).Error; err != nil {
+        return nil, err
+    }
+    for _, l := range links {
+        var e models.Event
+        if err := d.DB.First(&e, l.EventID).Error; err != nil {
+            out = append(out, models.Conflict{Type: "引用完整性", Detail: fmt.Sprintf("物品记录事件不存在 %d", l.ID)})
+        }
+        var it models.Item
+        if err := d.DB.First(&it, l.ItemID).Error; err != nil {
+            out = append(out, models.Conflict{Type: "引用完整性", Detail: fmt.Sprintf("事件涉及物品不存在 %d-%d", l.EventID, l.ItemID)})
+        }
+    }
     return out, nil
 }
 
@@ -146,10 +194,19 @@ func (d *Detector) StatusConsistencyConflicts() ([]models.Conflict, error) {
         return nil, err
     }
     for _, c := range chs {
-        if c.Status != "开始" && c.Status != "进行中" && c.Status != "结束" && c.Status != "草稿" && c.Status != "完成" {
+        if !slices.Contains(models.ChapterStatuses, c.Status) {
             out = append(out, models.Conflict{Type: "状态一致性", Detail: fmt.Sprintf("章节状态非法 %d", c.ID)})
         }
     }
+    var parts []models.EventParticipant
+    if err := d.DB.Find(&parts).Error; err != nil {
+        return nil, err
+    }
+    for _, p := range parts {
+        if !slices.Contains(models.ParticipantRoles, p.Role) {
+            out = append(out, models.Conflict{Type: "状态一致性", Detail: fmt.Sprintf("参与角色非法 %d", p.ID)})
+        }
+    }
     return out, nil
 }
 
@@ -210,6 +267,348 @@ func (d *Detector) CharacterLocationConflicts() ([]models.Conflict, error) {
     return out, nil
 }
 
+// SceneConflicts flags a scene whose POV character is not present (as
+// protagonist or observer) in one of its events, events whose scene is
+// missing or in another chapter, and scene spans that run past the
+// chapter's content or overlap.
+func (d *Detector) SceneConflicts() ([]models.Conflict, error) {
+    var out []models.Conflict
+    var scenes []models.Scene
+    if err := d.DB.Order("chapter_id asc, start_paragraph asc, id asc").Find(&scenes).Error; err != nil {
+        return nil, err
+    }
+    for i, sc := range scenes {
+        if sc.POVCharacterID != 0 {
+            var evs []models.Event
+            if err := d.DB.Where("scene_id = ?", sc.ID).Order("seq asc, id asc").Find(&evs).Error; err != nil {
+                return nil, err
+            }
+            for _, e := range evs {
+                var n int64
+                d.DB.Model(&models.EventParticipant{}).Where("event_id = ? AND character_id = ? AND role IN ?", e.ID, sc.POVCharacterID, []string{"protagonist", "observer"}).Count(&n)
+                if n == 0 {
+                    out = append(out, models.Conflict{Type: "场景冲突", Detail: fmt.Sprintf("视角人物未参与场景事件 %d-%d", sc.ID, e.ID)})
+                }
+            }
+        }
+        if sc.StartParagraph == 0 {
+            continue
+        }
+        var ch models.Chapter
+        if err := d.DB.First(&ch, sc.ChapterID).Error; err == nil && sc.EndParagraph > paragraphCount(ch.Content) {
+            out = append(out, models.Conflict{Type: "场景冲突", Detail: fmt.Sprintf("场景段落超出正文 %d", sc.ID)})
+        }
+        for _, prev := range scenes[:i] {
+            if prev.ChapterID == sc.ChapterID && prev.StartParagraph != 0 && prev.EndParagraph >= sc.StartParagraph {
+                out = append(out, models.Conflict{Type: "场景冲突", Detail: fmt.Sprintf("场景段落重叠 %d-%d", prev.ID, sc.ID)})
+            }
+        }
+    }
+    var evs []models.Event
+    if err := d.DB.Where("scene_id <> 0").Find(&evs).Error; err != nil {
+        return nil, err
+    }
+    for _, e := range evs {
+        var sc models.Scene
+        if err := d.DB.First(&sc, e.SceneID).Error; err != nil {
+            out = append(out, models.Conflict{Type: "场景冲突", Detail: fmt.Sprintf("事件所属场景不存在 %d", e.ID)})
+        } else if sc.ChapterID != e.ChapterID {
+            out = append(out, models.Conflict{Type: "场景冲突", Detail: fmt.Sprintf("事件与所属场景不在同一章节 %d", e.ID)})
+        }
+    }
+    return out, nil
+}
+
+// LifecycleConflicts flags characters who act in an event while dead as of
+// it: taking part other than by mention, narrating its scene, using an
+// ability or forming a memory in it. The event of the death itself and
+// events that cannot be placed against it in story order are not flagged.
+func (d *Detector) LifecycleConflicts() ([]models.Conflict, error) {
+    var sts []models.CharacterStatus
+    if err := d.DB.Order("id asc").Find(&sts).Error; err != nil || len(sts) == 0 {
+        return nil, err
+    }
+    o, err := chrono.Load(d.DB)
+    if err != nil {
+        return nil, err
+    }
+    byChar := map[uint]map[uint]models.CharacterStatus{}
+    for _, st := range sts {
+        if byChar[st.CharacterID] == nil {
+            byChar[st.CharacterID] = map[uint]models.CharacterStatus{}
+        }
+        byChar[st.CharacterID][st.EventID] = st
+    }
+    order := map[uint][]uint{}
+    for c, m := range byChar {
+        var ids []uint
+        for e := range m {
+            ids = append(ids, e)
+        }
+        slices.Sort(ids)
+        o.Sort(ids)
+        order[c] = ids
+    }
+    var acts []struct {
+        CharacterID uint
+        EventID     uint
+        Kind        string
+    }
+    q := `SELECT character_id, event_id, '参与事件' AS kind FROM event_participants WHERE deleted_at IS NULL AND role <> 'mentioned'
+        UNION ALL SELECT scenes.pov_character_id, events.id, '作为场景视角' FROM events JOIN scenes ON scenes.id = events.scene_id AND scenes.deleted_at IS NULL
+            WHERE events.deleted_at IS NULL AND scenes.pov_character_id <> 0
+        UNION ALL SELECT abilities.character_id, ability_usages.event_id, '使用能力' FROM ability_usages JOIN abilities ON abilities.id = ability_usages.ability_id AND abilities.deleted_at IS NULL
+            WHERE ability_usages.deleted_at IS NULL AND ability_usages.event_id <> 0
+        UNION ALL SELECT character_id, event_id, '形成记忆' FROM memories WHERE deleted_at IS NULL AND event_id <> 0
+        ORDER BY 1, 2`
+    if err := d.DB.Raw(q).Scan(&acts).Error; err != nil {
+        return nil, err
+    }
+    var out []models.Conflict
+    for _, a := range acts {
+        ids, ok := order[a.CharacterID]
+        if !ok {
+            continue
+        }
+        if _, ok := o[a.EventID]; !ok {
+            continue
+        }
+        i := o.Latest(ids, o.Of(a.EventID))
+        if i < 0 || ids[i] == a.EventID {
+            continue
+        }
+        if st := byChar[a.CharacterID][ids[i]]; st.Status == "dead" {
+            out = append(out, models.Conflict{Type: "生死冲突", Detail: fmt.Sprintf("死亡人物%s %d-%d（死于事件 %d）", a.Kind, a.CharacterID, a.EventID, st.EventID)})
+        }
+    }
+    return out, nil
+}
+
+// MembershipConflicts flags memberships left before they are joined, and
+// characters who belong at the same time to two organizations in an
+// exclusive relationship, or to organizations under them. Memberships that
+// cannot be placed against each other in story order are not flagged.
+func (d *Detector) MembershipConflicts() ([]models.Conflict, error) {
+    var ms []models.OrganizationMembership
+    if err := d.DB.Order("character_id asc, id asc").Find(&ms).Error; err != nil || len(ms) == 0 {
+        return nil, err
+    }
+    o, err := chrono.Load(d.DB)
+    if err != nil {
+        return nil, err
+    }
+    var out []models.Conflict
+    for _, m := range ms {
+        if m.JoinEventID != 0 && m.LeaveEventID != 0 && chrono.Before(o.Of(m.LeaveEventID), o.Of(m.JoinEventID)) {
+            out = append(out, models.Conflict{Type: "组织冲突", Detail: fmt.Sprintf("离开早于加入 %d", m.ID)})
+        }
+    }
+    var rels []models.OrganizationRelationship
+    if err := d.DB.Where("exclusive = ?", true).Find(&rels).Error; err != nil || len(rels) == 0 {
+        return out, err
+    }
+    exclusive := map[[2]uint]uint{}
+    for _, r := range rels {
+        exclusive[[2]uint{r.AID, r.BID}] = r.ID
+        exclusive[[2]uint{r.BID, r.AID}] = r.ID
+    }
+    var orgs []models.Organization
+    if err := d.DB.Find(&orgs).Error; err != nil {
+        return nil, err
+    }
+    parent := map[uint]uint{}
+    for _, org := range orgs {
+        parent[org.ID] = org.ParentID
+    }
+    // The organization and those above it, guarding against a cycle.
+    lineage := func(id uint) []uint {
+        var out []uint
+        for ; id != 0 && !slices.Contains(out, id); id = parent[id] {
+            out = append(out, id)
+        }
+        return out
+    }
+    // Whether a's stretch certainly starts before b's ends.
+    startsBefore := func(a, b models.OrganizationMembership) bool {
+        return a.JoinEventID == 0 || b.LeaveEventID == 0 || chrono.Before(o.Of(a.JoinEventID), o.Of(b.LeaveEventID))
+    }
+    for i, a := range ms {
+        for _, b := range ms[i+1:] {
+            if b.CharacterID != a.CharacterID {
+                break
+            }
+            if !startsBefore(a, b) || !startsBefore(b, a) {
+                continue
+            }
+        pairs:
+            for _, x := range lineage(a.OrganizationID) {
+                for _, y := range lineage(b.OrganizationID) {
+                    if rel, ok := exclusive[[2]uint{x, y}]; ok {
+                        out = append(out, models.Conflict{Type: "组织冲突", Detail: fmt.Sprintf("人物同时属于互斥组织 %d：%d-%d（关系 %d）", a.CharacterID, a.OrganizationID, b.OrganizationID, rel)})
+                        break pairs
+                    }
+                }
+            }
+        }
+    }
+    return out, nil
+}
+
+// TravelConflicts follows each character through the events they are
+// present at (as protagonist or observer) that have both a location and a
+// story time or time segment, in story order. Any two such events in
+// different places, neither within the other, are flagged when their times
+// overlap; two consecutive ones that do not overlap are flagged when even
+// the widest gap their times allow, either way round, is shorter than the
+// quickest known route between the places (or the places they lie within).
+func (d *Detector) TravelConflicts() ([]models.Conflict, error) {
+    var rows []struct {
+        CharacterID uint
+        EventID     uint
+        LocationID  uint
+        StoryTime   *time.Time
+        Start       *time.Time
+        End         *time.Time
+    }
+    q := `SELECT event_participants.character_id, events.id AS event_id, events.location_id, events.story_time,
+            time_segments.start, time_segments."end"
+        FROM event_participants
+        JOIN events ON events.id = event_participants.event_id AND events.deleted_at IS NULL
+        JOIN locations ON locations.id = events.location_id AND locations.deleted_at IS NULL
+        LEFT JOIN time_segments ON time_segments.id = events.time_segment_id AND time_segments.deleted_at IS NULL
+        WHERE event_participants.deleted_at IS NULL AND event_participants.role IN ('protagonist', 'observer')
+            AND (events.story_time IS NOT NULL OR time_segments.id IS NOT NULL)
+        ORDER BY 1, 2`
+    if err := d.DB.Raw(q).Scan(&rows).Error; err != nil || len(rows) == 0 {
+        return nil, err
+    }
+    o, err := chrono.Load(d.DB)
+    if err != nil {
+        return nil, err
+    }
+    g, err := travel.Load(d.DB)
+    if err != nil {
+        return nil, err
+    }
+    type stop struct {
+        event, location uint
+        from, to        time.Time
+    }
+    byChar := map[uint][]stop{}
+    var chars []uint
+    for _, r := range rows {
+        st := stop{event: r.EventID, location: r.LocationID}
+        if r.StoryTime != nil {
+            st.from, st.to = *r.StoryTime, *r.StoryTime
+        } else {
+            st.from, st.to = *r.Start, *r.End
+        }
+        if byChar[r.CharacterID] == nil {
+            chars = append(chars, r.CharacterID)
+        }
+        byChar[r.CharacterID] = append(byChar[r.CharacterID], st)
+    }
+    apart := func(a, b stop) bool {
+        return !g.Within(a.location, b.location) && !g.Within(b.location, a.location)
+    }
+    overlap := func(a, b stop) bool {
+        return a.from.Before(b.to) && b.from.Before(a.to) || a.from.Equal(b.from) && a.to.Equal(b.to)
+    }
+    var out []models.Conflict
+    for _, c := range chars {
+        stops := byChar[c]
+        slices.SortStableFunc(stops, func(a, b stop) int {
+            return chrono.Cmp(o.Of(a.event), o.Of(b.event))
+        })
+        // No route makes being in two places at once possible.
+        for i, a := range stops {
+            for _, b := range stops[i+1:] {
+                if apart(a, b) && overlap(a, b) {
+                    out = append(out, models.Conflict{Type: "行程冲突", Detail: fmt.Sprintf("人物 %d 同时身处两地：事件 %d（地点 %d）与事件 %d（地点 %d）时间重叠", c, a.event, a.location, b.event, b.location)})
+                }
+            }
+        }
+        for i := 1; i < len(stops); i++ {
+            a, b := stops[i-1], stops[i]
+            if !apart(a, b) || overlap(a, b) {
+                continue
+            }
+            there, okThere := g.Hours(a.location, b.location)
+            back, okBack := g.Hours(b.location, a.location)
+            if !okThere && !okBack {
+                continue
+            }
+            // A way without a known route only needs some time.
+            fits := func(gap time.Duration, hours float64, ok bool) bool {
+                return gap > 0 && (!ok || gap.Hours() >= hours)
+            }
+            if !fits(b.to.Sub(a.from), there, okThere) && !fits(a.to.Sub(b.from), back, okBack) {
+                hours := there
+                if !okThere || okBack && back < there {
+                    hours = back
+                }
+                out = append(out, models.Conflict{Type: "行程冲突", Detail: fmt.Sprintf("人物 %d 行程时间不足：事件 %d（地点 %d）与事件 %d（地点 %d）的时间相隔不足路程所需的 %g 小时", c, a.event, a.location, b.event, b.location, hours)})
+            }
+        }
+    }
+    return out, nil
+}
+
+// CustodyConflicts replays each item's transfers in story order and flags
+// those whose source held less than it gave at that point, and items that
+// end up inside themselves through their containers.
+func (d *Detector) CustodyConflicts() ([]models.Conflict, error) {
+    var items []models.Item
+    if err := d.DB.Order("id asc").Find(&items).Error; err != nil || len(items) == 0 {
+        return nil, err
+    }
+    var ts []models.ItemTransfer
+    if err := d.DB.Order("id asc").Find(&ts).Error; err != nil {
+        return nil, err
+    }
+    o, err := chrono.Load(d.DB)
+    if err != nil {
+        return nil, err
+    }
+    byItem := map[uint][]models.ItemTransfer{}
+    for _, t := range ts {
+        byItem[t.ItemID] = append(byItem[t.ItemID], t)
+    }
+    var out []models.Conflict
+    container := map[uint]uint{}
+    for _, it := range items {
+        container[it.ID] = it.ContainerItemID
+        its := byItem[it.ID]
+        custody.Sort(o, its)
+        _, short := custody.Replay(it, its)
+        for _, sf := range short {
+            out = append(out, models.Conflict{Type: "物品归属冲突", Detail: fmt.Sprintf("物品转出方持有不足 %d：流转 %d（事件 %d）%s 持有 %d，转出 %d", it.ID, sf.Transfer.ID, sf.Transfer.EventID, custody.From(sf.Transfer), sf.Held, sf.Moved)})
+        }
+    }
+    for _, it := range items {
+        seen := map[uint]bool{}
+        for id := it.ContainerItemID; id != 0 && !seen[id]; id = container[id] {
+            if id == it.ID {
+                out = append(out, models.Conflict{Type: "物品归属冲突", Detail: fmt.Sprintf("物品装在自身之中 %d", it.ID)})
+                break
+            }
+            seen[id] = true
+        }
+    }
+    return out, nil
+}
+
+// paragraphCount counts the lines of content that have text.
+func paragraphCount(content string) int {
+    n := 0
+    for _, line := range strings.Split(content, "\n") {
+        if strings.TrimSpace(line) != "" {
+            n++
+        }
+    }
+    return n
+}
+
 func ValidTimeRange(start time.Time, end time.Time) bool {
     return !end.Before(start)
 }
\ No newline at end of file
@@ -0,0 +1,241 @@
+package conflict
+
+import (
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T, rows ...any) *gorm.DB {
+	t.Helper()
+	db, err := storage.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Volume{}, &models.Chapter{}, &models.TimeSegment{}, &models.Location{}, &models.LocationRelationship{},
+		&models.Event{}, &models.EventParticipant{}, &models.Item{}, &models.ItemTransfer{},
+		&models.Organization{}, &models.OrganizationMembership{}, &models.OrganizationRelationship{}, &models.Scene{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func hour(h int) *time.Time {
+	t := time.Date(2000, 1, 1, h, 0, 0, 0, time.UTC)
+	return &t
+}
+
+// details is the details of conflicts, for comparing in tests.
+func details(cs []models.Conflict) string {
+	var out []string
+	for _, c := range cs {
+		out = append(out, c.Detail)
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestTravelConflicts(t *testing.T) {
+	hours := func(h float64) *float64 { return &h }
+	// Locations 1 and 2 are 3 hours apart; 3 lies within 1; 4 has no route.
+	// Time segment 1 is hours 0-24 and 2 is hours 6-30.
+	base := []any{
+		&models.Volume{ID: 1, NovelID: 1}, &models.Chapter{ID: 1, VolumeID: 1},
+		&models.Location{ID: 1}, &models.Location{ID: 2}, &models.Location{ID: 3, ParentID: 1}, &models.Location{ID: 4},
+		&models.LocationRelationship{AID: 1, BID: 2, TravelHours: hours(3)},
+		&models.TimeSegment{ID: 1, Start: *hour(0), End: *hour(24)},
+		&models.TimeSegment{ID: 2, Start: *hour(6), End: *hour(30)},
+	}
+	event := func(id, location uint, at *time.Time, segment uint) []any {
+		return []any{
+			&models.Event{ID: id, ChapterID: 1, Seq: int(id), LocationID: location, StoryTime: at, TimeSegmentID: segment},
+			&models.EventParticipant{EventID: id, CharacterID: 1, Role: "protagonist"},
+		}
+	}
+	tests := []struct {
+		name   string
+		events [][]any
+		want   []string
+	}{
+		{"enough time", [][]any{event(1, 1, hour(1), 0), event(2, 2, hour(4), 0)}, nil},
+		{"too little time", [][]any{event(1, 1, hour(1), 0), event(2, 2, hour(3), 0)}, []string{"人物 1 行程时间不足"}},
+		{"within", [][]any{event(1, 1, hour(1), 0), event(2, 3, hour(1), 0)}, nil},
+		{"same time without route", [][]any{event(1, 1, hour(1), 0), event(2, 4, hour(1), 0)}, []string{"人物 1 同时身处两地"}},
+		{"later without route", [][]any{event(1, 1, hour(1), 0), event(2, 4, hour(2), 0)}, nil},
+		{"overlapping segments with route", [][]any{event(1, 1, nil, 1), event(2, 2, nil, 2)}, []string{"人物 1 同时身处两地"}},
+		{"not adjacent", [][]any{event(1, 1, nil, 1), event(2, 1, hour(2), 0), event(3, 2, hour(20), 0)}, []string{"人物 1 同时身处两地：事件 1（地点 1）与事件 3"}},
+		{"mention only", [][]any{event(1, 1, hour(1), 0), {&models.Event{ID: 2, ChapterID: 1, Seq: 2, LocationID: 2, StoryTime: hour(1)}, &models.EventParticipant{EventID: 2, CharacterID: 1, Role: "mentioned"}}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := append([]any{}, base...)
+			for _, e := range tt.events {
+				rows = append(rows, e...)
+			}
+			got, err := (&Detector{DB: testDB(t, rows...)}).TravelConflicts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d conflicts, want %d:\n%s", len(got), len(tt.want), details(got))
+			}
+			for i, w := range tt.want {
+				if !strings.HasPrefix(got[i].Detail, w) {
+					t.Errorf("conflict %d = %q; want it to start with %q", i, got[i].Detail, w)
+				}
+			}
+		})
+	}
+}
+
+func TestCustodyConflicts(t *testing.T) {
+	base := []any{
+		&models.Volume{ID: 1, NovelID: 1}, &models.Chapter{ID: 1, VolumeID: 1},
+		&models.Event{ID: 1, ChapterID: 1, Seq: 1}, &models.Event{ID: 2, ChapterID: 1, Seq: 2},
+	}
+	tests := []struct {
+		name string
+		rows []any
+		want []string
+	}{
+		{"handed on", []any{
+			&models.Item{ID: 1, OwnerCharacterID: 2, Quantity: 1},
+			&models.ItemTransfer{ItemID: 1, Kind: "create", ToCharacterID: 1, Quantity: 1},
+			&models.ItemTransfer{ItemID: 1, Kind: "transfer", FromCharacterID: 1, ToCharacterID: 2, Quantity: 1, EventID: 1},
+		}, nil},
+		{"given before it was held", []any{
+			&models.Item{ID: 1, Quantity: 1},
+			&models.ItemTransfer{ItemID: 1, Kind: "create", ToCharacterID: 1, Quantity: 1},
+			&models.ItemTransfer{ItemID: 1, Kind: "transfer", FromCharacterID: 2, ToCharacterID: 3, Quantity: 1, EventID: 1},
+			&models.ItemTransfer{ItemID: 1, Kind: "transfer", FromCharacterID: 1, ToCharacterID: 2, Quantity: 1, EventID: 2},
+		}, []string{"物品转出方持有不足 1：流转 2（事件 1）人物 2 持有 0，转出 1"}},
+		{"in itself", []any{
+			&models.Item{ID: 1, ContainerItemID: 2, Quantity: 1},
+			&models.Item{ID: 2, ContainerItemID: 1, Quantity: 1},
+		}, []string{"物品装在自身之中 1", "物品装在自身之中 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Detector{DB: testDB(t, append(append([]any{}, base...), tt.rows...)...)}).CustodyConflicts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, want := details(got), strings.Join(tt.want, "\n"); d != want {
+				t.Errorf("got\n%s\nwant\n%s", d, want)
+			}
+		})
+	}
+}
+
+func TestMembershipConflicts(t *testing.T) {
+	// Organizations 1 and 2 are exclusive; 3 is under 2; 1 and 4 are allies.
+	base := []any{
+		&models.Volume{ID: 1, NovelID: 1}, &models.Chapter{ID: 1, VolumeID: 1},
+		&models.Event{ID: 1, ChapterID: 1, Seq: 1}, &models.Event{ID: 2, ChapterID: 1, Seq: 2}, &models.Event{ID: 3, ChapterID: 1, Seq: 3},
+		&models.Organization{ID: 1}, &models.Organization{ID: 2}, &models.Organization{ID: 3, ParentID: 2}, &models.Organization{ID: 4},
+		&models.OrganizationRelationship{ID: 1, AID: 1, BID: 2, Type: "敌对", Exclusive: true},
+		&models.OrganizationRelationship{ID: 2, AID: 1, BID: 4, Type: "同盟"},
+	}
+	tests := []struct {
+		name string
+		rows []any
+		want []string
+	}{
+		{"both at once", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 2, CharacterID: 1, JoinEventID: 2},
+		}, []string{"人物同时属于互斥组织 1：1-2（关系 1）"}},
+		{"reverse direction", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 2, CharacterID: 1},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 1, CharacterID: 1},
+		}, []string{"人物同时属于互斥组织 1：2-1（关系 1）"}},
+		{"under an exclusive organization", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 3, CharacterID: 1, JoinEventID: 1, LeaveEventID: 3},
+		}, []string{"人物同时属于互斥组织 1：1-3（关系 1）"}},
+		{"one after the other", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1, LeaveEventID: 2},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 2, CharacterID: 1, JoinEventID: 2},
+		}, nil},
+		{"different characters", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 2, CharacterID: 2},
+		}, nil},
+		{"not exclusive", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1},
+			&models.OrganizationMembership{ID: 2, OrganizationID: 4, CharacterID: 1},
+		}, nil},
+		{"left before joined", []any{
+			&models.OrganizationMembership{ID: 1, OrganizationID: 1, CharacterID: 1, JoinEventID: 3, LeaveEventID: 1},
+		}, []string{"离开早于加入 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Detector{DB: testDB(t, append(append([]any{}, base...), tt.rows...)...)}).MembershipConflicts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, want := details(got), strings.Join(tt.want, "\n"); d != want {
+				t.Errorf("got\n%s\nwant\n%s", d, want)
+			}
+		})
+	}
+}
+
+func TestSceneConflicts(t *testing.T) {
+	base := []any{
+		&models.Volume{ID: 1, NovelID: 1}, &models.Chapter{ID: 1, VolumeID: 1, Content: "一\n\n二\n\n三"}, &models.Chapter{ID: 2, VolumeID: 1},
+	}
+	tests := []struct {
+		name string
+		rows []any
+		want []string
+	}{
+		{"POV present", []any{
+			&models.Scene{ID: 1, ChapterID: 1, POVCharacterID: 1},
+			&models.Event{ID: 1, ChapterID: 1, Seq: 1, SceneID: 1},
+			&models.EventParticipant{EventID: 1, CharacterID: 1, Role: "observer"},
+		}, nil},
+		{"POV only mentioned", []any{
+			&models.Scene{ID: 1, ChapterID: 1, POVCharacterID: 1},
+			&models.Event{ID: 1, ChapterID: 1, Seq: 1, SceneID: 1},
+			&models.Event{ID: 2, ChapterID: 1, Seq: 2, SceneID: 1},
+			&models.EventParticipant{EventID: 1, CharacterID: 1, Role: "protagonist"},
+			&models.EventParticipant{EventID: 2, CharacterID: 1, Role: "mentioned"},
+		}, []string{"视角人物未参与场景事件 1-2"}},
+		{"POV absent", []any{
+			&models.Scene{ID: 1, ChapterID: 1, POVCharacterID: 1},
+			&models.Event{ID: 1, ChapterID: 1, Seq: 1, SceneID: 1},
+			&models.EventParticipant{EventID: 1, CharacterID: 2, Role: "protagonist"},
+		}, []string{"视角人物未参与场景事件 1-1"}},
+		{"spans", []any{
+			&models.Scene{ID: 1, ChapterID: 1, StartParagraph: 1, EndParagraph: 2},
+			&models.Scene{ID: 2, ChapterID: 1, StartParagraph: 2, EndParagraph: 4},
+		}, []string{"场景段落超出正文 2", "场景段落重叠 1-2"}},
+		{"event scenes", []any{
+			&models.Scene{ID: 1, ChapterID: 2},
+			&models.Event{ID: 1, ChapterID: 1, Seq: 1, SceneID: 1},
+			&models.Event{ID: 2, ChapterID: 1, Seq: 2, SceneID: 9},
+		}, []string{"事件与所属场景不在同一章节 1", "事件所属场景不存在 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&Detector{DB: testDB(t, append(append([]any{}, base...), tt.rows...)...)}).SceneConflicts()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, want := details(got), strings.Join(tt.want, "\n"); d != want {
+				t.Errorf("got\n%s\nwant\n%s", d, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package conflict
+
+import (
+	"context"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+)
+
+type noArgs struct{}
+
+// Tools returns conflictDetectionHelper backed by d.
+func Tools(d *Detector) []tool.Tool {
+	return []tool.Tool{
+		tool.NewActions("conflictDetectionHelper", "冲突检测",
+			tool.Handle("run", "运行全部冲突检测", func(ctx context.Context, _ noArgs) (any, error) {
+				cs, err := d.DetectAll(ctx)
+				if err != nil {
+					return nil, err
+				}
+				if cs == nil {
+					cs = []models.Conflict{}
+				}
+				return map[string]any{"conflicts": cs}, nil
+			}).ReadOnly(),
+		),
+	}
+}
@@ -0,0 +1,157 @@
+// Package custody replays the transfers of an item in story order to tell
+// who or what holds how much of it at a point in the story.
+package custody
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"slices"
+)
+
+// Holder is a character, a location or a container item; the zero Holder
+// stands for nobody, or nobody known.
+type Holder struct {
+	CharacterID     uint
+	LocationID      uint
+	ContainerItemID uint
+}
+
+func (h Holder) String() string {
+	switch {
+	case h.CharacterID != 0:
+		return fmt.Sprintf("人物 %d", h.CharacterID)
+	case h.LocationID != 0:
+		return fmt.Sprintf("地点 %d", h.LocationID)
+	case h.ContainerItemID != 0:
+		return fmt.Sprintf("容器物品 %d", h.ContainerItemID)
+	}
+	return "无人"
+}
+
+// From is the source of a transfer.
+func From(t models.ItemTransfer) Holder {
+	return Holder{CharacterID: t.FromCharacterID, LocationID: t.FromLocationID, ContainerItemID: t.FromContainerItemID}
+}
+
+// To is the destination of a transfer.
+func To(t models.ItemTransfer) Holder {
+	return Holder{CharacterID: t.ToCharacterID, LocationID: t.ToLocationID, ContainerItemID: t.ToContainerItemID}
+}
+
+// Sort puts an item's transfers in the order they are replayed: creations
+// without an event first, then those with an event in story order, then
+// the rest; ties keep the order they were recorded in.
+func Sort(o chrono.Order, ts []models.ItemTransfer) {
+	rank := func(t models.ItemTransfer) int {
+		switch {
+		case t.EventID != 0:
+			return 1
+		case t.Kind == "create":
+			return 0
+		}
+		return 2
+	}
+	slices.SortStableFunc(ts, func(a, b models.ItemTransfer) int {
+		if c := cmp.Compare(rank(a), rank(b)); c != 0 {
+			return c
+		}
+		if rank(a) == 1 {
+			if c := chrono.Cmp(o.Of(a.EventID), o.Of(b.EventID)); c != 0 {
+				return c
+			}
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+}
+
+// AsOf is the transfers of ts, which Sort has put in order, that have
+// happened as of p: creations without an event and those at events at or
+// before it.
+func AsOf(o chrono.Order, ts []models.ItemTransfer, p chrono.Point) []models.ItemTransfer {
+	var out []models.ItemTransfer
+	for _, t := range ts {
+		if t.EventID == 0 && t.Kind == "create" || t.EventID != 0 && chrono.NotAfter(o.Of(t.EventID), p) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Shortfall is a transfer whose source held less of the item than it gave.
+type Shortfall struct {
+	Transfer models.ItemTransfer
+	Held     int
+	Moved    int
+}
+
+// Ledger is how much of an item each holder has.
+type Ledger map[Holder]int
+
+// Replay applies an item's transfers, in the order Sort puts them, to what
+// there was before the first. An item without a creation among them is
+// taken to have been held by nobody known from the start, in its full
+// quantity. A transfer out of a source that holds too little takes the
+// rest from nobody known while it has some, and is a shortfall otherwise.
+func Replay(it models.Item, ts []models.ItemTransfer) (Ledger, []Shortfall) {
+	l := Ledger{}
+	if !slices.ContainsFunc(ts, func(t models.ItemTransfer) bool { return t.Kind == "create" }) {
+		l[Holder{}] = it.Quantity
+	}
+	var short []Shortfall
+	for _, t := range ts {
+		if t.Kind == "create" {
+			l.add(To(t), t.Quantity)
+			continue
+		}
+		from := From(t)
+		held := l[from]
+		n := t.Quantity
+		if n == 0 {
+			n = held
+		}
+		switch {
+		case n > 0 && held >= n:
+			l.add(from, -n)
+		case n > 0 && from != (Holder{}) && held+l[Holder{}] >= n:
+			l.add(from, -held)
+			l.add(Holder{}, held-n)
+		default:
+			// Only what the source held moves on.
+			short = append(short, Shortfall{Transfer: t, Held: held, Moved: n})
+			l.add(from, -held)
+			n = held
+		}
+		if t.Kind != "destroy" {
+			l.add(To(t), n)
+		}
+	}
+	return l, short
+}
+
+func (l Ledger) add(h Holder, n int) {
+	if l[h] += n; l[h] == 0 {
+		delete(l, h)
+	}
+}
+
+// Sole is the one known holder of all there is of the item, if any.
+func (l Ledger) Sole() (Holder, bool) {
+	if len(l) != 1 {
+		return Holder{}, false
+	}
+	for h := range l {
+		return h, h != (Holder{})
+	}
+	return Holder{}, false
+}
+
+// Total is how much of the item there is.
+func (l Ledger) Total() int {
+	n := 0
+	for _, q := range l {
+		n += q
+	}
+	return n
+}
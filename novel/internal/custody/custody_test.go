@@ -0,0 +1,119 @@
+package custody
+
+import (
+	"maps"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"slices"
+	"testing"
+)
+
+var (
+	alice = Holder{CharacterID: 1}
+	bob   = Holder{CharacterID: 2}
+	town  = Holder{LocationID: 1}
+	chest = Holder{ContainerItemID: 9}
+)
+
+func create(to Holder, n int) models.ItemTransfer {
+	return models.ItemTransfer{Kind: "create", ToCharacterID: to.CharacterID, ToLocationID: to.LocationID, ToContainerItemID: to.ContainerItemID, Quantity: n}
+}
+
+func move(kind string, from, to Holder, n int) models.ItemTransfer {
+	return models.ItemTransfer{
+		Kind: kind, Quantity: n,
+		FromCharacterID: from.CharacterID, FromLocationID: from.LocationID, FromContainerItemID: from.ContainerItemID,
+		ToCharacterID: to.CharacterID, ToLocationID: to.LocationID, ToContainerItemID: to.ContainerItemID,
+	}
+}
+
+func TestReplay(t *testing.T) {
+	tests := []struct {
+		name     string
+		quantity int
+		ts       []models.ItemTransfer
+		want     Ledger
+		short    int
+	}{
+		{"created", 10, []models.ItemTransfer{create(alice, 10)}, Ledger{alice: 10}, 0},
+		{"split", 10, []models.ItemTransfer{create(alice, 10), move("transfer", alice, bob, 3)}, Ledger{alice: 7, bob: 3}, 0},
+		{"all of it", 10, []models.ItemTransfer{create(alice, 10), move("transfer", alice, chest, 0)}, Ledger{chest: 10}, 0},
+		{"destroyed", 10, []models.ItemTransfer{create(alice, 10), move("destroy", alice, Holder{}, 4)}, Ledger{alice: 6}, 0},
+		{"shortfall moves what was held", 10, []models.ItemTransfer{create(alice, 2), move("transfer", alice, bob, 5)}, Ledger{bob: 2}, 1},
+		{"from nobody", 1, []models.ItemTransfer{move("transfer", alice, bob, 1)}, Ledger{bob: 1}, 0},
+		{"unknown holder tops up", 5, []models.ItemTransfer{move("transfer", Holder{}, alice, 2), move("transfer", alice, town, 4)}, Ledger{town: 4, Holder{}: 1}, 0},
+		{"nothing held", 1, []models.ItemTransfer{create(alice, 1), move("transfer", bob, town, 0)}, Ledger{alice: 1}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, short := Replay(models.Item{Quantity: tt.quantity}, tt.ts)
+			if !maps.Equal(l, tt.want) {
+				t.Errorf("Replay = %v; want %v", l, tt.want)
+			}
+			if len(short) != tt.short {
+				t.Errorf("got %d shortfalls, want %d", len(short), tt.short)
+			}
+		})
+	}
+}
+
+func TestSole(t *testing.T) {
+	tests := []struct {
+		l    Ledger
+		want Holder
+		ok   bool
+	}{
+		{Ledger{alice: 3}, alice, true},
+		{Ledger{alice: 3, bob: 1}, Holder{}, false},
+		{Ledger{Holder{}: 3}, Holder{}, false},
+		{Ledger{}, Holder{}, false},
+	}
+	for _, tt := range tests {
+		if h, ok := tt.l.Sole(); h != tt.want || ok != tt.ok {
+			t.Errorf("%v.Sole() = %v, %v; want %v, %v", tt.l, h, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSortAsOf(t *testing.T) {
+	day := func(d int) chrono.Point {
+		return chrono.Point{EventID: uint(d), NovelID: 1, Reading: d}
+	}
+	o := chrono.Order{1: day(1), 2: day(2), 3: day(3)}
+	with := func(id, event uint, tr models.ItemTransfer) models.ItemTransfer {
+		tr.ID, tr.EventID = id, event
+		return tr
+	}
+	ts := []models.ItemTransfer{
+		with(1, 3, move("transfer", alice, bob, 1)),
+		with(2, 0, move("transfer", bob, town, 1)),
+		with(3, 1, move("transfer", alice, chest, 1)),
+		with(4, 0, create(alice, 3)),
+		with(5, 1, create(bob, 1)),
+	}
+	Sort(o, ts)
+	ids := func(ts []models.ItemTransfer) []uint {
+		var out []uint
+		for _, t := range ts {
+			out = append(out, t.ID)
+		}
+		return out
+	}
+	if got, want := ids(ts), []uint{4, 3, 5, 1, 2}; !slices.Equal(got, want) {
+		t.Fatalf("Sort = %v; want %v", got, want)
+	}
+	tests := []struct {
+		p    chrono.Point
+		want []uint
+	}{
+		{day(1), []uint{4, 3, 5}},
+		{day(2), []uint{4, 3, 5}},
+		{day(3), []uint{4, 3, 5, 1}},
+		{chrono.Point{EventID: 99}, []uint{4}},
+	}
+	for _, tt := range tests {
+		if got := ids(AsOf(o, ts, tt.p)); !slices.Equal(got, tt.want) {
+			t.Errorf("AsOf(%+v) = %v; want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// CreateAbility gives a character an ability at level, gained at an event,
+// or before the story when eventID is 0.
+func (s *Services) CreateAbility(charID uint, name string, level int, eventID uint) (*models.Ability, error) {
+	if err := s.DB.First(&models.Character{}, charID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", charID)}
+	}
+	if err := s.checkEvent(eventID); err != nil {
+		return nil, err
+	}
+	ab := &models.Ability{CharacterID: charID, Name: name, Level: level, EventID: eventID}
+	if err := s.DB.Create(ab).Error; err != nil {
+		return nil, err
+	}
+	return ab, nil
+}
+
+// UpgradeAbility records an ability reaching level at an event, which may
+// be 0, and sets its level to that after every upgrade in story order. An
+// ability has one upgrade per event: recording another replaces its level.
+func (s *Services) UpgradeAbility(abilityID uint, level int, eventID uint) (*models.Ability, error) {
+	var ab models.Ability
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		if err := tx.First(&ab, abilityID).Error; err != nil {
+			return &tool.FieldError{Field: "abilityID", Msg: fmt.Sprintf("ability %d not found", abilityID)}
+		}
+		if err := t.checkEvent(eventID); err != nil {
+			return err
+		}
+		var up models.AbilityUpgrade
+		if err := tx.Where("ability_id = ? AND event_id = ?", abilityID, eventID).Limit(1).Find(&up).Error; err != nil {
+			return err
+		}
+		if up.ID == 0 {
+			up = models.AbilityUpgrade{AbilityID: abilityID, EventID: eventID, From: ab.Level}
+		}
+		up.Level = level
+		if err := tx.Save(&up).Error; err != nil {
+			return err
+		}
+		o, err := chrono.Load(tx)
+		if err != nil {
+			return err
+		}
+		ups, err := t.abilityUpgrades(o, []uint{abilityID})
+		if err != nil {
+			return err
+		}
+		ab.Level = levelAt(o, ab, ups[abilityID], nil)
+		return tx.Model(&ab).UpdateColumn("level", ab.Level).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ab, nil
+}
+
+// abilityUpgrades loads the upgrades of abilities, keyed by ability, in
+// story order: those at an event first, then the rest as recorded.
+func (s *Services) abilityUpgrades(o chrono.Order, abilityIDs []uint) (map[uint][]models.AbilityUpgrade, error) {
+	var rows []models.AbilityUpgrade
+	if err := s.DB.Where("ability_id IN ?", abilityIDs).Order("id asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(rows, func(a, b models.AbilityUpgrade) int {
+		if a.EventID == 0 || b.EventID == 0 {
+			return cmp.Compare(min(b.EventID, 1), min(a.EventID, 1))
+		}
+		return chrono.Cmp(o.Of(a.EventID), o.Of(b.EventID))
+	})
+	out := map[uint][]models.AbilityUpgrade{}
+	for _, u := range rows {
+		out[u.AbilityID] = append(out[u.AbilityID], u)
+	}
+	return out, nil
+}
+
+// levelAt is an ability's level as of p, given its upgrades in story order,
+// or after all of them when p is nil. Upgrades that cannot be placed
+// against p have not happened yet.
+func levelAt(o chrono.Order, ab models.Ability, ups []models.AbilityUpgrade, p *chrono.Point) int {
+	if len(ups) == 0 {
+		return ab.Level
+	}
+	if p == nil {
+		return ups[len(ups)-1].Level
+	}
+	first := slices.MinFunc(ups, func(a, b models.AbilityUpgrade) int { return cmp.Compare(a.ID, b.ID) })
+	level := first.From
+	for _, u := range ups {
+		if u.EventID != 0 && chrono.NotAfter(o.Of(u.EventID), *p) {
+			level = u.Level
+		}
+	}
+	return level
+}
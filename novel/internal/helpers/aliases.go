@@ -0,0 +1,145 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// CharacterMatch is a character a name resolved to, with the alias it was
+// found by; Alias is empty when the name is the character's own.
+type CharacterMatch struct {
+	models.Character
+	Alias string
+	Kind  string
+}
+
+func (m CharacterMatch) String() string {
+	if m.Alias == "" {
+		return fmt.Sprintf("%d %s", m.ID, m.Name)
+	}
+	kind := m.Kind
+	if kind == "" {
+		kind = "别名"
+	}
+	return fmt.Sprintf("%d %s（%s %s）", m.ID, m.Name, kind, m.Alias)
+}
+
+// matchCharacters finds the characters name refers to among those of
+// novelID (see characterScope): those called name first, then those going
+// by it as an alias, each character once. With preferName a character's
+// own name wins, and aliases only count when no character is called name.
+func (s *Services) matchCharacters(novelID uint, name string, preferName bool) ([]CharacterMatch, error) {
+	scope := s.characterScope(novelID)
+	var cs []models.Character
+	if err := scoped(s.DB.Where("name = ?", name), "id", scope).Order("id asc").Find(&cs).Error; err != nil {
+		return nil, err
+	}
+	out := []CharacterMatch{}
+	seen := map[uint]bool{}
+	for _, c := range cs {
+		out = append(out, CharacterMatch{Character: c})
+		seen[c.ID] = true
+	}
+	if preferName && len(out) > 0 {
+		return out, nil
+	}
+	var as []models.CharacterAlias
+	if err := scoped(s.DB.Where("name = ?", name), "character_id", scope).Order("character_id asc, id asc").Find(&as).Error; err != nil {
+		return nil, err
+	}
+	for _, a := range as {
+		if seen[a.CharacterID] {
+			continue
+		}
+		var c models.Character
+		// An alias outlives its character only while both are in the trash.
+		if err := s.DB.First(&c, a.CharacterID).Error; err != nil {
+			continue
+		}
+		out = append(out, CharacterMatch{Character: c, Alias: a.Name, Kind: a.Kind})
+		seen[c.ID] = true
+	}
+	return out, nil
+}
+
+// resolveCharacter is the one character of novelID that name or alias
+// refers to, see matchCharacters for preferName. It fails on field when
+// none does, naming characters outside the novel that would match, and
+// lists the candidates when several do.
+func (s *Services) resolveCharacter(field string, novelID uint, name string, preferName bool) (*models.Character, error) {
+	ms, err := s.matchCharacters(novelID, name, preferName)
+	if err != nil {
+		return nil, err
+	}
+	switch len(ms) {
+	case 0:
+		msg := fmt.Sprintf("no character is named or aliased %q", name)
+		if novelID != 0 {
+			msg += fmt.Sprintf(" in novel %d", novelID)
+			if out, err := s.matchCharacters(0, name, preferName); err == nil && len(out) > 0 {
+				msg += fmt.Sprintf("; outside it: %s (add with novelHelper addCharacter)", candidates(out))
+			}
+		}
+		return nil, &tool.FieldError{Field: field, Msg: msg}
+	case 1:
+		return &ms[0].Character, nil
+	}
+	return nil, &tool.FieldError{Field: field, Msg: fmt.Sprintf("%q is ambiguous, candidates: %s; use a character ID, or preferName to take the one called so", name, candidates(ms))}
+}
+
+func candidates(ms []CharacterMatch) string {
+	out := make([]string, len(ms))
+	for i, m := range ms {
+		out[i] = m.String()
+	}
+	return strings.Join(out, "; ")
+}
+
+// CharacterAliases lists a character's aliases in the order they were added.
+func (s *Services) CharacterAliases(characterID uint) ([]models.CharacterAlias, error) {
+	if err := s.DB.First(&models.Character{}, characterID).Error; err != nil {
+		return nil, err
+	}
+	as := []models.CharacterAlias{}
+	err := s.DB.Where("character_id = ?", characterID).Order("id asc").Find(&as).Error
+	return as, err
+}
+
+// AddCharacterAlias gives a character another name. Adding an alias it
+// already has only updates its kind.
+func (s *Services) AddCharacterAlias(characterID uint, name, kind string) (*models.CharacterAlias, error) {
+	a := &models.CharacterAlias{CharacterID: characterID, Name: name, Kind: kind}
+	if err := validateModel("characterAlias", a, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var c models.Character
+		if err := tx.First(&c, characterID).Error; err != nil {
+			return &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+		}
+		if c.Name == name {
+			return &tool.FieldError{Field: "name", Msg: fmt.Sprintf("is the name of character %d already", characterID)}
+		}
+		var old models.CharacterAlias
+		if err := tx.Where("character_id = ? AND name = ?", characterID, name).Limit(1).Find(&old).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return tx.Create(a).Error
+		}
+		*a = old
+		if kind == "" || kind == old.Kind {
+			return nil
+		}
+		a.Kind = kind
+		return tx.Model(a).Update("kind", kind).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
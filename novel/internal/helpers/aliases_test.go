@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+	"testing"
+)
+
+func TestResolveCharacter(t *testing.T) {
+	tests := []struct {
+		name       string
+		lookup     string
+		preferName bool
+		want       uint
+		candidates string
+	}{
+		{"name", "乙", false, 2, ""},
+		{"alias", "教头", false, 1, ""},
+		{"name and another's alias", "甲", false, 0, "1 甲; 3 丙（号 甲）"},
+		{"name preferred over an alias", "甲", true, 1, ""},
+		{"shared alias", "先生", false, 0, "1 甲（别名 先生）; 2 乙（别名 先生）"},
+		{"shared alias with no name", "先生", true, 0, "1 甲（别名 先生）; 2 乙（别名 先生）"},
+		{"none", "丁", false, 0, "no character"},
+	}
+	s := testStory(t)
+	if err := s.DB.Create(&models.Character{ID: 3, Name: "丙"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []models.CharacterAlias{
+		{CharacterID: 1, Name: "教头"}, {CharacterID: 3, Name: "甲", Kind: "号"},
+		{CharacterID: 1, Name: "先生"}, {CharacterID: 2, Name: "先生"},
+	} {
+		if _, err := s.AddCharacterAlias(a.CharacterID, a.Name, a.Kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := s.resolveCharacter("name", 0, tt.lookup, tt.preferName)
+			if tt.want != 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c.ID != tt.want {
+					t.Errorf("resolved to %d; want %d", c.ID, tt.want)
+				}
+				return
+			}
+			fe, ok := err.(*tool.FieldError)
+			if !ok || !strings.Contains(fe.Msg, tt.candidates) {
+				t.Errorf("resolve = %v; want an error listing %s", err, tt.candidates)
+			}
+		})
+	}
+	if _, err := s.EnsureCharacter(0, "甲", "", false); err == nil {
+		t.Error("ensure of a name that is also an alias succeeded")
+	}
+	if c, err := s.EnsureCharacter(0, "甲", "", true); err != nil || c.ID != 1 {
+		t.Errorf("ensure preferring the name = %v, %v; want character 1", c, err)
+	}
+}
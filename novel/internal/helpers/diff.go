@@ -0,0 +1,254 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// edit is one line of a line diff: ' ' kept, '-' only in a, '+' only in b.
+// A and B are the line's indexes in a and b, -1 where it is absent.
+type edit struct {
+	Op   byte
+	Text string
+	A, B int
+}
+
+// diffLines computes a shortest line edit script from a to b, trimming the
+// common head and tail before the LCS table.
+func diffLines(a, b []string) []edit {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	// lcs[i][j] is the LCS length of ma[i:] and mb[j:].
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []edit
+	for i := 0; i < pre; i++ {
+		out = append(out, edit{' ', a[i], i, i})
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			out = append(out, edit{' ', ma[i], pre + i, pre + j})
+			i++
+			j++
+		case i < len(ma) && (j == len(mb) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, edit{'-', ma[i], pre + i, -1})
+			i++
+		default:
+			out = append(out, edit{'+', mb[j], -1, pre + j})
+			j++
+		}
+	}
+	for k := 0; k < suf; k++ {
+		out = append(out, edit{' ', a[len(a)-suf+k], len(a) - suf + k, len(b) - suf + k})
+	}
+	return out
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// deltaOp is one step of a stored delta: keep K lines, drop D lines, then
+// insert I.
+type deltaOp struct {
+	K int      `json:"k,omitempty"`
+	D int      `json:"d,omitempty"`
+	I []string `json:"i,omitempty"`
+}
+
+// makeDelta encodes the line changes turning from into to.
+func makeDelta(from, to string) string {
+	var ops []deltaOp
+	for _, e := range diffLines(splitLines(from), splitLines(to)) {
+		var last *deltaOp
+		if len(ops) > 0 {
+			last = &ops[len(ops)-1]
+		}
+		switch e.Op {
+		case ' ':
+			if last != nil && last.D == 0 && last.I == nil {
+				last.K++
+			} else {
+				ops = append(ops, deltaOp{K: 1})
+			}
+		case '-':
+			if last != nil && last.I == nil {
+				last.D++
+			} else {
+				ops = append(ops, deltaOp{D: 1})
+			}
+		case '+':
+			if last != nil {
+				last.I = append(last.I, e.Text)
+			} else {
+				ops = append(ops, deltaOp{I: []string{e.Text}})
+			}
+		}
+	}
+	b, _ := json.Marshal(ops)
+	return string(b)
+}
+
+// applyDelta rebuilds the text a delta from makeDelta was made towards.
+func applyDelta(from string, delta string) (string, error) {
+	var ops []deltaOp
+	if err := json.Unmarshal([]byte(delta), &ops); err != nil {
+		return "", err
+	}
+	src := splitLines(from)
+	var out []string
+	pos := 0
+	for _, op := range ops {
+		if pos+op.K+op.D > len(src) {
+			return "", fmt.Errorf("delta does not fit its base revision")
+		}
+		out = append(out, src[pos:pos+op.K]...)
+		pos += op.K + op.D
+		out = append(out, op.I...)
+	}
+	out = append(out, src[pos:]...)
+	return strings.Join(out, "\n"), nil
+}
+
+// unifiedDiff renders the line diff of a and b with three lines of context.
+func unifiedDiff(fromName, toName, a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+	const context = 3
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for i := 0; i < len(edits); {
+		if edits[i].Op == ' ' {
+			i++
+			continue
+		}
+		// A hunk runs from context lines before this change to context
+		// lines after the last change closer than 2*context to the next.
+		start := max(i-context, 0)
+		end := i
+		for k := i; k < len(edits); k++ {
+			if edits[k].Op != ' ' {
+				end = k
+			} else if k-end > 2*context {
+				break
+			}
+		}
+		end = min(end+context+1, len(edits))
+		aStart, bStart, aLen, bLen := -1, -1, 0, 0
+		for _, e := range edits[start:end] {
+			if e.Op != '+' {
+				if aStart < 0 {
+					aStart = e.A
+				}
+				aLen++
+			}
+			if e.Op != '-' {
+				if bStart < 0 {
+					bStart = e.B
+				}
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen, edits, start, true), hunkRange(bStart, bLen, edits, start, false))
+		for _, e := range edits[start:end] {
+			sb.WriteByte(e.Op)
+			sb.WriteString(e.Text)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats a unified diff range; an empty side is given as the
+// line before the hunk, as diff(1) does.
+func hunkRange(start, n int, edits []edit, from int, a bool) string {
+	if n == 0 {
+		before := 0
+		for _, e := range edits[:from] {
+			if a && e.Op != '+' || !a && e.Op != '-' {
+				before++
+			}
+		}
+		return fmt.Sprintf("%d,0", before)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+// ParagraphChange is one difference between two versions of a chapter, by
+// paragraph number (1-based, blank lines not counted). Op is "added",
+// "removed" or "changed"; From and To are 0 on the side that lacks it.
+type ParagraphChange struct {
+	Op   string
+	From int
+	To   int
+	Old  string
+	New  string
+}
+
+// paragraphDiff compares a and b paragraph by paragraph. Removed and added
+// paragraphs in the same place are paired up in order as changes.
+func paragraphDiff(a, b string) []ParagraphChange {
+	edits := diffLines(paragraphs(a), paragraphs(b))
+	out := []ParagraphChange{}
+	for i := 0; i < len(edits); {
+		if edits[i].Op == ' ' {
+			i++
+			continue
+		}
+		var del, add []edit
+		for ; i < len(edits) && edits[i].Op == '-'; i++ {
+			del = append(del, edits[i])
+		}
+		for ; i < len(edits) && edits[i].Op == '+'; i++ {
+			add = append(add, edits[i])
+		}
+		for k := 0; k < max(len(del), len(add)); k++ {
+			switch {
+			case k >= len(add):
+				out = append(out, ParagraphChange{Op: "removed", From: del[k].A + 1, Old: del[k].Text})
+			case k >= len(del):
+				out = append(out, ParagraphChange{Op: "added", To: add[k].B + 1, New: add[k].Text})
+			default:
+				out = append(out, ParagraphChange{Op: "changed", From: del[k].A + 1, To: add[k].B + 1, Old: del[k].Text, New: add[k].Text})
+			}
+		}
+	}
+	return out
+}
+
+// paragraphs returns the non-blank lines of content.
+func paragraphs(content string) []string {
+	var out []string
+	for _, off := range paragraphStarts(content) {
+		line, _, _ := strings.Cut(content[off:], "\n")
+		out = append(out, line)
+	}
+	return out
+}
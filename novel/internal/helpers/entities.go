@@ -0,0 +1,218 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+)
+
+// GetByID loads one world, period, timeSegment, location, character, novel,
+// volume or chapter by ID.
+func (s *Services) GetByID(entity string, id uint) (any, error) {
+	switch entity {
+	case "world":
+		var w models.World
+		if err := s.DB.First(&w, id).Error; err != nil {
+			return nil, err
+		}
+		return w, nil
+	case "period":
+		var p models.Period
+		if err := s.DB.First(&p, id).Error; err != nil {
+			return nil, err
+		}
+		return p, nil
+	case "timeSegment":
+		var ts models.TimeSegment
+		if err := s.DB.First(&ts, id).Error; err != nil {
+			return nil, err
+		}
+		return ts, nil
+	case "location":
+		var l models.Location
+		if err := s.DB.First(&l, id).Error; err != nil {
+			return nil, err
+		}
+		return l, nil
+	case "character":
+		var c models.Character
+		if err := s.DB.First(&c, id).Error; err != nil {
+			return nil, err
+		}
+		return c, nil
+	case "novel":
+		var n models.Novel
+		if err := s.DB.First(&n, id).Error; err != nil {
+			return nil, err
+		}
+		return n, nil
+	case "volume":
+		var v models.Volume
+		if err := s.DB.First(&v, id).Error; err != nil {
+			return nil, err
+		}
+		return v, nil
+	case "chapter":
+		var ch models.Chapter
+		if err := s.DB.First(&ch, id).Error; err != nil {
+			return nil, err
+		}
+		return ch, nil
+	}
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// FindByName looks an entity up by name (or title, for novels, volumes and
+// chapters) under its parent; parentID is ignored for top-level entities.
+// novelID, if set, limits worlds, characters and, when parentID is 0,
+// locations to those of the novel. preferName settles a character name that
+// is also another's alias; see matchCharacters.
+func (s *Services) FindByName(entity string, name string, parentID uint, novelID uint, preferName bool) (any, error) {
+	switch entity {
+	case "world":
+		return s.GetWorldByName(novelID, name)
+	case "period":
+		return s.GetPeriodByName(parentID, name)
+	case "timeSegment":
+		return s.GetTimeSegmentByName(parentID, name)
+	case "location":
+		if parentID == 0 && novelID != 0 {
+			return s.novelLocationByName(novelID, name)
+		}
+		return s.GetLocationByName(parentID, name)
+	case "character":
+		return s.GetCharacterByName(novelID, name, preferName)
+	case "novel":
+		return s.GetNovelByTitle(name)
+	case "volume":
+		return s.GetVolumeByTitle(parentID, name)
+	case "chapter":
+		return s.GetChapterByTitle(parentID, name)
+	}
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// List returns all entities of a kind, restricted to parentID for kinds that
+// have a parent. novelID, if set, limits worlds, characters, events, plot
+// threads and, when parentID is 0, locations and organizations to those of
+// the novel.
+func (s *Services) List(entity string, parentID uint, novelID uint) (any, error) {
+	switch entity {
+	case "world":
+		scope := s.worldScope(novelID)
+		var a []models.World
+		if err := scoped(s.DB, "id", scope).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "period":
+		var a []models.Period
+		if err := s.DB.Where("world_id = ?", parentID).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "timeSegment":
+		var a []models.TimeSegment
+		if err := s.DB.Where("period_id = ?", parentID).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "location":
+		q := s.DB.Where("world_id = ?", parentID)
+		if parentID == 0 && novelID != 0 {
+			scope := s.worldScope(novelID)
+			q = scoped(s.DB, "world_id", scope)
+		}
+		var a []models.Location
+		if err := q.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "character":
+		scope := s.characterScope(novelID)
+		var a []models.Character
+		if err := scoped(s.DB, "id", scope).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "novel":
+		var a []models.Novel
+		if err := s.DB.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "volume":
+		var a []models.Volume
+		if err := s.DB.Where("novel_id = ?", parentID).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "chapter":
+		var a []models.Chapter
+		if err := s.DB.Where("volume_id = ?", parentID).Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "event":
+		q := s.DB
+		if novelID != 0 {
+			q = q.Where("chapter_id IN (?)", s.novelChapters(novelID))
+		}
+		var a []models.Event
+		if err := q.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "organization":
+		q := s.DB.Where("world_id = ?", parentID)
+		if parentID == 0 && novelID != 0 {
+			scope := s.worldScope(novelID)
+			q = scoped(s.DB, "world_id", scope)
+		}
+		var a []models.Organization
+		if err := q.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "item":
+		var a []models.Item
+		if err := s.DB.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "ability":
+		var a []models.Ability
+		if err := s.DB.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "memory":
+		var a []models.Memory
+		if err := s.DB.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	case "plotThread":
+		q := s.DB
+		if novelID != 0 {
+			q = q.Where("novel_id = ?", novelID)
+		}
+		var a []models.PlotThread
+		if err := q.Find(&a).Error; err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// novelID resolves a novel given either its ID or its title.
+func (s *Services) novelID(id uint, title string) (uint, error) {
+	if id != 0 || title == "" {
+		return id, nil
+	}
+	n, err := s.GetNovelByTitle(title)
+	if err != nil {
+		return 0, err
+	}
+	return n.ID, nil
+}
@@ -0,0 +1,190 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const defaultRole = "protagonist"
+
+// withLinks preloads the participants and items of the events it finds.
+func (s *Services) withLinks() *gorm.DB {
+	byID := func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }
+	return s.DB.Preload("Participants", byID).Preload("Items", byID)
+}
+
+func (s *Services) GetEvent(eventID uint) (*models.Event, error) {
+	var e models.Event
+	if err := s.withLinks().First(&e, eventID).Error; err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func checkRole(field string, role *string) error {
+	if *role == "" {
+		*role = defaultRole
+	}
+	if !slices.Contains(models.ParticipantRoles, *role) {
+		return &tool.FieldError{Field: field, Msg: fmt.Sprintf("role must be one of %s", strings.Join(models.ParticipantRoles, ", "))}
+	}
+	return nil
+}
+
+// SetEventParticipants replaces the characters taking part in an event.
+// Each character must exist and be listed once; an empty role means
+// protagonist.
+func (s *Services) SetEventParticipants(eventID uint, parts []models.EventParticipant) error {
+	seen := map[uint]bool{}
+	for i := range parts {
+		p := &parts[i]
+		if err := checkRole("participants", &p.Role); err != nil {
+			return err
+		}
+		if seen[p.CharacterID] {
+			return &tool.FieldError{Field: "participants", Msg: fmt.Sprintf("character %d listed more than once", p.CharacterID)}
+		}
+		seen[p.CharacterID] = true
+		if err := s.DB.First(&models.Character{}, p.CharacterID).Error; err != nil {
+			return &tool.FieldError{Field: "participants", Msg: fmt.Sprintf("character %d not found", p.CharacterID)}
+		}
+		p.ID, p.EventID = 0, eventID
+	}
+	// Links already in the trash stay there so restoring their character
+	// brings them back.
+	if err := s.DB.Unscoped().Where("event_id = ? AND deleted_at IS NULL", eventID).Delete(&models.EventParticipant{}).Error; err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	return s.DB.Create(&parts).Error
+}
+
+// SetEventItems replaces the items an event involves, checked like
+// SetEventParticipants.
+func (s *Services) SetEventItems(eventID uint, items []models.EventItem) error {
+	seen := map[uint]bool{}
+	for i := range items {
+		it := &items[i]
+		if err := checkRole("items", &it.Role); err != nil {
+			return err
+		}
+		if seen[it.ItemID] {
+			return &tool.FieldError{Field: "items", Msg: fmt.Sprintf("item %d listed more than once", it.ItemID)}
+		}
+		seen[it.ItemID] = true
+		if err := s.DB.First(&models.Item{}, it.ItemID).Error; err != nil {
+			return &tool.FieldError{Field: "items", Msg: fmt.Sprintf("item %d not found", it.ItemID)}
+		}
+		it.ID, it.EventID = 0, eventID
+	}
+	if err := s.DB.Unscoped().Where("event_id = ? AND deleted_at IS NULL", eventID).Delete(&models.EventItem{}).Error; err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return s.DB.Create(&items).Error
+}
+
+// UpdateEvent changes the given fields of an event and, when non-nil,
+// replaces its participants or items, all in one transaction. An event
+// moved to another chapter goes to the end of it.
+func (s *Services) UpdateEvent(eventID uint, fields map[string]any, participants []models.EventParticipant, items []models.EventItem) (*models.Event, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		old, err := sc.GetEvent(eventID)
+		if err != nil {
+			return err
+		}
+		m, err := sc.UpdateEntity("event", eventID, fields)
+		if err != nil {
+			return err
+		}
+		e := m.(*models.Event)
+		if err := sc.checkStoryTime(e); err != nil {
+			return err
+		}
+		if e.SceneID != old.SceneID {
+			if err := sc.checkScene(e); err != nil {
+				return err
+			}
+		}
+		if e.ChapterID != old.ChapterID {
+			if err := sc.placeEvent(e.ID, e.ChapterID, -1); err != nil {
+				return err
+			}
+		}
+		if participants != nil {
+			if err := sc.SetEventParticipants(eventID, participants); err != nil {
+				return err
+			}
+		}
+		if items != nil {
+			return sc.SetEventItems(eventID, items)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEvent(eventID)
+}
+
+// CharacterEvents returns the events a character takes part in, optionally
+// only those where it has the given role.
+func (s *Services) CharacterEvents(characterID uint, role string) ([]models.Event, error) {
+	ids := s.DB.Model(&models.EventParticipant{}).Select("event_id").Where("character_id = ?", characterID)
+	if role != "" {
+		ids = ids.Where("role = ?", role)
+	}
+	evs := []models.Event{}
+	if err := s.withLinks().Where("id IN (?)", ids).Order("id asc").Find(&evs).Error; err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
+// MigrateEventLinks moves the comma-separated Characters and Items columns
+// that earlier versions kept on events into EventParticipant and EventItem
+// rows with the default role, then drops the columns.
+func MigrateEventLinks(db *gorm.DB) error {
+	for _, col := range []string{"characters", "items"} {
+		if !db.Migrator().HasColumn(&models.Event{}, col) {
+			continue
+		}
+		var rows []struct {
+			ID   uint
+			List string
+		}
+		if err := db.Table("events").Select("id, " + col + " AS list").Where(col + " <> ''").Order("id asc").Scan(&rows).Error; err != nil {
+			return err
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, r := range rows {
+				ids := splitIDs(r.List)
+				slices.Sort(ids)
+				for _, id := range slices.Compact(ids) {
+					var link any = &models.EventParticipant{EventID: r.ID, CharacterID: id, Role: defaultRole}
+					if col == "items" {
+						link = &models.EventItem{EventID: r.ID, ItemID: id, Role: defaultRole}
+					}
+					if err := tx.Create(link).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Migrator().DropColumn(&models.Event{}, col)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
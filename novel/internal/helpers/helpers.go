@@ -1,8 +1,10 @@
 package helpers
 
 import (
+	"context"
 	"errors"
 	"mcpnovel/internal/models"
+	"mcpnovel/internal/progress"
 	"strconv"
 	"strings"
 	"time"
@@ -39,39 +41,66 @@ func (s *Services) CreateChapter(volumeID uint, title string, index int, status
 }
 
 func (s *Services) UpsertChapterContent(chapterID uint, content string) error {
-	return s.DB.Model(&models.Chapter{}).Where("id = ?", chapterID).Updates(map[string]interface{}{"content": content}).Error
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var c models.Chapter
+		if err := tx.First(&c, chapterID).Error; err != nil {
+			return err
+		}
+		_, err := (&Services{DB: tx}).setContent(&c, content, "")
+		return err
+	})
 }
 
-func (s *Services) CreateWorld(name string, description string) (*models.World, error) {
+// CreateWorld creates a world, registered with novelID unless it is 0.
+func (s *Services) CreateWorld(name string, description string, novelID uint) (*models.World, error) {
 	w := &models.World{Name: name, Description: description}
-	if err := s.DB.Create(w).Error; err != nil {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if novelID == 0 {
+			return tx.Create(w).Error
+		}
+		if err := sc.checkNovel(novelID); err != nil {
+			return err
+		}
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		return sc.joinWorld(novelID, w.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
 	return w, nil
 }
 
-func (s *Services) GetWorldByName(name string) (*models.World, error) {
+// GetWorldByName finds a world by name among those of novelID (see
+// worldScope).
+func (s *Services) GetWorldByName(novelID uint, name string) (*models.World, error) {
+	scope := s.worldScope(novelID)
 	var w models.World
-	if err := s.DB.Where("name = ?", name).First(&w).Error; err != nil {
+	if err := scoped(s.DB.Where("name = ?", name), "id", scope).First(&w).Error; err != nil {
 		return nil, err
 	}
 	return &w, nil
 }
 
-func (s *Services) EnsureWorld(name string, description string) (*models.World, error) {
-	var w models.World
-	err := s.DB.Where("name = ?", name).First(&w).Error
+// EnsureWorld finds a world by name among those of novelID, creating it
+// when there is none; with novelID set the world ends up registered with
+// that novel.
+func (s *Services) EnsureWorld(novelID uint, name string, description string) (*models.World, error) {
+	w, err := s.GetWorldByName(novelID, name)
 	if errors.Is(err, gorm.ErrRecordNotFound) {
-		w = models.World{Name: name, Description: description}
-		if e := s.DB.Create(&w).Error; e != nil {
-			return nil, e
-		}
-		return &w, nil
+		return s.CreateWorld(name, description, novelID)
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &w, nil
+	if novelID != 0 {
+		if err := s.joinWorld(novelID, w.ID); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
 }
 
 func (s *Services) CreatePeriod(worldID uint, name string, index int) (*models.Period, error) {
@@ -138,9 +167,17 @@ func (s *Services) EnsureTimeSegment(periodID uint, name string, start time.Time
 	return &ts, nil
 }
 
-func (s *Services) CreateLocation(worldID uint, name string, description string) (*models.Location, error) {
-	l := &models.Location{WorldID: worldID, Name: name, Description: description}
-	if err := s.DB.Create(l).Error; err != nil {
+// CreateLocation adds a location to a world, within parentID unless it is
+// 0.
+func (s *Services) CreateLocation(worldID uint, parentID uint, name string, description string) (*models.Location, error) {
+	l := &models.Location{WorldID: worldID, ParentID: parentID, Name: name, Description: description}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := (&Services{DB: tx}).checkParent(&models.Location{}, "location", 0, worldID, parentID); err != nil {
+			return err
+		}
+		return tx.Create(l).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 	return l, nil
@@ -170,118 +207,100 @@ func (s *Services) EnsureLocation(worldID uint, name string, description string)
 	return &l, nil
 }
 
-func (s *Services) CreateCharacter(name string, bio string) (*models.Character, error) {
-	c := &models.Character{Name: name, Bio: bio}
-	if err := s.DB.Create(c).Error; err != nil {
-		return nil, err
-	}
-	return c, nil
-}
-
-func (s *Services) GetCharacterByName(name string) (*models.Character, error) {
-	var c models.Character
-	if err := s.DB.Where("name = ?", name).First(&c).Error; err != nil {
-		return nil, err
-	}
-	return &c, nil
-}
-
-func (s *Services) EnsureCharacter(name string, bio string) (*models.Character, error) {
-	var c models.Character
-	err := s.DB.Where("name = ?", name).First(&c).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		c = models.Character{Name: name, Bio: bio}
-		if e := s.DB.Create(&c).Error; e != nil {
-			return nil, e
+// CreateCharacter creates a character, registered with novelID unless it
+// is 0.
+func (s *Services) CreateCharacter(name string, bio string, birthTimeSegmentID uint, novelID uint) (*models.Character, error) {
+	c := &models.Character{Name: name, Bio: bio, BirthTimeSegmentID: birthTimeSegmentID}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if novelID == 0 {
+			return tx.Create(c).Error
 		}
-		return &c, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &c, nil
-}
-
-func (s *Services) SetCharacterRelationship(aid uint, bid uint, rtype string, intimacy float64) (*models.CharacterRelationship, error) {
-	var rel models.CharacterRelationship
-	err := s.DB.Where("a_id = ? AND b_id = ?", aid, bid).First(&rel).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		rel = models.CharacterRelationship{AID: aid, BID: bid, Type: rtype, Intimacy: intimacy}
-		if e := s.DB.Create(&rel).Error; e != nil {
-			return nil, e
+		if err := sc.checkNovel(novelID); err != nil {
+			return err
 		}
-	} else if err == nil {
-		rel.Type = rtype
-		rel.Intimacy = intimacy
-		if e := s.DB.Save(&rel).Error; e != nil {
-			return nil, e
+		if err := tx.Create(c).Error; err != nil {
+			return err
 		}
-	} else {
-		return nil, err
-	}
-	var rev models.CharacterRelationship
-	e2 := s.DB.Where("a_id = ? AND b_id = ?", bid, aid).First(&rev).Error
-	if errors.Is(e2, gorm.ErrRecordNotFound) {
-		rev = models.CharacterRelationship{AID: bid, BID: aid, Type: rtype, Intimacy: intimacy}
-		_ = s.DB.Create(&rev).Error
-	} else if e2 == nil {
-		rev.Type = rtype
-		rev.Intimacy = intimacy
-		_ = s.DB.Save(&rev).Error
-	}
-	return &rel, nil
-}
-
-func (s *Services) CreateEvent(chapterID uint, worldID uint, locationID uint, timeSegmentID uint, description string, characters []uint, items []uint) (*models.Event, error) {
-	e := &models.Event{ChapterID: chapterID, WorldID: worldID, LocationID: locationID, TimeSegmentID: timeSegmentID, Description: description, Characters: joinIDs(characters), Items: joinIDs(items)}
-	if err := s.DB.Create(e).Error; err != nil {
+		return sc.joinCharacter(novelID, c.ID)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return e, nil
+	return c, nil
 }
 
-func (s *Services) CreateItem(name string, ownerID uint, locationID uint, status string) (*models.Item, error) {
-	it := &models.Item{Name: name, OwnerCharacterID: ownerID, LocationID: locationID, Status: status}
-	if err := s.DB.Create(it).Error; err != nil {
-		return nil, err
-	}
-	return it, nil
+// GetCharacterByName finds the one character of novelID called name or
+// going by it as an alias; see resolveCharacter.
+func (s *Services) GetCharacterByName(novelID uint, name string, preferName bool) (*models.Character, error) {
+	return s.resolveCharacter("name", novelID, name, preferName)
 }
 
-func (s *Services) TransferItem(itemID uint, fromID uint, toID uint, eventID uint) (*models.ItemTransfer, error) {
-	var it models.Item
-	if err := s.DB.First(&it, itemID).Error; err != nil {
-		return nil, err
-	}
-	t := &models.ItemTransfer{ItemID: itemID, FromCharacterID: fromID, ToCharacterID: toID, EventID: eventID}
-	if err := s.DB.Create(t).Error; err != nil {
+// EnsureCharacter finds the character of novelID called or aliased name,
+// creating it when there is none; with novelID set the character ends up
+// registered with that novel. Several matches are an error, as in
+// GetCharacterByName.
+func (s *Services) EnsureCharacter(novelID uint, name string, bio string, preferName bool) (*models.Character, error) {
+	ms, err := s.matchCharacters(novelID, name, preferName)
+	if err != nil {
 		return nil, err
 	}
-	it.OwnerCharacterID = toID
-	if err := s.DB.Save(&it).Error; err != nil {
-		return nil, err
+	switch len(ms) {
+	case 0:
+		return s.CreateCharacter(name, bio, 0, novelID)
+	case 1:
+	default:
+		return s.resolveCharacter("name", novelID, name, preferName)
 	}
-	return t, nil
-}
-
-func (s *Services) CreateAbility(charID uint, name string, level int) (*models.Ability, error) {
-	ab := &models.Ability{CharacterID: charID, Name: name, Level: level}
-	if err := s.DB.Create(ab).Error; err != nil {
-		return nil, err
+	c := &ms[0].Character
+	if novelID != 0 {
+		if err := s.joinCharacter(novelID, c.ID); err != nil {
+			return nil, err
+		}
 	}
-	return ab, nil
+	return c, nil
 }
 
-func (s *Services) UpgradeAbility(abilityID uint, level int) (*models.Ability, error) {
-	var ab models.Ability
-	if err := s.DB.First(&ab, abilityID).Error; err != nil {
-		return nil, err
-	}
-	ab.Level = level
-	if err := s.DB.Save(&ab).Error; err != nil {
+// CreateEvent inserts an event together with its participants and items,
+// at the end of its chapter or where at says; see SetEventParticipants for
+// how participants are checked. The chapter may instead come from sceneID,
+// or from at when it names an event.
+func (s *Services) CreateEvent(chapterID uint, sceneID uint, worldID uint, locationID uint, timeSegmentID uint, storyTime *time.Time, description string, participants []models.EventParticipant, items []models.EventItem, at Placement) (*models.Event, error) {
+	e := &models.Event{ChapterID: chapterID, SceneID: sceneID, WorldID: worldID, LocationID: locationID, TimeSegmentID: timeSegmentID, StoryTime: storyTime, Description: description}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		var err error
+		if err = sc.checkStoryTime(e); err != nil {
+			return err
+		}
+		if chapterID == 0 && sceneID != 0 && at == (Placement{}) {
+			if chapterID, err = sc.sceneChapter(sceneID); err != nil {
+				return err
+			}
+		}
+		chID, pos, err := sc.locate(0, chapterID, at)
+		if err != nil {
+			return err
+		}
+		e.ChapterID = chID
+		if err := sc.checkScene(e); err != nil {
+			return err
+		}
+		if err := tx.Create(e).Error; err != nil {
+			return err
+		}
+		if err := sc.placeEvent(e.ID, chID, pos); err != nil {
+			return err
+		}
+		if err := sc.SetEventParticipants(e.ID, participants); err != nil {
+			return err
+		}
+		return sc.SetEventItems(e.ID, items)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return &ab, nil
+	return s.GetEvent(e.ID)
 }
 
 func (s *Services) UseAbility(abilityID uint, eventID uint, note string) (*models.AbilityUsage, error) {
@@ -390,36 +409,145 @@ type ChapterContext struct {
 	Events  []models.Event
 }
 
+// GetNovelContext gathers a novel's volumes, chapters and events with the
+// worlds, locations and characters registered with it.
 func (s *Services) GetNovelContext(novelID uint) (*NovelContext, error) {
 	var n models.Novel
 	if err := s.DB.First(&n, novelID).Error; err != nil {
 		return nil, err
 	}
 	var vols []models.Volume
-	if err := s.DB.Where("novel_id = ?", novelID).Order("`index` asc").Find(&vols).Error; err != nil {
+	if err := s.DB.Where("novel_id = ?", novelID).Order("`index` asc, id asc").Find(&vols).Error; err != nil {
 		return nil, err
 	}
 	var vctxs []VolumeContext
 	for _, v := range vols {
 		var chs []models.Chapter
-		_ = s.DB.Where("volume_id = ?", v.ID).Order("`index` asc").Find(&chs).Error
+		_ = s.DB.Where("volume_id = ?", v.ID).Order("`index` asc, id asc").Find(&chs).Error
 		var cctxs []ChapterContext
 		for _, c := range chs {
 			var evs []models.Event
-			_ = s.DB.Where("chapter_id = ?", c.ID).Order("id asc").Find(&evs).Error
+			_ = s.withLinks().Where("chapter_id = ?", c.ID).Order(narrative).Find(&evs).Error
 			cctxs = append(cctxs, ChapterContext{Chapter: c, Events: evs})
 		}
 		vctxs = append(vctxs, VolumeContext{Volume: v, Chapters: cctxs})
 	}
+	wscope := s.worldScope(novelID)
+	cscope := s.characterScope(novelID)
 	var worlds []models.World
-	_ = s.DB.Find(&worlds).Error
+	_ = scoped(s.DB, "id", wscope).Find(&worlds).Error
 	var locs []models.Location
-	_ = s.DB.Find(&locs).Error
+	_ = scoped(s.DB, "world_id", wscope).Find(&locs).Error
 	var chars []models.Character
-	_ = s.DB.Find(&chars).Error
+	_ = scoped(s.DB, "id", cscope).Find(&chars).Error
 	return &NovelContext{Novel: n, Volumes: vctxs, Worlds: worlds, Locations: locs, Characters: chars}, nil
 }
 
+// PreviousChapter returns the chapter before chapterID in reading order,
+// by (index, id) as chapters and volumes are listed, crossing back into
+// earlier volumes of the same novel, past empty ones, when needed. It
+// returns nil without an error for the first chapter of a novel.
+func (s *Services) PreviousChapter(chapterID uint) (*models.Chapter, error) {
+	var c models.Chapter
+	if err := s.DB.First(&c, chapterID).Error; err != nil {
+		return nil, err
+	}
+	var prev models.Chapter
+	err := s.DB.Where("volume_id = ? AND (`index` < ? OR (`index` = ? AND id < ?))", c.VolumeID, c.Index, c.Index, c.ID).
+		Order("`index` desc, id desc").Limit(1).Find(&prev).Error
+	if err != nil || prev.ID != 0 {
+		return &prev, err
+	}
+	var v models.Volume
+	if err := s.DB.Limit(1).Find(&v, c.VolumeID).Error; err != nil || v.ID == 0 {
+		return nil, err
+	}
+	var vols []models.Volume
+	err = s.DB.Where("novel_id = ? AND (`index` < ? OR (`index` = ? AND id < ?))", v.NovelID, v.Index, v.Index, v.ID).
+		Order("`index` desc, id desc").Find(&vols).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, pv := range vols {
+		if err := s.DB.Where("volume_id = ?", pv.ID).Order("`index` desc, id desc").Limit(1).Find(&prev).Error; err != nil {
+			return nil, err
+		}
+		if prev.ID != 0 {
+			return &prev, nil
+		}
+	}
+	return nil, nil
+}
+
+// ChapterCharacters returns every character taking part in the chapter's events.
+func (s *Services) ChapterCharacters(chapterID uint) ([]models.Character, error) {
+	evs := s.DB.Model(&models.Event{}).Select("id").Where("chapter_id = ?", chapterID)
+	ids := s.DB.Model(&models.EventParticipant{}).Select("character_id").Where("event_id IN (?)", evs)
+	var chars []models.Character
+	if err := s.DB.Where("id IN (?)", ids).Order("id asc").Find(&chars).Error; err != nil {
+		return nil, err
+	}
+	return chars, nil
+}
+
+type CharacterSheet struct {
+	Character     models.Character
+	Relationships []models.CharacterRelationship
+	Abilities     []models.Ability
+	Items         []models.Item
+	Memories      []models.Memory
+}
+
+func (s *Services) GetCharacterSheet(characterID uint) (*CharacterSheet, error) {
+	var c models.Character
+	if err := s.DB.First(&c, characterID).Error; err != nil {
+		return nil, err
+	}
+	sheet := &CharacterSheet{Character: c}
+	if err := s.DB.Where("a_id = ?", c.ID).Order("id asc").Find(&sheet.Relationships).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("character_id = ?", c.ID).Order("id asc").Find(&sheet.Abilities).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("owner_character_id = ?", c.ID).Order("id asc").Find(&sheet.Items).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("character_id = ?", c.ID).Order("id asc").Find(&sheet.Memories).Error; err != nil {
+		return nil, err
+	}
+	return sheet, nil
+}
+
+type WorldBible struct {
+	World        models.World
+	Periods      []models.Period
+	TimeSegments []models.TimeSegment
+	Locations    []models.Location
+}
+
+func (s *Services) GetWorldBible(worldID uint) (*WorldBible, error) {
+	var w models.World
+	if err := s.DB.First(&w, worldID).Error; err != nil {
+		return nil, err
+	}
+	wb := &WorldBible{World: w}
+	if err := s.DB.Where("world_id = ?", w.ID).Order("`index` asc").Find(&wb.Periods).Error; err != nil {
+		return nil, err
+	}
+	var periodIDs []uint
+	for _, p := range wb.Periods {
+		periodIDs = append(periodIDs, p.ID)
+	}
+	if err := s.DB.Where("period_id IN ?", periodIDs).Order("start asc").Find(&wb.TimeSegments).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("world_id = ?", w.ID).Order("id asc").Find(&wb.Locations).Error; err != nil {
+		return nil, err
+	}
+	return wb, nil
+}
+
 func (s *Services) UpdatePlotStage(plotID uint, stage string) (*models.PlotThread, error) {
 	var pt models.PlotThread
 	if err := s.DB.First(&pt, plotID).Error; err != nil {
@@ -445,32 +573,44 @@ func (s *Services) ExportChapter(chapterID uint) (*models.ExportResult, error) {
 	if err := s.DB.First(&c, chapterID).Error; err != nil {
 		return nil, err
 	}
-	return &models.ExportResult{Content: c.Content}, nil
+	text, err := s.chapterText(c)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ExportResult{Content: text}, nil
 }
 
 func (s *Services) ExportVolume(volumeID uint) (*models.ExportResult, error) {
 	var chs []models.Chapter
-	if err := s.DB.Where("volume_id = ?", volumeID).Order("`index` asc").Find(&chs).Error; err != nil {
+	if err := s.DB.Where("volume_id = ?", volumeID).Order("`index` asc, id asc").Find(&chs).Error; err != nil {
 		return nil, err
 	}
 	var b strings.Builder
 	for _, c := range chs {
+		text, err := s.chapterText(c)
+		if err != nil {
+			return nil, err
+		}
 		b.WriteString(c.Title)
 		b.WriteString("\n")
-		b.WriteString(c.Content)
+		b.WriteString(text)
 		b.WriteString("\n\n")
 	}
 	return &models.ExportResult{Content: b.String()}, nil
 }
 
-func (s *Services) ExportNovel(novelID uint) (*models.ExportResult, error) {
+func (s *Services) ExportNovel(ctx context.Context, novelID uint) (*models.ExportResult, error) {
+	sc := &Services{DB: s.DB.WithContext(ctx)}
 	var vols []models.Volume
-	if err := s.DB.Where("novel_id = ?", novelID).Order("`index` asc").Find(&vols).Error; err != nil {
+	if err := sc.DB.Where("novel_id = ?", novelID).Order("`index` asc, id asc").Find(&vols).Error; err != nil {
 		return nil, err
 	}
 	var b strings.Builder
-	for _, v := range vols {
-		res, err := s.ExportVolume(v.ID)
+	for i, v := range vols {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res, err := sc.ExportVolume(v.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -478,19 +618,20 @@ func (s *Services) ExportNovel(novelID uint) (*models.ExportResult, error) {
 		b.WriteString("\n\n")
 		b.WriteString(res.Content)
 		b.WriteString("\n\n")
+		progress.Report(ctx, float64(i+1), float64(len(vols)), v.Title)
 	}
 	return &models.ExportResult{Content: b.String()}, nil
 }
 
-func joinIDs(ids []uint) string {
-	if len(ids) == 0 {
-		return ""
-	}
-	var parts []string
-	for _, id := range ids {
-		parts = append(parts, strconv.FormatUint(uint64(id), 10))
+func splitIDs(s string) []uint {
+	var out []uint
+	for _, p := range strings.Split(s, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(p), 10, 64)
+		if err == nil {
+			out = append(out, uint(id))
+		}
 	}
-	return strings.Join(parts, ",")
+	return out
 }
 
 func (s *Services) SetStyleRef(novelID uint, content string) (*models.StyleRef, error) {
@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// ItemCustody is who holds how much of an item as of an event, and the
+// transfers that led there in story order.
+type ItemCustody struct {
+	Item      models.Item
+	EventID   uint
+	Total     int
+	Holdings  []Holding
+	Transfers []models.ItemTransfer
+}
+
+// Holding is how much of an item one holder has.
+type Holding struct {
+	custody.Holder
+	Name     string
+	Quantity int
+}
+
+func (c ItemCustody) Text() string {
+	at := "当前"
+	if c.EventID != 0 {
+		at = fmt.Sprintf("事件 %d 时", c.EventID)
+	}
+	out := fmt.Sprintf("物品 %d「%s」%s共 %d 件", c.Item.ID, c.Item.Name, at, c.Total)
+	for _, h := range c.Holdings {
+		out += fmt.Sprintf("；%s「%s」持有 %d", h.Holder, h.Name, h.Quantity)
+	}
+	return out
+}
+
+// holderFields names the arguments a holder is given by: character,
+// location and container item.
+type holderFields [3]string
+
+var (
+	ownerFields = holderFields{"ownerID", "locationID", "containerID"}
+	fromFields  = holderFields{"fromID", "fromLocationID", "fromContainerID"}
+	toFields    = holderFields{"toID", "toLocationID", "toContainerID"}
+)
+
+// field is the argument h is given by.
+func (f holderFields) field(h custody.Holder) string {
+	switch {
+	case h.LocationID != 0:
+		return f[1]
+	case h.ContainerItemID != 0:
+		return f[2]
+	}
+	return f[0]
+}
+
+// checkHolder checks that h names at most one holder and that it exists.
+// A container must not be itemID itself or lie inside it.
+func (s *Services) checkHolder(f holderFields, h custody.Holder, itemID uint) error {
+	n := 0
+	for _, id := range []uint{h.CharacterID, h.LocationID, h.ContainerItemID} {
+		if id != 0 {
+			n++
+		}
+	}
+	if n > 1 {
+		return &tool.FieldError{Field: f[0], Msg: fmt.Sprintf("give only one of %s, %s and %s", f[0], f[1], f[2])}
+	}
+	switch {
+	case h.CharacterID != 0:
+		if err := s.DB.First(&models.Character{}, h.CharacterID).Error; err != nil {
+			return &tool.FieldError{Field: f[0], Msg: fmt.Sprintf("character %d not found", h.CharacterID)}
+		}
+	case h.LocationID != 0:
+		if err := s.DB.First(&models.Location{}, h.LocationID).Error; err != nil {
+			return &tool.FieldError{Field: f[1], Msg: fmt.Sprintf("location %d not found", h.LocationID)}
+		}
+	case h.ContainerItemID != 0:
+		seen := map[uint]bool{}
+		for id := h.ContainerItemID; id != 0 && !seen[id]; {
+			if id == itemID {
+				return &tool.FieldError{Field: f[2], Msg: fmt.Sprintf("item %d would be inside itself", itemID)}
+			}
+			seen[id] = true
+			var c models.Item
+			if err := s.DB.First(&c, id).Error; err != nil {
+				return &tool.FieldError{Field: f[2], Msg: fmt.Sprintf("item %d not found", id)}
+			}
+			id = c.ContainerItemID
+		}
+	}
+	return nil
+}
+
+// itemTransfers loads an item's transfers in the order they are replayed.
+func (s *Services) itemTransfers(o chrono.Order, itemID uint) ([]models.ItemTransfer, error) {
+	var ts []models.ItemTransfer
+	if err := s.DB.Where("item_id = ?", itemID).Order("id asc").Find(&ts).Error; err != nil {
+		return nil, err
+	}
+	custody.Sort(o, ts)
+	return ts, nil
+}
+
+// settle sets an item's holder to the one known holder of all of it after
+// every transfer, or to none when it is split, destroyed or unknown.
+func (s *Services) settle(it *models.Item) error {
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return err
+	}
+	ts, err := s.itemTransfers(o, it.ID)
+	if err != nil {
+		return err
+	}
+	l, _ := custody.Replay(*it, ts)
+	h, _ := l.Sole()
+	it.OwnerCharacterID, it.LocationID, it.ContainerItemID = h.CharacterID, h.LocationID, h.ContainerItemID
+	return s.DB.Model(it).Select("OwnerCharacterID", "LocationID", "ContainerItemID").Updates(it).Error
+}
+
+// CreateItem creates quantity of an item held by holder, recording its
+// creation at eventID, which may be 0.
+func (s *Services) CreateItem(name string, holder custody.Holder, quantity int, status string, eventID uint) (*models.Item, error) {
+	if quantity == 0 {
+		quantity = 1
+	}
+	if quantity < 0 {
+		return nil, &tool.FieldError{Field: "quantity", Msg: "must be positive"}
+	}
+	it := &models.Item{Name: name, OwnerCharacterID: holder.CharacterID, LocationID: holder.LocationID, ContainerItemID: holder.ContainerItemID, Quantity: quantity, Status: status}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		if err := t.checkHolder(ownerFields, holder, 0); err != nil {
+			return err
+		}
+		if err := t.checkEvent(eventID); err != nil {
+			return err
+		}
+		if err := tx.Create(it).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ItemTransfer{
+			ItemID: it.ID, Kind: "create", Quantity: quantity, EventID: eventID,
+			ToCharacterID: holder.CharacterID, ToLocationID: holder.LocationID, ToContainerItemID: holder.ContainerItemID,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return it, nil
+}
+
+// TransferItem records Quantity of an item leaving its source at an event,
+// for its destination or, when destroyed, for good. The source must hold
+// enough as of the event; when none is given it is the item's one holder
+// at that point. A Quantity of 0 moves all the source holds.
+func (s *Services) TransferItem(tr *models.ItemTransfer) (*models.ItemTransfer, error) {
+	if tr.Kind == "" {
+		tr.Kind = "transfer"
+	}
+	if tr.Quantity < 0 {
+		return nil, &tool.FieldError{Field: "quantity", Msg: "must not be negative"}
+	}
+	from, to := custody.From(*tr), custody.To(*tr)
+	if tr.Kind == "transfer" && to == (custody.Holder{}) {
+		return nil, &tool.FieldError{Field: "toID", Msg: "give one of toID, toLocationID and toContainerID"}
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		var it models.Item
+		if err := tx.First(&it, tr.ItemID).Error; err != nil {
+			return &tool.FieldError{Field: "itemID", Msg: fmt.Sprintf("item %d not found", tr.ItemID)}
+		}
+		if err := t.checkHolder(fromFields, from, 0); err != nil {
+			return err
+		}
+		if err := t.checkHolder(toFields, to, it.ID); err != nil {
+			return err
+		}
+		if err := t.checkEvent(tr.EventID); err != nil {
+			return err
+		}
+		o, err := chrono.Load(tx)
+		if err != nil {
+			return err
+		}
+		ts, err := t.itemTransfers(o, it.ID)
+		if err != nil {
+			return err
+		}
+		at := "now"
+		if tr.EventID != 0 {
+			ts = custody.AsOf(o, ts, o.Of(tr.EventID))
+			at = fmt.Sprintf("event %d", tr.EventID)
+		}
+		l, _ := custody.Replay(it, ts)
+		if from == (custody.Holder{}) {
+			if h, ok := l.Sole(); ok {
+				from = h
+			} else if l[custody.Holder{}] == 0 && len(l) > 0 {
+				return &tool.FieldError{Field: "fromID", Msg: fmt.Sprintf("item %d is split between %s as of %s; give the source", it.ID, holders(l), at)}
+			}
+			tr.FromCharacterID, tr.FromLocationID, tr.FromContainerItemID = from.CharacterID, from.LocationID, from.ContainerItemID
+		}
+		if tr.Kind == "transfer" && from == to {
+			return &tool.FieldError{Field: toFields.field(to), Msg: "must differ from the source"}
+		}
+		held := l[from]
+		if tr.Quantity > 0 && from != (custody.Holder{}) {
+			held += l[custody.Holder{}]
+		}
+		if held == 0 || held < tr.Quantity {
+			return &tool.FieldError{Field: fromFields.field(from), Msg: fmt.Sprintf("%s holds %d of item %d as of %s", from, l[from], it.ID, at)}
+		}
+		if err := tx.Create(tr).Error; err != nil {
+			return err
+		}
+		return t.settle(&it)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// holders lists the holders in a ledger.
+func holders(l custody.Ledger) string {
+	out := ""
+	for _, h := range sortedHolders(l) {
+		if out != "" {
+			out += ", "
+		}
+		out += h.String()
+	}
+	return out
+}
+
+// sortedHolders is the holders in a ledger, characters first, then
+// locations, then containers, each by ID; nobody known comes last.
+func sortedHolders(l custody.Ledger) []custody.Holder {
+	var hs []custody.Holder
+	for h := range l {
+		hs = append(hs, h)
+	}
+	rank := func(h custody.Holder) (int, uint) {
+		switch {
+		case h.CharacterID != 0:
+			return 0, h.CharacterID
+		case h.LocationID != 0:
+			return 1, h.LocationID
+		case h.ContainerItemID != 0:
+			return 2, h.ContainerItemID
+		}
+		return 3, 0
+	}
+	slices.SortFunc(hs, func(a, b custody.Holder) int {
+		ka, ia := rank(a)
+		kb, ib := rank(b)
+		if c := cmp.Compare(ka, kb); c != 0 {
+			return c
+		}
+		return cmp.Compare(ia, ib)
+	})
+	return hs
+}
+
+// ItemCustody returns who holds how much of an item as of an event, or
+// after every transfer when eventID is 0.
+func (s *Services) ItemCustody(itemID, eventID uint) (*ItemCustody, error) {
+	c := &ItemCustody{EventID: eventID, Holdings: []Holding{}}
+	if err := s.DB.First(&c.Item, itemID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "itemID", Msg: fmt.Sprintf("item %d not found", itemID)}
+	}
+	if err := s.checkEvent(eventID); err != nil {
+		return nil, err
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	if c.Transfers, err = s.itemTransfers(o, itemID); err != nil {
+		return nil, err
+	}
+	if eventID != 0 {
+		c.Transfers = custody.AsOf(o, c.Transfers, o.Of(eventID))
+	}
+	if c.Transfers == nil {
+		c.Transfers = []models.ItemTransfer{}
+	}
+	l, _ := custody.Replay(c.Item, c.Transfers)
+	c.Total = l.Total()
+	for _, h := range sortedHolders(l) {
+		c.Holdings = append(c.Holdings, Holding{Holder: h, Name: s.holderName(h), Quantity: l[h]})
+	}
+	return c, nil
+}
+
+// holderName is the name of a holder, empty when it has none.
+func (s *Services) holderName(h custody.Holder) string {
+	var names []string
+	switch {
+	case h.CharacterID != 0:
+		s.DB.Model(&models.Character{}).Where("id = ?", h.CharacterID).Pluck("name", &names)
+	case h.LocationID != 0:
+		s.DB.Model(&models.Location{}).Where("id = ?", h.LocationID).Pluck("name", &names)
+	case h.ContainerItemID != 0:
+		s.DB.Model(&models.Item{}).Where("id = ?", h.ContainerItemID).Pluck("name", &names)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return names[0]
+}
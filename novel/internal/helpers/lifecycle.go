@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle is a character's birth time segment, if known, and status
+// changes in story order.
+type Lifecycle struct {
+	Character models.Character
+	Birth     *models.TimeSegment
+	Changes   []models.CharacterStatus
+}
+
+// LifeStatus is a character's life status as of an event: alive, one of
+// models.LifeStatuses, or unborn when the event comes before the start of
+// the character's birth time segment. Change is the status change in
+// effect, nil when there is none.
+type LifeStatus struct {
+	CharacterID uint
+	EventID     uint
+	Status      string
+	Change      *models.CharacterStatus
+}
+
+func (st LifeStatus) Text() string {
+	if st.Change == nil {
+		return fmt.Sprintf("人物 %d 在事件 %d 时：%s", st.CharacterID, st.EventID, st.Status)
+	}
+	return fmt.Sprintf("人物 %d 在事件 %d 时：%s（自事件 %d 起）", st.CharacterID, st.EventID, st.Status, st.Change.EventID)
+}
+
+// SetCharacterStatus records that a character passes into status at an
+// event, replacing any change it already has at that event.
+func (s *Services) SetCharacterStatus(characterID, eventID uint, status, note string) (*models.CharacterStatus, error) {
+	cs := &models.CharacterStatus{CharacterID: characterID, EventID: eventID, Status: status, Note: note}
+	if err := validateModel("characterStatus", cs, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&models.Character{}, characterID).Error; err != nil {
+			return &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+		}
+		if err := tx.First(&models.Event{}, eventID).Error; err != nil {
+			return &tool.FieldError{Field: "eventID", Msg: fmt.Sprintf("event %d not found", eventID)}
+		}
+		var old models.CharacterStatus
+		if err := tx.Where("character_id = ? AND event_id = ?", characterID, eventID).Limit(1).Find(&old).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return tx.Create(cs).Error
+		}
+		cs.ID, cs.CreatedAt = old.ID, old.CreatedAt
+		return tx.Save(cs).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+// statusChanges lists a character's status changes in story order, with
+// their event IDs in the same order.
+func (s *Services) statusChanges(o chrono.Order, characterID uint) ([]models.CharacterStatus, []uint, error) {
+	var rows []models.CharacterStatus
+	if err := s.DB.Where("character_id = ?", characterID).Order("id asc").Find(&rows).Error; err != nil {
+		return nil, nil, err
+	}
+	byEvent := map[uint]models.CharacterStatus{}
+	ids := []uint{}
+	for _, r := range rows {
+		byEvent[r.EventID] = r
+		ids = append(ids, r.EventID)
+	}
+	o.Sort(ids)
+	out := []models.CharacterStatus{}
+	for _, id := range ids {
+		out = append(out, byEvent[id])
+	}
+	return out, ids, nil
+}
+
+// CharacterLifecycle returns a character's birth and status changes.
+func (s *Services) CharacterLifecycle(characterID uint) (*Lifecycle, error) {
+	l := &Lifecycle{}
+	if err := s.DB.First(&l.Character, characterID).Error; err != nil {
+		return nil, err
+	}
+	if l.Character.BirthTimeSegmentID != 0 {
+		var ts models.TimeSegment
+		if err := s.DB.First(&ts, l.Character.BirthTimeSegmentID).Error; err == nil {
+			l.Birth = &ts
+		}
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	l.Changes, _, err = s.statusChanges(o, characterID)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// CharacterStatusAt returns a character's life status as of an event,
+// counting a change at that event itself. Changes that cannot be placed
+// against the event in story order are ignored.
+func (s *Services) CharacterStatusAt(characterID, eventID uint) (*LifeStatus, error) {
+	var c models.Character
+	if err := s.DB.First(&c, characterID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+	}
+	if err := s.DB.First(&models.Event{}, eventID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "eventID", Msg: fmt.Sprintf("event %d not found", eventID)}
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	st := &LifeStatus{CharacterID: characterID, EventID: eventID}
+	st.Status, st.Change, err = s.lifeStatusAt(o, c, o.Of(eventID))
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// lifeStatusAt is a character's life status as of p and the status change
+// in effect, nil when there is none.
+func (s *Services) lifeStatusAt(o chrono.Order, c models.Character, p chrono.Point) (string, *models.CharacterStatus, error) {
+	changes, ids, err := s.statusChanges(o, c.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if i := o.Latest(ids, p); i >= 0 {
+		return changes[i].Status, &changes[i], nil
+	}
+	var ts models.TimeSegment
+	if c.BirthTimeSegmentID != 0 && p.At != nil && s.DB.First(&ts, c.BirthTimeSegmentID).Error == nil && p.At.Before(ts.Start) {
+		return "unborn", nil, nil
+	}
+	return "alive", nil, nil
+}
@@ -0,0 +1,160 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/travel"
+	"mcpnovel/tool"
+
+	"gorm.io/gorm"
+)
+
+// LocationDetail is a location with the locations it lies within,
+// outermost first, those directly within it and its relationships.
+type LocationDetail struct {
+	models.Location
+	Path     []models.Location
+	Children []models.Location
+	Links    []models.LocationRelationship
+}
+
+// Route is the quickest known way from one location to another.
+type Route struct {
+	From     uint
+	To       uint
+	Hours    float64
+	Distance float64
+	Legs     []RouteLeg
+}
+
+// RouteLeg is one relationship of a route, taken from From to To.
+type RouteLeg struct {
+	travel.Leg
+	FromName string
+	ToName   string
+}
+
+func (r Route) Text() string {
+	if len(r.Legs) == 0 {
+		return fmt.Sprintf("地点 %d 到地点 %d：同一地点", r.From, r.To)
+	}
+	path := r.Legs[0].FromName
+	for _, l := range r.Legs {
+		path += fmt.Sprintf(" →(%s %g 小时) %s", l.Type, l.Hours, l.ToName)
+	}
+	return fmt.Sprintf("地点 %d 到地点 %d 最短 %g 小时：%s", r.From, r.To, r.Hours, path)
+}
+
+// UpdateLocation changes the given fields of a location. Moving it to
+// another world takes the locations within it along.
+func (s *Services) UpdateLocation(id uint, fields map[string]any) (*models.Location, error) {
+	var l *models.Location
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		m, err := t.UpdateEntity("location", id, fields)
+		if err != nil {
+			return err
+		}
+		l = m.(*models.Location)
+		if err := t.checkParent(&models.Location{}, "location", id, l.WorldID, l.ParentID); err != nil {
+			return err
+		}
+		return t.moveTree(&models.Location{}, id, l.WorldID)
+	})
+	return l, err
+}
+
+// GetLocation returns a location with its place in the hierarchy and its
+// relationships.
+func (s *Services) GetLocation(id uint) (*LocationDetail, error) {
+	d := &LocationDetail{Path: []models.Location{}, Children: []models.Location{}, Links: []models.LocationRelationship{}}
+	if err := s.DB.First(&d.Location, id).Error; err != nil {
+		return nil, err
+	}
+	for pid := d.ParentID; pid != 0; {
+		var p models.Location
+		if err := s.DB.First(&p, pid).Error; err != nil {
+			break
+		}
+		d.Path = append([]models.Location{p}, d.Path...)
+		pid = p.ParentID
+	}
+	if err := s.DB.Where("parent_id = ?", id).Order("id asc").Find(&d.Children).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("a_id = ? OR b_id = ?", id, id).Order("id asc").Find(&d.Links).Error; err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// SetLocationLink connects two locations, replacing a relationship of the
+// same type between them either way round.
+func (s *Services) SetLocationLink(rel *models.LocationRelationship) (*models.LocationRelationship, error) {
+	if err := validateModel("locationRelationship", rel, []string{"Type"}); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, ref := range []struct {
+			field string
+			id    uint
+		}{{"aid", rel.AID}, {"bid", rel.BID}} {
+			if err := tx.First(&models.Location{}, ref.id).Error; err != nil {
+				return &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("location %d not found", ref.id)}
+			}
+		}
+		var old models.LocationRelationship
+		if err := tx.Where("((a_id = ? AND b_id = ?) OR (a_id = ? AND b_id = ?)) AND type = ?", rel.AID, rel.BID, rel.BID, rel.AID, rel.Type).Limit(1).Find(&old).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return tx.Create(rel).Error
+		}
+		rel.ID, rel.CreatedAt = old.ID, old.CreatedAt
+		return tx.Save(rel).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// FindRoute returns the quickest way from one location to another over
+// relationships with a known travel time. Distance adds up the known
+// distances of its legs.
+func (s *Services) FindRoute(from, to uint) (*Route, error) {
+	for _, ref := range []struct {
+		field string
+		id    uint
+	}{{"fromID", from}, {"toID", to}} {
+		if err := s.DB.First(&models.Location{}, ref.id).Error; err != nil {
+			return nil, &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("location %d not found", ref.id)}
+		}
+	}
+	g, err := travel.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	legs, hours, ok := g.Shortest(from, to)
+	if !ok {
+		return nil, fmt.Errorf("no known route from location %d to %d; link them with travelHours set", from, to)
+	}
+	var ls []models.Location
+	ids := []uint{from}
+	for _, l := range legs {
+		ids = append(ids, l.To)
+	}
+	if err := s.DB.Where("id IN ?", ids).Find(&ls).Error; err != nil {
+		return nil, err
+	}
+	names := map[uint]string{}
+	for _, l := range ls {
+		names[l.ID] = l.Name
+	}
+	r := &Route{From: from, To: to, Hours: hours, Legs: []RouteLeg{}}
+	for _, l := range legs {
+		r.Distance += l.Distance
+		r.Legs = append(r.Legs, RouteLeg{Leg: l, FromName: names[l.From], ToName: names[l.To]})
+	}
+	return r, nil
+}
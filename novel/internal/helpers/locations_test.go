@@ -0,0 +1,134 @@
+package helpers
+
+import (
+	"errors"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"testing"
+)
+
+// routeStory adds 村 (3) and 山 (4) to testStory's 城 (2) and 宫 (1), with
+// roads 城-村 (2h, 40) and 村-山 (3h, 60), a portal 城-山 (10h, distance
+// unknown), a one-way road 山→宫 (1h) and a path 宫-村 with no known
+// travel time.
+func routeStory(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	for _, l := range []*models.Location{{ID: 3, WorldID: 1, Name: "村"}, {ID: 4, WorldID: 1, Name: "山"}} {
+		if err := s.DB.Create(l).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	hours := func(h float64) *float64 { return &h }
+	for _, r := range []models.LocationRelationship{
+		{AID: 2, BID: 3, Type: "road", Distance: 40, TravelHours: hours(2)},
+		{AID: 3, BID: 4, Type: "road", Distance: 60, TravelHours: hours(3)},
+		{AID: 2, BID: 4, Type: "portal", TravelHours: hours(10)},
+		{AID: 4, BID: 1, Type: "road", TravelHours: hours(1), OneWay: true},
+		{AID: 1, BID: 3, Type: "adjacent"},
+	} {
+		if _, err := s.SetLocationLink(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestFindRoute(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to uint
+		hours    float64
+		distance float64
+		text     string
+	}{
+		{"by road", 2, 4, 5, 100, "地点 2 到地点 4 最短 5 小时：城 →(road 2 小时) 村 →(road 3 小时) 山"},
+		{"back by road", 4, 2, 5, 100, "地点 4 到地点 2 最短 5 小时：山 →(road 3 小时) 村 →(road 2 小时) 城"},
+		{"one way", 4, 1, 1, 0, "地点 4 到地点 1 最短 1 小时：山 →(road 1 小时) 宫"},
+		{"same place", 3, 3, 0, 0, "地点 3 到地点 3：同一地点"},
+	}
+	s := routeStory(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.FindRoute(tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Hours != tt.hours || r.Distance != tt.distance || r.Text() != tt.text {
+				t.Errorf("route = %g h, %g, %q; want %g h, %g, %q", r.Hours, r.Distance, r.Text(), tt.hours, tt.distance, tt.text)
+			}
+		})
+	}
+
+	if _, err := s.FindRoute(1, 4); err == nil {
+		t.Error("found a route against a one-way road and over a link with no travel time")
+	}
+	var fe *tool.FieldError
+	if _, err := s.FindRoute(2, 9); !errors.As(err, &fe) || fe.Field != "toID" {
+		t.Errorf("route to a missing location: error = %v; want a FieldError on toID", err)
+	}
+
+	var road models.LocationRelationship
+	if err := s.DB.Where("a_id = 3 AND b_id = 4").First(&road).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := callTool(t, s, "locationHelper", map[string]any{"action": "unlink", "id": float64(road.ID)}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.FindRoute(2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Hours != 10 || r.Distance != 0 || len(r.Legs) != 1 || r.Legs[0].Type != "portal" {
+		t.Errorf("route after unlinking the road = %+v; want the 10 h portal", r)
+	}
+}
+
+func TestSetLocationLink(t *testing.T) {
+	s := routeStory(t)
+	hours := 1.5
+	l, err := s.SetLocationLink(&models.LocationRelationship{AID: 3, BID: 2, Type: "road", Distance: 30, TravelHours: &hours})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roads []models.LocationRelationship
+	if err := s.DB.Where("type = ? AND ((a_id = 2 AND b_id = 3) OR (a_id = 3 AND b_id = 2))", "road").Find(&roads).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(roads) != 1 || roads[0].ID != l.ID || roads[0].Distance != 30 || *roads[0].TravelHours != 1.5 {
+		t.Errorf("roads between 城 and 村 = %+v; want the one road, relinked", roads)
+	}
+	if _, err := s.SetLocationLink(&models.LocationRelationship{AID: 2, BID: 3, Type: "adjacent"}); err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.GetLocation(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Links) != 4 {
+		t.Errorf("村 has %d links; want road and adjacency to 城, road to 山 and path to 宫", len(d.Links))
+	}
+	if d, err = s.GetLocation(1); err != nil || len(d.Path) != 1 || d.Path[0].Name != "城" {
+		t.Errorf("宫 lies within %+v, %v; want 城", d.Path, err)
+	}
+
+	errs := []struct {
+		name  string
+		args  map[string]any
+		field string
+	}{
+		{"missing location", map[string]any{"aid": float64(2), "bid": float64(9), "type": "road"}, "bid"},
+		{"same location", map[string]any{"aid": float64(2), "bid": float64(2), "type": "road"}, "bid"},
+		{"unknown type", map[string]any{"aid": float64(2), "bid": float64(3), "type": "river"}, "type"},
+		{"negative hours", map[string]any{"aid": float64(2), "bid": float64(3), "type": "road", "travelHours": float64(-1)}, "travelHours"},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.args["action"] = "link"
+			var fe *tool.FieldError
+			if _, err := callTool(t, s, "locationHelper", tt.args); !errors.As(err, &fe) || fe.Field != tt.field {
+				t.Errorf("error = %v; want a FieldError on %s", err, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+
+	"gorm.io/gorm"
+)
+
+// NovelMembers is the worlds and characters registered with a novel.
+type NovelMembers struct {
+	NovelID    uint
+	Worlds     []models.World
+	Characters []models.Character
+}
+
+// memberScope selects the IDs (column of model) of the worlds or characters
+// registered with novelID. It is nil when novelID is 0, meaning every one;
+// a novel with none registered selects none.
+func (s *Services) memberScope(model any, column string, novelID uint) *gorm.DB {
+	if novelID == 0 {
+		return nil
+	}
+	return s.DB.Model(model).Select(column).Where("novel_id = ?", novelID)
+}
+
+func (s *Services) worldScope(novelID uint) *gorm.DB {
+	return s.memberScope(&models.NovelWorld{}, "world_id", novelID)
+}
+
+func (s *Services) characterScope(novelID uint) *gorm.DB {
+	return s.memberScope(&models.NovelCharacter{}, "character_id", novelID)
+}
+
+// scoped restricts q to rows whose column is in scope, if scope is set.
+func scoped(q *gorm.DB, column string, scope *gorm.DB) *gorm.DB {
+	if scope == nil {
+		return q
+	}
+	return q.Where(column+" IN (?)", scope)
+}
+
+// chapterNovel is the novel a chapter belongs to, 0 if it has none.
+func (s *Services) chapterNovel(chapterID uint) (uint, error) {
+	var ids []uint
+	err := s.DB.Model(&models.Volume{}).Where("id IN (?)", s.DB.Model(&models.Chapter{}).Select("volume_id").Where("id = ?", chapterID)).Pluck("novel_id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// novelChapters selects the IDs of a novel's chapters.
+func (s *Services) novelChapters(novelID uint) *gorm.DB {
+	return s.DB.Model(&models.Chapter{}).Select("id").Where("volume_id IN (?)", s.DB.Model(&models.Volume{}).Select("id").Where("novel_id = ?", novelID))
+}
+
+// namedWorld is GetWorldByName, failing on field when there is no such
+// world.
+func (s *Services) namedWorld(field string, novelID uint, name string) (*models.World, error) {
+	w, err := s.GetWorldByName(novelID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		msg := fmt.Sprintf("no world is named %q", name)
+		if novelID != 0 {
+			msg += fmt.Sprintf(" in novel %d", novelID)
+		}
+		return nil, &tool.FieldError{Field: field, Msg: msg}
+	}
+	return w, err
+}
+
+// novelLocationByName finds a location by name in the worlds of a novel.
+func (s *Services) novelLocationByName(novelID uint, name string) (*models.Location, error) {
+	scope := s.worldScope(novelID)
+	var l models.Location
+	if err := scoped(s.DB.Where("name = ?", name), "world_id", scope).First(&l).Error; err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// join registers row id with a novel unless it is already.
+func (s *Services) join(m any, column string, novelID, id uint) error {
+	var n int64
+	if err := s.DB.Model(m).Where("novel_id = ? AND "+column+" = ?", novelID, id).Count(&n).Error; err != nil || n > 0 {
+		return err
+	}
+	return s.DB.Create(m).Error
+}
+
+func (s *Services) joinWorld(novelID, worldID uint) error {
+	return s.join(&models.NovelWorld{NovelID: novelID, WorldID: worldID}, "world_id", novelID, worldID)
+}
+
+func (s *Services) joinCharacter(novelID, characterID uint) error {
+	return s.join(&models.NovelCharacter{NovelID: novelID, CharacterID: characterID}, "character_id", novelID, characterID)
+}
+
+func (s *Services) checkNovel(novelID uint) error {
+	if err := s.DB.First(&models.Novel{}, novelID).Error; err != nil {
+		return &tool.FieldError{Field: "novelID", Msg: fmt.Sprintf("novel %d not found", novelID)}
+	}
+	return nil
+}
+
+// AddNovelWorld registers a world with a novel; a world can belong to any
+// number of novels.
+func (s *Services) AddNovelWorld(novelID, worldID uint) (*NovelMembers, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if err := sc.checkNovel(novelID); err != nil {
+			return err
+		}
+		if err := tx.First(&models.World{}, worldID).Error; err != nil {
+			return &tool.FieldError{Field: "worldID", Msg: fmt.Sprintf("world %d not found", worldID)}
+		}
+		return sc.joinWorld(novelID, worldID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetNovelMembers(novelID)
+}
+
+// AddNovelCharacter registers a character with a novel.
+func (s *Services) AddNovelCharacter(novelID, characterID uint) (*NovelMembers, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if err := sc.checkNovel(novelID); err != nil {
+			return err
+		}
+		if err := tx.First(&models.Character{}, characterID).Error; err != nil {
+			return &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+		}
+		return sc.joinCharacter(novelID, characterID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetNovelMembers(novelID)
+}
+
+// leave removes the registration of row id with a novel.
+func (s *Services) leave(entity string, column string, field string, novelID, id uint) (*DeleteReport, error) {
+	m, _ := newModel(entity)
+	var ids []uint
+	if err := s.DB.Model(m).Where("novel_id = ? AND "+column+" = ?", novelID, id).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, &tool.FieldError{Field: field, Msg: fmt.Sprintf("%d is not registered with novel %d", id, novelID)}
+	}
+	return s.DeleteEntity(entity, ids[0], DeleteOptions{})
+}
+
+// RemoveNovelWorld unregisters a world from a novel; the world itself stays.
+func (s *Services) RemoveNovelWorld(novelID, worldID uint) (*DeleteReport, error) {
+	return s.leave("novelWorld", "world_id", "worldID", novelID, worldID)
+}
+
+// RemoveNovelCharacter unregisters a character from a novel; the character
+// itself stays.
+func (s *Services) RemoveNovelCharacter(novelID, characterID uint) (*DeleteReport, error) {
+	return s.leave("novelCharacter", "character_id", "characterID", novelID, characterID)
+}
+
+// GetNovelMembers lists the worlds and characters registered with a novel.
+func (s *Services) GetNovelMembers(novelID uint) (*NovelMembers, error) {
+	if err := s.checkNovel(novelID); err != nil {
+		return nil, err
+	}
+	m := &NovelMembers{NovelID: novelID, Worlds: []models.World{}, Characters: []models.Character{}}
+	worlds := s.DB.Model(&models.NovelWorld{}).Select("world_id").Where("novel_id = ?", novelID)
+	if err := s.DB.Where("id IN (?)", worlds).Order("id asc").Find(&m.Worlds).Error; err != nil {
+		return nil, err
+	}
+	chars := s.DB.Model(&models.NovelCharacter{}).Select("character_id").Where("novel_id = ?", novelID)
+	if err := s.DB.Where("id IN (?)", chars).Order("id asc").Find(&m.Characters).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BackfillNovelMembers registers, for each novel, the worlds and characters
+// its events and scenes already use; with a single novel, every world and
+// character. It runs once, when the membership tables are first created.
+func BackfillNovelMembers(db *gorm.DB) error {
+	var novels []uint
+	if err := db.Model(&models.Novel{}).Order("id asc").Pluck("id", &novels).Error; err != nil || len(novels) == 0 {
+		return err
+	}
+	// The novel of a row with a chapter_id, through chapter and volume.
+	novelOf := func(table string) string {
+		return " JOIN chapters ON chapters.id = " + table + ".chapter_id AND chapters.deleted_at IS NULL" +
+			" JOIN volumes ON volumes.id = chapters.volume_id AND volumes.deleted_at IS NULL" +
+			" WHERE " + table + ".deleted_at IS NULL"
+	}
+	worlds := "SELECT volumes.novel_id AS novel_id, events.world_id AS id FROM events" + novelOf("events") + " AND events.world_id <> 0" +
+		" UNION SELECT volumes.novel_id, locations.world_id FROM events JOIN locations ON locations.id = events.location_id" + novelOf("events") +
+		" UNION SELECT volumes.novel_id, locations.world_id FROM scenes JOIN locations ON locations.id = scenes.location_id" + novelOf("scenes") +
+		" ORDER BY 1, 2"
+	chars := "SELECT volumes.novel_id AS novel_id, event_participants.character_id AS id FROM events" +
+		" JOIN event_participants ON event_participants.event_id = events.id AND event_participants.deleted_at IS NULL" + novelOf("events") +
+		" UNION SELECT volumes.novel_id, scenes.pov_character_id FROM scenes" + novelOf("scenes") + " AND scenes.pov_character_id <> 0" +
+		" ORDER BY 1, 2"
+	if len(novels) == 1 {
+		worlds = fmt.Sprintf("SELECT %d AS novel_id, id FROM worlds WHERE deleted_at IS NULL", novels[0])
+		chars = fmt.Sprintf("SELECT %d AS novel_id, id FROM characters WHERE deleted_at IS NULL", novels[0])
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		for _, q := range []struct {
+			sql  string
+			join func(novelID, id uint) error
+		}{{worlds, sc.joinWorld}, {chars, sc.joinCharacter}} {
+			var rows []struct {
+				NovelID uint
+				ID      uint
+			}
+			if err := tx.Raw(q.sql).Scan(&rows).Error; err != nil {
+				return err
+			}
+			for _, r := range rows {
+				if err := q.join(r.NovelID, r.ID); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,211 @@
+package helpers
+
+import (
+	"errors"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// memberStory adds to testStory a second novel, N2, with nothing
+// registered; in novel 1 only world 1 and 甲 are.
+func memberStory(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	if err := s.DB.Create(&models.Novel{ID: 2, Title: "N2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddNovelWorld(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddNovelCharacter(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// memberNames lists the worlds and characters of a novel as "W; 甲".
+func memberNames(t *testing.T, s *Services, novelID uint) string {
+	t.Helper()
+	m, err := s.GetNovelMembers(novelID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, w := range m.Worlds {
+		names = append(names, w.Name)
+	}
+	for _, c := range m.Characters {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, "; ")
+}
+
+func TestNovelMembers(t *testing.T) {
+	s := memberStory(t)
+	if _, err := s.AddNovelCharacter(1, 1); err != nil {
+		t.Fatalf("adding a member again: %v", err)
+	}
+	var n int64
+	s.DB.Model(&models.NovelCharacter{}).Where("novel_id = 1 AND character_id = 1").Count(&n)
+	if n != 1 {
+		t.Errorf("%d registrations of 甲 after adding twice; want 1", n)
+	}
+	if got := memberNames(t, s, 1); got != "W; 甲" {
+		t.Errorf("novel 1 members = %q; want W; 甲", got)
+	}
+	if got := memberNames(t, s, 2); got != "" {
+		t.Errorf("novel 2 members = %q; want none", got)
+	}
+
+	errs := []struct {
+		name  string
+		call  func() error
+		field string
+	}{
+		{"world of a missing novel", func() error { _, err := s.AddNovelWorld(9, 1); return err }, "novelID"},
+		{"missing world", func() error { _, err := s.AddNovelWorld(1, 9); return err }, "worldID"},
+		{"missing character", func() error { _, err := s.AddNovelCharacter(1, 9); return err }, "characterID"},
+		{"removing a non-member", func() error { _, err := s.RemoveNovelCharacter(2, 1); return err }, "characterID"},
+		{"members of a missing novel", func() error { _, err := s.GetNovelMembers(9); return err }, "novelID"},
+	}
+	for _, tt := range errs {
+		t.Run(tt.name, func(t *testing.T) {
+			var fe *tool.FieldError
+			if err := tt.call(); !errors.As(err, &fe) || fe.Field != tt.field {
+				t.Errorf("error = %v; want a FieldError on %s", err, tt.field)
+			}
+		})
+	}
+
+	if _, err := s.RemoveNovelCharacter(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := memberNames(t, s, 1); got != "W" {
+		t.Errorf("members after removing 甲 = %q; want W", got)
+	}
+	if err := s.DB.First(&models.Character{}, 1).Error; err != nil {
+		t.Errorf("removing 甲 from the novel deleted the character: %v", err)
+	}
+}
+
+func TestNovelScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		entity  string
+		novelID uint
+		want    int
+	}{
+		{"every world", "world", 0, 1},
+		{"worlds of novel 1", "world", 1, 1},
+		{"worlds of novel 2", "world", 2, 0},
+		{"every character", "character", 0, 2},
+		{"characters of novel 1", "character", 1, 1},
+		{"characters of novel 2", "character", 2, 0},
+		{"locations of novel 1", "location", 1, 2},
+		{"locations of novel 2", "location", 2, 0},
+	}
+	s := memberStory(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := s.List(tt.entity, 0, tt.novelID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reflect.ValueOf(v).Len(); got != tt.want {
+				t.Errorf("%d listed; want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.FindByName("character", "乙", 0, 1, false); err == nil {
+		t.Error("found 乙, who is not registered, in novel 1")
+	}
+	if _, err := s.FindByName("character", "乙", 0, 0, false); err != nil {
+		t.Errorf("finding 乙 without a novel: %v", err)
+	}
+	if _, err := s.FindByName("location", "宫", 0, 2, false); err == nil {
+		t.Error("found 宫 in novel 2, which has no worlds")
+	}
+
+	ctx, err := s.GetNovelContext(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ctx.Worlds) != 1 || len(ctx.Locations) != 2 || len(ctx.Characters) != 1 || ctx.Characters[0].Name != "甲" {
+		t.Errorf("novel 1 context has %d worlds, %d locations and characters %v; want 1, 2 and 甲", len(ctx.Worlds), len(ctx.Locations), ctx.Characters)
+	}
+	if ctx, err = s.GetNovelContext(2); err != nil || len(ctx.Worlds)+len(ctx.Locations)+len(ctx.Characters) != 0 {
+		t.Errorf("novel 2 context = %+v, %v; want no members", ctx, err)
+	}
+}
+
+func TestEnsureRegisters(t *testing.T) {
+	s := memberStory(t)
+	c, err := s.EnsureCharacter(1, "甲", "", false)
+	if err != nil || c.ID != 1 {
+		t.Fatalf("EnsureCharacter in novel 1 = %+v, %v; want 甲 (1)", c, err)
+	}
+	c, err = s.EnsureCharacter(2, "甲", "", false)
+	if err != nil || c.ID == 1 {
+		t.Fatalf("EnsureCharacter in novel 2 = %+v, %v; want a new 甲", c, err)
+	}
+	w, err := s.EnsureWorld(2, "W", "")
+	if err != nil || w.ID == 1 {
+		t.Fatalf("EnsureWorld in novel 2 = %+v, %v; want a new W", w, err)
+	}
+	if got := memberNames(t, s, 2); got != "W; 甲" {
+		t.Errorf("novel 2 members = %q; want the new W and 甲", got)
+	}
+	if got := memberNames(t, s, 1); got != "W; 甲" {
+		t.Errorf("novel 1 members = %q; want them unchanged", got)
+	}
+	if _, err := s.CreateCharacter("丙", "", 0, 9); err == nil {
+		t.Error("created a character in a missing novel")
+	}
+}
+
+func TestBackfillNovelMembers(t *testing.T) {
+	t.Run("single novel", func(t *testing.T) {
+		s := testStory(t)
+		if err := BackfillNovelMembers(s.DB); err != nil {
+			t.Fatal(err)
+		}
+		if got := memberNames(t, s, 1); got != "W; 甲; 乙" {
+			t.Errorf("members = %q; want every world and character", got)
+		}
+	})
+	t.Run("several novels", func(t *testing.T) {
+		s := testStory(t)
+		for _, r := range []any{
+			&models.Novel{ID: 2, Title: "N2"}, &models.Volume{ID: 2, NovelID: 2}, &models.Chapter{ID: 2, VolumeID: 2},
+			&models.World{ID: 2, Name: "W2"}, &models.Location{ID: 3, WorldID: 2, Name: "村"},
+			&models.Character{ID: 3, Name: "丙"}, &models.Event{ID: 4, ChapterID: 2, Seq: 1, LocationID: 3},
+			&models.Scene{ChapterID: 2, POVCharacterID: 2},
+		} {
+			if err := s.DB.Create(r).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.DB.Model(&models.Event{}).Where("id = 1").Update("world_id", 1).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetEventParticipants(1, []models.EventParticipant{{CharacterID: 1, Role: "protagonist"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.SetEventParticipants(4, []models.EventParticipant{{CharacterID: 3, Role: "protagonist"}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := BackfillNovelMembers(s.DB); err != nil {
+			t.Fatal(err)
+		}
+		if got := memberNames(t, s, 1); got != "W; 甲" {
+			t.Errorf("novel 1 members = %q; want W; 甲", got)
+		}
+		if got := memberNames(t, s, 2); got != "W2; 乙; 丙" {
+			t.Errorf("novel 2 members = %q; want W2; 乙; 丙", got)
+		}
+	})
+}
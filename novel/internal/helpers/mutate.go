@@ -0,0 +1,877 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ModelKinds lists every model that sqlHelper can create, update and delete.
+var ModelKinds = []string{
+	"novel", "volume", "chapter", "event", "world", "period", "timeSegment", "location",
+	"character", "characterRelationship", "locationRelationship", "item", "itemTransfer",
+	"ability", "abilityUsage", "abilityUpgrade", "plotThread", "memory", "styleRef", "eventParticipant", "eventItem",
+	"scene", "characterAlias", "characterStatus", "novelWorld", "novelCharacter",
+	"organization", "organizationMembership", "organizationRelationship",
+	"characterRelationshipChange", "relationshipType",
+}
+
+func newModel(entity string) (any, error) {
+	switch entity {
+	case "novel":
+		return &models.Novel{}, nil
+	case "volume":
+		return &models.Volume{}, nil
+	case "chapter":
+		return &models.Chapter{}, nil
+	case "event":
+		return &models.Event{}, nil
+	case "world":
+		return &models.World{}, nil
+	case "period":
+		return &models.Period{}, nil
+	case "timeSegment":
+		return &models.TimeSegment{}, nil
+	case "location":
+		return &models.Location{}, nil
+	case "character":
+		return &models.Character{}, nil
+	case "characterRelationship":
+		return &models.CharacterRelationship{}, nil
+	case "characterRelationshipChange":
+		return &models.CharacterRelationshipChange{}, nil
+	case "relationshipType":
+		return &models.RelationshipType{}, nil
+	case "locationRelationship":
+		return &models.LocationRelationship{}, nil
+	case "item":
+		return &models.Item{}, nil
+	case "itemTransfer":
+		return &models.ItemTransfer{}, nil
+	case "ability":
+		return &models.Ability{}, nil
+	case "abilityUsage":
+		return &models.AbilityUsage{}, nil
+	case "abilityUpgrade":
+		return &models.AbilityUpgrade{}, nil
+	case "plotThread":
+		return &models.PlotThread{}, nil
+	case "memory":
+		return &models.Memory{}, nil
+	case "styleRef":
+		return &models.StyleRef{}, nil
+	case "eventParticipant":
+		return &models.EventParticipant{}, nil
+	case "eventItem":
+		return &models.EventItem{}, nil
+	case "scene":
+		return &models.Scene{}, nil
+	case "characterAlias":
+		return &models.CharacterAlias{}, nil
+	case "characterStatus":
+		return &models.CharacterStatus{}, nil
+	case "novelWorld":
+		return &models.NovelWorld{}, nil
+	case "novelCharacter":
+		return &models.NovelCharacter{}, nil
+	case "organization":
+		return &models.Organization{}, nil
+	case "organizationMembership":
+		return &models.OrganizationMembership{}, nil
+	case "organizationRelationship":
+		return &models.OrganizationRelationship{}, nil
+	}
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// requiredRefs are the references a new row of each kind cannot do without.
+var requiredRefs = map[string][]string{
+	"volume":                      {"NovelID"},
+	"chapter":                     {"VolumeID"},
+	"event":                       {"ChapterID"},
+	"period":                      {"WorldID"},
+	"timeSegment":                 {"PeriodID"},
+	"location":                    {"WorldID"},
+	"characterRelationship":       {"AID", "BID"},
+	"characterRelationshipChange": {"RelationshipID"},
+	"locationRelationship":        {"AID", "BID"},
+	"itemTransfer":                {"ItemID"},
+	"ability":                     {"CharacterID"},
+	"abilityUsage":                {"AbilityID"},
+	"abilityUpgrade":              {"AbilityID"},
+	"plotThread":                  {"NovelID"},
+	"memory":                      {"CharacterID"},
+	"styleRef":                    {"NovelID"},
+	"eventParticipant":            {"EventID", "CharacterID"},
+	"eventItem":                   {"EventID", "ItemID"},
+	"scene":                       {"ChapterID"},
+	"characterAlias":              {"CharacterID"},
+	"characterStatus":             {"CharacterID", "EventID"},
+	"novelWorld":                  {"NovelID", "WorldID"},
+	"novelCharacter":              {"NovelID", "CharacterID"},
+	"organization":                {"WorldID"},
+	"organizationMembership":      {"OrganizationID", "CharacterID"},
+	"organizationRelationship":    {"AID", "BID"},
+}
+
+// applyFields sets fields, keyed case-insensitively by model field name, on
+// the model m points to and returns the canonical names it changed.
+func applyFields(m any, fields map[string]any) ([]string, error) {
+	rv := reflect.ValueOf(m).Elem()
+	rt := rv.Type()
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var changed []string
+	for _, k := range keys {
+		sf, ok := rt.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, k) })
+		// Associations such as Event.Participants have their own entities.
+		if !ok || sf.Name == "ID" || sf.Name == "CreatedAt" || sf.Name == "UpdatedAt" || sf.Name == "DeletedAt" || sf.Type.Kind() == reflect.Slice {
+			return nil, &tool.FieldError{Field: "fields." + k, Msg: "unknown field"}
+		}
+		b, err := json.Marshal(fields[k])
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.New(sf.Type)
+		if err := json.Unmarshal(b, v.Interface()); err != nil {
+			return nil, &tool.FieldError{Field: "fields." + k, Msg: fmt.Sprintf("expected %s", sf.Type)}
+		}
+		rv.FieldByIndex(sf.Index).Set(v.Elem())
+		changed = append(changed, sf.Name)
+	}
+	return changed, nil
+}
+
+// validateModel rejects values that would leave m inconsistent.
+func validateModel(entity string, m any, changed []string) error {
+	switch t := m.(type) {
+	case *models.Chapter:
+		if slices.Contains(changed, "Status") && t.Status != "" && !slices.Contains(models.ChapterStatuses, t.Status) {
+			return &tool.FieldError{Field: "status", Msg: fmt.Sprintf("must be one of %s", strings.Join(models.ChapterStatuses, ", "))}
+		}
+	case *models.PlotThread:
+		if slices.Contains(changed, "Stage") && t.Stage != "" && !slices.Contains(models.PlotStages, t.Stage) {
+			return &tool.FieldError{Field: "stage", Msg: fmt.Sprintf("must be one of %s", strings.Join(models.PlotStages, ", "))}
+		}
+	case *models.TimeSegment:
+		if t.End.Before(t.Start) {
+			return &tool.FieldError{Field: "end", Msg: "must not be before start"}
+		}
+	case *models.CharacterRelationship:
+		if t.AID == t.BID {
+			return &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+		}
+		if t.Intimacy < 0 || t.Intimacy > 1 {
+			return &tool.FieldError{Field: "intimacy", Msg: "must be between 0 and 1"}
+		}
+	case *models.CharacterRelationshipChange:
+		if t.Intimacy < 0 || t.Intimacy > 1 {
+			return &tool.FieldError{Field: "intimacy", Msg: "must be between 0 and 1"}
+		}
+	case *models.RelationshipType:
+		if strings.TrimSpace(t.Name) == "" {
+			return &tool.FieldError{Field: "name", Msg: "must not be empty"}
+		}
+	case *models.LocationRelationship:
+		if t.AID == t.BID {
+			return &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+		}
+		if slices.Contains(changed, "Type") && !slices.Contains(models.LocationLinkTypes, t.Type) {
+			return &tool.FieldError{Field: "type", Msg: fmt.Sprintf("must be one of %s", strings.Join(models.LocationLinkTypes, ", "))}
+		}
+		if t.Distance < 0 {
+			return &tool.FieldError{Field: "distance", Msg: "must not be negative"}
+		}
+		if t.TravelHours != nil && *t.TravelHours < 0 {
+			return &tool.FieldError{Field: "travelHours", Msg: "must not be negative"}
+		}
+	case *models.Location:
+		if t.ParentID != 0 && t.ParentID == t.ID {
+			return &tool.FieldError{Field: "parentID", Msg: "must not be the location itself"}
+		}
+	case *models.OrganizationRelationship:
+		if t.AID == t.BID {
+			return &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+		}
+	case *models.Organization:
+		if t.ParentID != 0 && t.ParentID == t.ID {
+			return &tool.FieldError{Field: "parentID", Msg: "must not be the organization itself"}
+		}
+	case *models.OrganizationMembership:
+		if t.JoinEventID != 0 && t.JoinEventID == t.LeaveEventID {
+			return &tool.FieldError{Field: "leaveEventID", Msg: "must differ from joinEventID"}
+		}
+	case *models.Item:
+		if slices.Contains(changed, "Quantity") && t.Quantity < 1 {
+			return &tool.FieldError{Field: "quantity", Msg: "must be positive"}
+		}
+		if t.ContainerItemID != 0 && t.ContainerItemID == t.ID {
+			return &tool.FieldError{Field: "containerItemID", Msg: "must not be the item itself"}
+		}
+	case *models.ItemTransfer:
+		if slices.Contains(changed, "Kind") && t.Kind != "" && !slices.Contains(models.ItemTransferKinds, t.Kind) {
+			return &tool.FieldError{Field: "kind", Msg: fmt.Sprintf("must be one of %s", strings.Join(models.ItemTransferKinds, ", "))}
+		}
+		if t.Quantity < 0 {
+			return &tool.FieldError{Field: "quantity", Msg: "must not be negative"}
+		}
+	case *models.CharacterAlias:
+		if strings.TrimSpace(t.Name) == "" {
+			return &tool.FieldError{Field: "name", Msg: "must not be empty"}
+		}
+	case *models.CharacterStatus:
+		if !slices.Contains(models.LifeStatuses, t.Status) {
+			return &tool.FieldError{Field: "status", Msg: fmt.Sprintf("must be one of %s", strings.Join(models.LifeStatuses, ", "))}
+		}
+	case *models.EventParticipant:
+		if err := checkRole("fields.role", &t.Role); err != nil {
+			return err
+		}
+	case *models.EventItem:
+		if err := checkRole("fields.role", &t.Role); err != nil {
+			return err
+		}
+	case *models.Scene:
+		if (t.StartParagraph == 0) != (t.EndParagraph == 0) || t.StartParagraph < 0 || t.EndParagraph < t.StartParagraph {
+			return &tool.FieldError{Field: "endParagraph", Msg: "startParagraph and endParagraph must both be 0, or 1 <= startParagraph <= endParagraph"}
+		}
+	}
+	rv := reflect.ValueOf(m).Elem()
+	for _, name := range requiredRefs[entity] {
+		if rv.FieldByName(name).Uint() == 0 {
+			return &tool.FieldError{Field: "fields." + name, Msg: fmt.Sprintf("required for entity %s", entity)}
+		}
+	}
+	return nil
+}
+
+// CreateEntity inserts a row of any model kind from fields keyed by model
+// field name.
+func (s *Services) CreateEntity(entity string, fields map[string]any) (any, error) {
+	m, err := newModel(entity)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := applyFields(m, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateModel(entity, m, changed); err != nil {
+		return nil, err
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		if c, ok := m.(*models.Chapter); ok && c.Content != "" {
+			_, err := (&Services{DB: tx}).recordRevision(c.ID, "", c.Content, "")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UpdateEntity changes only the given fields of one row and returns the
+// updated row.
+func (s *Services) UpdateEntity(entity string, id uint, fields map[string]any) (any, error) {
+	return s.updateEntity(entity, id, fields, "")
+}
+
+// updateEntity is UpdateEntity, recording a new chapter content as a
+// revision with message.
+func (s *Services) updateEntity(entity string, id uint, fields map[string]any, message string) (any, error) {
+	m, err := newModel(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.First(m, id).Error; err != nil {
+		return nil, err
+	}
+	old := ""
+	if c, ok := m.(*models.Chapter); ok {
+		old = c.Content
+	}
+	changed, err := applyFields(m, fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(changed) == 0 {
+		return m, nil
+	}
+	if err := validateModel(entity, m, changed); err != nil {
+		return nil, err
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(m).Error; err != nil {
+			return err
+		}
+		if c, ok := m.(*models.Chapter); ok && slices.Contains(changed, "Content") {
+			sc := &Services{DB: tx}
+			if _, err := sc.recordRevision(c.ID, old, c.Content, message); err != nil {
+				return err
+			}
+			return sc.moveSpans(c.ID, old, c.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// keptBy names, for kinds whose rows must agree with rows of other kinds,
+// the helper action that writes them. sqlHelper updates none of them and
+// creates them only through that action's service (see SQLCreate).
+var keptBy = map[string]string{
+	"eventParticipant":            "eventHelper update with participants",
+	"eventItem":                   "eventHelper update with items",
+	"itemTransfer":                "itemHelper transfer or destroy",
+	"abilityUpgrade":              "characterAbilityHelper upgrade",
+	"characterRelationship":       "characterRelationshipHelper set",
+	"characterRelationshipChange": "characterRelationshipHelper set",
+	"characterStatus":             "characterHelper setStatus",
+	"novelWorld":                  "novelHelper addWorld",
+	"novelCharacter":              "novelHelper addCharacter",
+}
+
+// keptFields are the fields sqlHelper does not update, by kind, and the
+// helper action that changes them.
+var keptFields = map[string]map[string]string{
+	"item": {
+		"OwnerCharacterID": "itemHelper transfer",
+		"LocationID":       "itemHelper transfer",
+		"ContainerItemID":  "itemHelper transfer",
+		"Quantity":         "itemHelper transfer or destroy",
+	},
+	"event":   {"Seq": "eventHelper move"},
+	"chapter": {"VolumeID": "chapterHelper move", "Index": "chapterHelper move or reorder"},
+	"volume":  {"NovelID": "volumeHelper move", "Index": "volumeHelper move or reorder"},
+	"ability": {"Level": "characterAbilityHelper upgrade"},
+}
+
+// SQLCreate is sqlHelper's create. Kinds with a service of their own are
+// created through it, so they get the same checks and bookkeeping as from
+// their helper; the rest through CreateEntity.
+func (s *Services) SQLCreate(entity string, fields map[string]any) (any, error) {
+	m, err := newModel(entity)
+	if err != nil {
+		return nil, err
+	}
+	changed, err := applyFields(m, fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateModel(entity, m, changed); err != nil {
+		return nil, err
+	}
+	switch t := m.(type) {
+	case *models.Event:
+		if slices.Contains(changed, "Seq") {
+			return nil, &tool.FieldError{Field: "fields.Seq", Msg: "set by position; use eventHelper move"}
+		}
+		return s.CreateEvent(t.ChapterID, t.SceneID, t.WorldID, t.LocationID, t.TimeSegmentID, t.StoryTime, t.Description, nil, nil, Placement{})
+	case *models.Location:
+		return s.CreateLocation(t.WorldID, t.ParentID, t.Name, t.Description)
+	case *models.Scene:
+		return s.CreateScene(t, 0)
+	case *models.Organization:
+		return s.CreateOrganization(t)
+	case *models.OrganizationMembership:
+		return s.AddMembership(t)
+	case *models.OrganizationRelationship:
+		return s.SetOrganizationRelationship(t.AID, t.BID, t.Type, t.Exclusive)
+	case *models.LocationRelationship:
+		return s.SetLocationLink(t)
+	case *models.CharacterAlias:
+		return s.AddCharacterAlias(t.CharacterID, t.Name, t.Kind)
+	case *models.CharacterStatus:
+		return s.SetCharacterStatus(t.CharacterID, t.EventID, t.Status, t.Note)
+	case *models.CharacterRelationship:
+		return s.SetCharacterRelationship(t.AID, t.BID, t.Type, t.Intimacy, 0, "")
+	case *models.RelationshipType:
+		return s.SetRelationshipType(t.Name, t.Symmetric, t.Description)
+	case *models.Item:
+		return s.CreateItem(t.Name, custody.Holder{CharacterID: t.OwnerCharacterID, LocationID: t.LocationID, ContainerItemID: t.ContainerItemID}, t.Quantity, t.Status, 0)
+	case *models.ItemTransfer:
+		if t.Kind == "create" {
+			return nil, &tool.FieldError{Field: "fields.Kind", Msg: "items come into being through itemHelper create"}
+		}
+		return s.TransferItem(t)
+	case *models.Ability:
+		return s.CreateAbility(t.CharacterID, t.Name, t.Level, t.EventID)
+	case *models.StyleRef:
+		return s.SetStyleRef(t.NovelID, t.Content)
+	}
+	if via, ok := keptBy[entity]; ok {
+		return nil, &tool.FieldError{Field: "entity", Msg: fmt.Sprintf("%s is written by %s", entity, via)}
+	}
+	return s.CreateEntity(entity, fields)
+}
+
+// SQLUpdate is sqlHelper's update. Kinds with an update service of their
+// own are updated through it; kinds and fields other helpers keep
+// consistent are refused.
+func (s *Services) SQLUpdate(entity string, id uint, fields map[string]any) (any, error) {
+	if via, ok := keptBy[entity]; ok {
+		return nil, &tool.FieldError{Field: "entity", Msg: fmt.Sprintf("%s is written by %s", entity, via)}
+	}
+	m, err := newModel(entity)
+	if err != nil {
+		return nil, err
+	}
+	rt := reflect.TypeOf(m).Elem()
+	for k := range fields {
+		if sf, ok := rt.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, k) }); ok {
+			if via, kept := keptFields[entity][sf.Name]; kept {
+				return nil, &tool.FieldError{Field: "fields." + k, Msg: fmt.Sprintf("changed by %s", via)}
+			}
+		}
+	}
+	switch entity {
+	case "event":
+		return s.UpdateEvent(id, fields, nil, nil)
+	case "location":
+		return s.UpdateLocation(id, fields)
+	case "scene":
+		return s.UpdateScene(id, fields)
+	case "organization":
+		return s.UpdateOrganization(id, fields)
+	case "organizationMembership":
+		return s.UpdateMembership(id, fields)
+	}
+	return s.UpdateEntity(entity, id, fields)
+}
+
+// DeleteOptions choose what happens to dependents that can outlive the
+// deleted entity.
+type DeleteOptions struct {
+	// Events is "delete" (default) or "move" for the events of a deleted
+	// chapter; "move" re-homes them to MoveEventsTo.
+	Events       string
+	MoveEventsTo uint
+	// Items is "release" (default) or "delete" for the items owned by a
+	// deleted character; released items keep their transfer history.
+	Items string
+}
+
+// DeleteReport lists, by entity kind, the rows a delete moved to the trash
+// (including the entity itself), the rows whose reference to a removed row
+// was cleared, and the rows moved elsewhere. TrashID restores or purges them.
+type DeleteReport struct {
+	Entity   string
+	ID       uint
+	TrashID  uint
+	Deleted  map[string][]uint
+	Detached map[string][]uint
+	Moved    map[string][]uint
+}
+
+// change is a reference a delete rewrote, kept so restore can undo it.
+type change struct {
+	Kind   string
+	ID     uint
+	Column string
+	From   any
+	To     any
+	Moved  bool `json:",omitempty"`
+}
+
+// DeleteEntity soft-deletes one row and cascades to its dependents in a
+// single transaction, recording everything in a trash entry:
+//
+//   - novel: volumes (and their chapters), plot threads, style reference
+//   - volume: chapters
+//   - chapter: events, or moves them to opts.MoveEventsTo
+//   - event: participants, item links, statuses, relationship changes,
+//     memories, item transfers, abilities gained and their usages and
+//     upgrades, and organization memberships joined there; clears it as
+//     the event where a membership ends
+//   - world: periods (and time segments), locations, organizations; clears
+//     events' world
+//   - period: time segments
+//   - timeSegment: clears events' time segment
+//   - location: the locations within it, location relationships; clears
+//     events', items' and item transfers' location
+//   - character: relationships both ways, abilities (and usages), memories,
+//     organization memberships; releases or deletes owned items; clears it
+//     as the giver or receiver of item transfers; its event participations
+//   - characterRelationship: its changes; also the reverse relationship
+//     when its type is symmetric
+//   - organization: sub-organizations, memberships, relationships
+//   - item: transfers, event item links; clears it as the container of
+//     items and item transfers
+//   - ability: usages and upgrades
+//
+// Items, relationships and abilities that lose transfers, changes or
+// upgrades are brought up to the ones that remain.
+func (s *Services) DeleteEntity(entity string, id uint, opts DeleteOptions) (*DeleteReport, error) {
+	m, err := newModel(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.First(m, id).Error; err != nil {
+		return nil, err
+	}
+	switch opts.Events {
+	case "", "delete":
+	case "move":
+		if entity != "chapter" {
+			return nil, &tool.FieldError{Field: "events", Msg: "move only applies to chapters"}
+		}
+		if opts.MoveEventsTo == 0 || opts.MoveEventsTo == id {
+			return nil, &tool.FieldError{Field: "moveEventsTo", Msg: "must name another chapter when events is move"}
+		}
+		if err := s.DB.First(&models.Chapter{}, opts.MoveEventsTo).Error; err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &tool.FieldError{Field: "events", Msg: "must be one of delete, move"}
+	}
+	if opts.Items != "" && opts.Items != "release" && opts.Items != "delete" {
+		return nil, &tool.FieldError{Field: "items", Msg: "must be one of release, delete"}
+	}
+	r := &DeleteReport{Entity: entity, ID: id, Deleted: map[string][]uint{}, Detached: map[string][]uint{}, Moved: map[string][]uint{}}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		d := &deleter{tx: tx, r: r, opts: opts}
+		if err := d.delete(entity, []uint{id}); err != nil {
+			return err
+		}
+		if err := (&Services{DB: tx}).resettle(r.Deleted, r.Detached); err != nil {
+			return err
+		}
+		deleted, _ := json.Marshal(r.Deleted)
+		changes, _ := json.Marshal(d.changes)
+		te := &models.TrashEntry{Entity: entity, EntityID: id, Label: label(m), Deleted: string(deleted), Changes: string(changes)}
+		if err := tx.Create(te).Error; err != nil {
+			return err
+		}
+		r.TrashID = te.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// resettle brings the rows kept in line with others up to date after some
+// of those others were deleted, detached or restored: the holders of
+// items with such transfers, relationships with such changes, and the
+// level of abilities with such upgrades. Rows in the trash are skipped.
+func (s *Services) resettle(rows ...map[string][]uint) error {
+	parents := func(kind, column string) ([]uint, error) {
+		var ids []uint
+		for _, r := range rows {
+			ids = append(ids, r[kind]...)
+		}
+		if len(ids) == 0 {
+			return nil, nil
+		}
+		m, _ := newModel(kind)
+		var out []uint
+		err := s.DB.Unscoped().Model(m).Where("id IN ?", ids).Distinct().Order(column+" asc").Pluck(column, &out).Error
+		return out, err
+	}
+	itemIDs, err := parents("itemTransfer", "item_id")
+	if err != nil {
+		return err
+	}
+	var items []models.Item
+	if err := s.DB.Where("id IN ?", itemIDs).Find(&items).Error; err != nil {
+		return err
+	}
+	for i := range items {
+		if err := s.settle(&items[i]); err != nil {
+			return err
+		}
+	}
+	relIDs, err := parents("characterRelationshipChange", "relationship_id")
+	if err != nil {
+		return err
+	}
+	abilityIDs, err := parents("abilityUpgrade", "ability_id")
+	if err != nil {
+		return err
+	}
+	if len(relIDs) == 0 && len(abilityIDs) == 0 {
+		return nil
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return err
+	}
+	var rels []models.CharacterRelationship
+	if err := s.DB.Where("id IN ?", relIDs).Find(&rels).Error; err != nil {
+		return err
+	}
+	for i := range rels {
+		if err := s.refreshRelationship(o, &rels[i]); err != nil {
+			return err
+		}
+	}
+	var abs []models.Ability
+	if err := s.DB.Where("id IN ?", abilityIDs).Find(&abs).Error; err != nil {
+		return err
+	}
+	ups, err := s.abilityUpgrades(o, abilityIDs)
+	if err != nil {
+		return err
+	}
+	for _, ab := range abs {
+		// With every upgrade gone the ability is back where the first
+		// one found it.
+		if len(ups[ab.ID]) == 0 {
+			var first models.AbilityUpgrade
+			if err := s.DB.Unscoped().Where("ability_id = ?", ab.ID).Order("id asc").Limit(1).Find(&first).Error; err != nil {
+				return err
+			}
+			ab.Level = first.From
+		} else {
+			ab.Level = levelAt(o, ab, ups[ab.ID], nil)
+		}
+		if err := s.DB.Model(&ab).UpdateColumn("level", ab.Level).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type deleter struct {
+	tx      *gorm.DB
+	r       *DeleteReport
+	opts    DeleteOptions
+	changes []change
+}
+
+// ids selects the IDs of model rows matching query.
+func (d *deleter) ids(model any, query string, args ...any) ([]uint, error) {
+	var ids []uint
+	err := d.tx.Model(model).Where(query, args...).Order("id asc").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// children deletes the rows of kind whose column references one of ids.
+func (d *deleter) children(kind string, column string, ids []uint) error {
+	m, _ := newModel(kind)
+	cids, err := d.ids(m, column+" IN ?", ids)
+	if err != nil || len(cids) == 0 {
+		return err
+	}
+	return d.delete(kind, cids)
+}
+
+// detach clears column on the rows of kind that reference one of ids.
+func (d *deleter) detach(kind string, column string, ids []uint) error {
+	cids, err := d.rewrite(kind, column, ids, 0, false)
+	if len(cids) > 0 {
+		d.r.Detached[kind] = append(d.r.Detached[kind], cids...)
+	}
+	return err
+}
+
+// rewrite points column of the rows of kind that reference one of ids at
+// to, recording each old value for restore.
+func (d *deleter) rewrite(kind string, column string, ids []uint, to uint, moved bool) ([]uint, error) {
+	m, _ := newModel(kind)
+	var rows []struct {
+		ID   uint
+		Prev uint
+	}
+	if err := d.tx.Model(m).Select("id, "+column+" AS prev").Where(column+" IN ?", ids).Order("id asc").Scan(&rows).Error; err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	var cids []uint
+	for _, row := range rows {
+		cids = append(cids, row.ID)
+		d.changes = append(d.changes, change{Kind: kind, ID: row.ID, Column: column, From: row.Prev, To: to, Moved: moved})
+	}
+	if err := d.tx.Model(m).Where("id IN ?", cids).Update(column, to).Error; err != nil {
+		return nil, err
+	}
+	return cids, nil
+}
+
+func (d *deleter) delete(kind string, ids []uint) error {
+	var err error
+	switch kind {
+	case "novel":
+		err = d.all(
+			func() error { return d.children("volume", "novel_id", ids) },
+			func() error { return d.children("plotThread", "novel_id", ids) },
+			func() error { return d.children("styleRef", "novel_id", ids) },
+			func() error { return d.children("novelWorld", "novel_id", ids) },
+			func() error { return d.children("novelCharacter", "novel_id", ids) },
+		)
+	case "volume":
+		err = d.children("chapter", "volume_id", ids)
+	case "chapter":
+		if d.opts.Events == "move" {
+			// Moved events are told after the target chapter's own.
+			var last int
+			if err = d.tx.Model(&models.Event{}).Where("chapter_id = ?", d.opts.MoveEventsTo).Select("COALESCE(MAX(seq), 0)").Scan(&last).Error; err != nil {
+				break
+			}
+			var evs []models.Event
+			if err = d.tx.Where("chapter_id IN ?", ids).Order("id asc").Find(&evs).Error; err != nil {
+				break
+			}
+			for _, e := range evs {
+				d.changes = append(d.changes, change{Kind: "event", ID: e.ID, Column: "seq", From: e.Seq, To: e.Seq + last, Moved: true})
+			}
+			if err = d.tx.Model(&models.Event{}).Where("chapter_id IN ?", ids).UpdateColumn("seq", gorm.Expr("seq + ?", last)).Error; err != nil {
+				break
+			}
+			var evIDs []uint
+			evIDs, err = d.rewrite("event", "chapter_id", ids, d.opts.MoveEventsTo, true)
+			d.r.Moved["event"] = append(d.r.Moved["event"], evIDs...)
+		} else {
+			err = d.children("event", "chapter_id", ids)
+		}
+		if err == nil {
+			err = d.children("scene", "chapter_id", ids)
+		}
+	case "scene":
+		err = d.detach("event", "scene_id", ids)
+	case "event":
+		err = d.all(
+			func() error { return d.children("eventParticipant", "event_id", ids) },
+			func() error { return d.children("eventItem", "event_id", ids) },
+			func() error { return d.children("characterStatus", "event_id", ids) },
+			func() error { return d.children("characterRelationshipChange", "event_id", ids) },
+			func() error { return d.children("memory", "event_id", ids) },
+			func() error { return d.children("itemTransfer", "event_id", ids) },
+			func() error { return d.children("abilityUsage", "event_id", ids) },
+			func() error { return d.children("abilityUpgrade", "event_id", ids) },
+			func() error { return d.children("ability", "event_id", ids) },
+			func() error { return d.children("organizationMembership", "join_event_id", ids) },
+			func() error { return d.detach("organizationMembership", "leave_event_id", ids) },
+		)
+	case "world":
+		err = d.all(
+			func() error { return d.children("period", "world_id", ids) },
+			func() error { return d.children("location", "world_id", ids) },
+			func() error { return d.children("organization", "world_id", ids) },
+			func() error { return d.children("novelWorld", "world_id", ids) },
+			func() error { return d.detach("event", "world_id", ids) },
+		)
+	case "period":
+		err = d.children("timeSegment", "period_id", ids)
+	case "timeSegment":
+		err = d.all(
+			func() error { return d.detach("event", "time_segment_id", ids) },
+			func() error { return d.detach("scene", "time_segment_id", ids) },
+			func() error { return d.detach("character", "birth_time_segment_id", ids) },
+		)
+	case "location":
+		err = d.all(
+			func() error { return d.children("location", "parent_id", ids) },
+			func() error { return d.children("locationRelationship", "a_id", ids) },
+			func() error { return d.children("locationRelationship", "b_id", ids) },
+			func() error { return d.detach("event", "location_id", ids) },
+			func() error { return d.detach("scene", "location_id", ids) },
+			func() error { return d.detach("item", "location_id", ids) },
+			func() error { return d.detach("itemTransfer", "from_location_id", ids) },
+			func() error { return d.detach("itemTransfer", "to_location_id", ids) },
+		)
+	case "character":
+		items := func() error { return d.detach("item", "owner_character_id", ids) }
+		if d.opts.Items == "delete" {
+			items = func() error { return d.children("item", "owner_character_id", ids) }
+		}
+		err = d.all(
+			func() error { return d.children("characterAlias", "character_id", ids) },
+			func() error { return d.children("characterStatus", "character_id", ids) },
+			func() error { return d.children("novelCharacter", "character_id", ids) },
+			func() error { return d.children("organizationMembership", "character_id", ids) },
+			func() error { return d.children("characterRelationship", "a_id", ids) },
+			func() error { return d.children("characterRelationship", "b_id", ids) },
+			func() error { return d.children("ability", "character_id", ids) },
+			func() error { return d.children("memory", "character_id", ids) },
+			items,
+			func() error { return d.detach("itemTransfer", "from_character_id", ids) },
+			func() error { return d.detach("itemTransfer", "to_character_id", ids) },
+			func() error { return d.children("eventParticipant", "character_id", ids) },
+			func() error { return d.detach("scene", "pov_character_id", ids) },
+		)
+	case "characterRelationship":
+		var rels []models.CharacterRelationship
+		if err = d.tx.Where("id IN ?", ids).Find(&rels).Error; err == nil {
+			for _, rel := range rels {
+				var sym bool
+				if sym, err = (&Services{DB: d.tx}).symmetric(rel.Type); err != nil {
+					break
+				}
+				if !sym {
+					continue
+				}
+				var rev []uint
+				if rev, err = d.ids(&models.CharacterRelationship{}, "a_id = ? AND b_id = ? AND id NOT IN ?", rel.BID, rel.AID, ids); err != nil {
+					break
+				}
+				ids = append(ids, rev...)
+			}
+		}
+		if err == nil {
+			err = d.children("characterRelationshipChange", "relationship_id", ids)
+		}
+	case "organization":
+		err = d.all(
+			func() error { return d.children("organization", "parent_id", ids) },
+			func() error { return d.children("organizationMembership", "organization_id", ids) },
+			func() error { return d.children("organizationRelationship", "a_id", ids) },
+			func() error { return d.children("organizationRelationship", "b_id", ids) },
+		)
+	case "item":
+		err = d.all(
+			func() error { return d.children("itemTransfer", "item_id", ids) },
+			func() error { return d.children("eventItem", "item_id", ids) },
+			func() error { return d.detach("item", "container_item_id", ids) },
+			func() error { return d.detach("itemTransfer", "from_container_item_id", ids) },
+			func() error { return d.detach("itemTransfer", "to_container_item_id", ids) },
+		)
+	case "ability":
+		err = d.all(
+			func() error { return d.children("abilityUsage", "ability_id", ids) },
+			func() error { return d.children("abilityUpgrade", "ability_id", ids) },
+		)
+	}
+	if err != nil {
+		return err
+	}
+	m, _ := newModel(kind)
+	// Rows already removed by an earlier branch of the cascade are skipped.
+	live, err := d.ids(m, "id IN ?", ids)
+	if err != nil || len(live) == 0 {
+		return err
+	}
+	if err := d.tx.Where("id IN ?", live).Delete(m).Error; err != nil {
+		return err
+	}
+	d.r.Deleted[kind] = append(d.r.Deleted[kind], live...)
+	return nil
+}
+
+func (d *deleter) all(steps ...func() error) error {
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
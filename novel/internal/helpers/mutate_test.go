@@ -0,0 +1,286 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"mcpnovel/tool"
+	"strings"
+	"testing"
+)
+
+// testStory opens a database with a chapter of three events, locations 1
+// within 2, and characters 1 and 2.
+func testStory(t *testing.T) *Services {
+	t.Helper()
+	db, err := storage.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Novel{}, &models.Volume{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Scene{},
+		&models.World{}, &models.Period{}, &models.TimeSegment{}, &models.Location{}, &models.LocationRelationship{},
+		&models.Character{}, &models.CharacterAlias{}, &models.CharacterStatus{}, &models.CharacterRelationship{},
+		&models.CharacterRelationshipChange{}, &models.RelationshipType{}, &models.NovelWorld{}, &models.NovelCharacter{},
+		&models.Organization{}, &models.OrganizationMembership{}, &models.OrganizationRelationship{},
+		&models.Item{}, &models.ItemTransfer{}, &models.Ability{}, &models.AbilityUsage{}, &models.AbilityUpgrade{},
+		&models.PlotThread{}, &models.Event{}, &models.Memory{}, &models.StyleRef{}, &models.TrashEntry{},
+		&models.EventParticipant{}, &models.EventItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []any{
+		&models.Novel{ID: 1, Title: "N"}, &models.Volume{ID: 1, NovelID: 1}, &models.Chapter{ID: 1, VolumeID: 1},
+		&models.World{ID: 1, Name: "W"}, &models.Location{ID: 2, WorldID: 1, Name: "城"}, &models.Location{ID: 1, WorldID: 1, ParentID: 2, Name: "宫"},
+		&models.Character{ID: 1, Name: "甲"}, &models.Character{ID: 2, Name: "乙"},
+		&models.Event{ID: 1, ChapterID: 1, Seq: 1}, &models.Event{ID: 2, ChapterID: 1, Seq: 2}, &models.Event{ID: 3, ChapterID: 1, Seq: 3},
+	} {
+		if err := db.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Services{DB: db}
+}
+
+func TestSQLWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(s *Services) (any, error)
+		field string
+	}{
+		{"location cycle", func(s *Services) (any, error) {
+			return s.SQLUpdate("location", 2, map[string]any{"parentID": float64(1)})
+		}, "parentID"},
+		{"item holder", func(s *Services) (any, error) {
+			return s.SQLUpdate("item", 1, map[string]any{"ownerCharacterID": float64(2)})
+		}, "fields.ownerCharacterID"},
+		{"event seq", func(s *Services) (any, error) {
+			return s.SQLUpdate("event", 1, map[string]any{"Seq": float64(9)})
+		}, "fields.Seq"},
+		{"event seq on create", func(s *Services) (any, error) {
+			return s.SQLCreate("event", map[string]any{"ChapterID": float64(1), "Seq": float64(1)})
+		}, "fields.Seq"},
+		{"kept kind", func(s *Services) (any, error) {
+			return s.SQLCreate("eventParticipant", map[string]any{"EventID": float64(1), "CharacterID": float64(1)})
+		}, "entity"},
+		{"item creation", func(s *Services) (any, error) {
+			return s.SQLCreate("itemTransfer", map[string]any{"ItemID": float64(1), "Kind": "create"})
+		}, "fields.Kind"},
+		{"ability of no one", func(s *Services) (any, error) {
+			return s.SQLCreate("ability", map[string]any{"CharacterID": float64(9), "Name": "剑法"})
+		}, "characterID"},
+		{"ability level", func(s *Services) (any, error) {
+			ab, err := s.CreateAbility(1, "剑法", 1, 0)
+			if err != nil {
+				return nil, err
+			}
+			return s.SQLUpdate("ability", ab.ID, map[string]any{"level": float64(3)})
+		}, "fields.level"},
+		{"plain update", func(s *Services) (any, error) {
+			return s.SQLUpdate("item", 1, map[string]any{"name": "宝剑"})
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testStory(t)
+			if _, err := s.CreateItem("剑", custody.Holder{CharacterID: 1}, 1, "", 0); err != nil {
+				t.Fatal(err)
+			}
+			_, err := tt.write(s)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if fe, ok := err.(*tool.FieldError); !ok || fe.Field != tt.field {
+				t.Errorf("write = %v; want an error on %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestSQLCreateEventPlaces(t *testing.T) {
+	s := testStory(t)
+	v, err := s.SQLCreate("event", map[string]any{"ChapterID": float64(1), "Description": "e4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := v.(*models.Event); e.Seq != 4 {
+		t.Errorf("created event at seq %d; want 4", e.Seq)
+	}
+}
+
+func TestDeleteEventCascades(t *testing.T) {
+	s := testStory(t)
+	it, err := s.CreateItem("剑", custody.Holder{CharacterID: 1}, 1, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TransferItem(&models.ItemTransfer{ItemID: it.ID, FromCharacterID: 1, ToCharacterID: 2, EventID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	ab, err := s.CreateAbility(1, "剑法", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpgradeAbility(ab.ID, 3, 3); err != nil {
+		t.Fatal(err)
+	}
+	gained, err := s.CreateAbility(2, "轻功", 1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := func() (uint, int) {
+		t.Helper()
+		var i models.Item
+		var a models.Ability
+		if err := s.DB.First(&i, it.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DB.First(&a, ab.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return i.OwnerCharacterID, a.Level
+	}
+	if owner, level := current(); owner != 2 || level != 3 {
+		t.Fatalf("before delete: held by %d at level %d", owner, level)
+	}
+
+	r, err := s.DeleteEntity("event", 3, DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{"itemTransfer", "abilityUpgrade", "ability"} {
+		if len(r.Deleted[kind]) != 1 {
+			t.Errorf("deleted %s = %v; want one", kind, r.Deleted[kind])
+		}
+	}
+	if len(r.Detached) != 0 {
+		t.Errorf("detached = %v; want none", r.Detached)
+	}
+	if err := s.DB.First(&models.Ability{}, gained.ID).Error; err == nil {
+		t.Error("ability gained at the deleted event survived")
+	}
+	if owner, level := current(); owner != 1 || level != 1 {
+		t.Errorf("after delete: held by %d at level %d; want 1 at 1", owner, level)
+	}
+
+	if _, err := s.RestoreTrash(r.TrashID); err != nil {
+		t.Fatal(err)
+	}
+	if owner, level := current(); owner != 2 || level != 3 {
+		t.Errorf("after restore: held by %d at level %d; want 2 at 3", owner, level)
+	}
+}
+
+func TestDeleteCharacterClearsTransfers(t *testing.T) {
+	s := testStory(t)
+	it, err := s.CreateItem("剑", custody.Holder{CharacterID: 1}, 1, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := s.TransferItem(&models.ItemTransfer{ItemID: it.ID, FromCharacterID: 1, ToCharacterID: 2, EventID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.DeleteEntity("character", 2, DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got models.ItemTransfer
+	if err := s.DB.First(&got, tr.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.FromCharacterID != 1 || got.ToCharacterID != 0 {
+		t.Errorf("transfer from %d to %d; want from 1 to 0", got.FromCharacterID, got.ToCharacterID)
+	}
+	if _, err := s.RestoreTrash(r.TrashID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.First(&got, tr.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.ToCharacterID != 2 {
+		t.Errorf("restored transfer to %d; want 2", got.ToCharacterID)
+	}
+}
+
+func TestDeleteEventDetachesLeave(t *testing.T) {
+	s := testStory(t)
+	o, err := s.CreateOrganization(&models.Organization{WorldID: 1, Name: "门"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.AddMembership(&models.OrganizationMembership{OrganizationID: o.ID, CharacterID: 1, JoinEventID: 1, LeaveEventID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.DeleteEntity("event", 3, DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Deleted["organizationMembership"]) != 0 || len(r.Detached["organizationMembership"]) != 1 {
+		t.Errorf("deleted %v, detached %v; want the membership detached", r.Deleted, r.Detached)
+	}
+	var got models.OrganizationMembership
+	if err := s.DB.First(&got, m.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.LeaveEventID != 0 {
+		t.Errorf("leave event = %d; want 0", got.LeaveEventID)
+	}
+	if _, err := s.RestoreTrash(r.TrashID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.First(&got, m.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got.LeaveEventID != 3 {
+		t.Errorf("restored leave event = %d; want 3", got.LeaveEventID)
+	}
+}
+
+func TestDeleteChapterMovesEvents(t *testing.T) {
+	s := testStory(t)
+	for _, r := range []any{
+		&models.Chapter{ID: 2, VolumeID: 1, Index: 1},
+		&models.Event{ID: 4, ChapterID: 2, Seq: 1}, &models.Event{ID: 5, ChapterID: 2, Seq: 2},
+	} {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	order := func() string {
+		t.Helper()
+		var es []models.Event
+		if err := s.DB.Order("chapter_id asc, seq asc").Find(&es).Error; err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, e := range es {
+			out = append(out, fmt.Sprintf("%d:%d@%d", e.ID, e.ChapterID, e.Seq))
+		}
+		return strings.Join(out, " ")
+	}
+	r, err := s.DeleteEntity("chapter", 1, DeleteOptions{Events: "move", MoveEventsTo: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(r.Moved["event"]), "[1 2 3]"; got != want {
+		t.Errorf("moved events = %s; want %s", got, want)
+	}
+	if got, want := order(), "4:2@1 5:2@2 1:2@3 2:2@4 3:2@5"; got != want {
+		t.Errorf("after delete: %s; want %s", got, want)
+	}
+	it, err := s.RestoreTrash(r.TrashID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(it.Moved["event"]), "[1 2 3]"; got != want {
+		t.Errorf("restored moved events = %s; want %s", got, want)
+	}
+	if got, want := order(), "1:1@1 2:1@2 3:1@3 4:2@1 5:2@2"; got != want {
+		t.Errorf("after restore: %s; want %s", got, want)
+	}
+}
@@ -0,0 +1,341 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// OrganizationDetail is an organization with the organizations above it,
+// outermost first, those directly under it and its relationships.
+type OrganizationDetail struct {
+	models.Organization
+	Path          []models.Organization
+	Children      []models.Organization
+	Relationships []models.OrganizationRelationship
+}
+
+// Member is a membership with the names of its character and organization.
+type Member struct {
+	models.OrganizationMembership
+	Character    string
+	Organization string
+}
+
+// checkParent rejects a parent that is missing, in another world, or the
+// row itself or one under it, for the organization or location (kind) id
+// of model, 0 while it is being created.
+func (s *Services) checkParent(model any, kind string, id, worldID, parentID uint) error {
+	if err := s.DB.First(&models.World{}, worldID).Error; err != nil {
+		return &tool.FieldError{Field: "worldID", Msg: fmt.Sprintf("world %d not found", worldID)}
+	}
+	for pid := parentID; pid != 0; {
+		var p struct {
+			ID       uint
+			WorldID  uint
+			ParentID uint
+		}
+		if err := s.DB.Model(model).Select("id, world_id, parent_id").Where("id = ?", pid).Limit(1).Scan(&p).Error; err != nil {
+			return err
+		}
+		if p.ID == 0 {
+			return &tool.FieldError{Field: "parentID", Msg: fmt.Sprintf("%s %d not found", kind, pid)}
+		}
+		if p.WorldID != worldID {
+			return &tool.FieldError{Field: "parentID", Msg: fmt.Sprintf("%s %d is in world %d, not %d", kind, p.ID, p.WorldID, worldID)}
+		}
+		if p.ID == id {
+			return &tool.FieldError{Field: "parentID", Msg: fmt.Sprintf("%s %d is under %s %d already", kind, parentID, kind, id)}
+		}
+		pid = p.ParentID
+	}
+	return nil
+}
+
+// subTree is id and the IDs of every organization or location of model
+// under it.
+func (s *Services) subTree(model any, id uint) ([]uint, error) {
+	out := []uint{id}
+	for next := []uint{id}; len(next) > 0; {
+		var ids []uint
+		if err := s.DB.Model(model).Where("parent_id IN ?", next).Order("id asc").Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		out = append(out, ids...)
+		next = ids
+	}
+	return out, nil
+}
+
+// moveTree puts the rows of model under id in the world of id.
+func (s *Services) moveTree(model any, id, worldID uint) error {
+	sub, err := s.subTree(model, id)
+	if err != nil {
+		return err
+	}
+	return s.DB.Model(model).Where("id IN ?", sub).UpdateColumn("world_id", worldID).Error
+}
+
+// CreateOrganization adds an organization to a world, under its parent if
+// it has one.
+func (s *Services) CreateOrganization(o *models.Organization) (*models.Organization, error) {
+	if err := validateModel("organization", o, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := (&Services{DB: tx}).checkParent(&models.Organization{}, "organization", 0, o.WorldID, o.ParentID); err != nil {
+			return err
+		}
+		return tx.Create(o).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// UpdateOrganization changes the given fields of an organization. Moving
+// it to another world takes the organizations under it along.
+func (s *Services) UpdateOrganization(id uint, fields map[string]any) (*models.Organization, error) {
+	var o *models.Organization
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		m, err := t.UpdateEntity("organization", id, fields)
+		if err != nil {
+			return err
+		}
+		o = m.(*models.Organization)
+		if err := t.checkParent(&models.Organization{}, "organization", id, o.WorldID, o.ParentID); err != nil {
+			return err
+		}
+		return t.moveTree(&models.Organization{}, id, o.WorldID)
+	})
+	return o, err
+}
+
+// GetOrganization returns an organization with its place in the hierarchy
+// and its relationships.
+func (s *Services) GetOrganization(id uint) (*OrganizationDetail, error) {
+	d := &OrganizationDetail{Path: []models.Organization{}, Children: []models.Organization{}, Relationships: []models.OrganizationRelationship{}}
+	if err := s.DB.First(&d.Organization, id).Error; err != nil {
+		return nil, err
+	}
+	for pid := d.ParentID; pid != 0; {
+		var p models.Organization
+		if err := s.DB.First(&p, pid).Error; err != nil {
+			break
+		}
+		d.Path = append([]models.Organization{p}, d.Path...)
+		pid = p.ParentID
+	}
+	if err := s.DB.Where("parent_id = ?", id).Order("id asc").Find(&d.Children).Error; err != nil {
+		return nil, err
+	}
+	if err := s.DB.Where("a_id = ? OR b_id = ?", id, id).Order("id asc").Find(&d.Relationships).Error; err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// checkMembership rejects a membership whose organization, character or
+// events are missing, or that is left before it is joined in story order.
+func (s *Services) checkMembership(m *models.OrganizationMembership) error {
+	if err := s.DB.First(&models.Organization{}, m.OrganizationID).Error; err != nil {
+		return &tool.FieldError{Field: "organizationID", Msg: fmt.Sprintf("organization %d not found", m.OrganizationID)}
+	}
+	if err := s.DB.First(&models.Character{}, m.CharacterID).Error; err != nil {
+		return &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", m.CharacterID)}
+	}
+	for _, ref := range []struct {
+		field string
+		id    uint
+	}{{"joinEventID", m.JoinEventID}, {"leaveEventID", m.LeaveEventID}} {
+		if ref.id == 0 {
+			continue
+		}
+		if err := s.DB.First(&models.Event{}, ref.id).Error; err != nil {
+			return &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("event %d not found", ref.id)}
+		}
+	}
+	if m.JoinEventID == 0 || m.LeaveEventID == 0 {
+		return nil
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return err
+	}
+	if chrono.Before(o.Of(m.LeaveEventID), o.Of(m.JoinEventID)) {
+		return &tool.FieldError{Field: "leaveEventID", Msg: fmt.Sprintf("event %d comes before join event %d", m.LeaveEventID, m.JoinEventID)}
+	}
+	return nil
+}
+
+// AddMembership records that a character belongs to an organization.
+func (s *Services) AddMembership(m *models.OrganizationMembership) (*models.OrganizationMembership, error) {
+	if err := validateModel("organizationMembership", m, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := (&Services{DB: tx}).checkMembership(m); err != nil {
+			return err
+		}
+		return tx.Create(m).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// UpdateMembership changes the given fields of a membership, such as the
+// event where the character leaves.
+func (s *Services) UpdateMembership(id uint, fields map[string]any) (*models.OrganizationMembership, error) {
+	var m *models.OrganizationMembership
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		v, err := t.UpdateEntity("organizationMembership", id, fields)
+		if err != nil {
+			return err
+		}
+		m = v.(*models.OrganizationMembership)
+		return t.checkMembership(m)
+	})
+	return m, err
+}
+
+// SetOrganizationRelationship records how two organizations stand toward
+// each other, replacing what was recorded for the pair either way round.
+func (s *Services) SetOrganizationRelationship(aid, bid uint, rtype string, exclusive bool) (*models.OrganizationRelationship, error) {
+	rel := &models.OrganizationRelationship{AID: aid, BID: bid, Type: rtype, Exclusive: exclusive}
+	if err := validateModel("organizationRelationship", rel, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, ref := range []struct {
+			field string
+			id    uint
+		}{{"aid", aid}, {"bid", bid}} {
+			if err := tx.First(&models.Organization{}, ref.id).Error; err != nil {
+				return &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("organization %d not found", ref.id)}
+			}
+		}
+		var old models.OrganizationRelationship
+		if err := tx.Where("(a_id = ? AND b_id = ?) OR (a_id = ? AND b_id = ?)", aid, bid, bid, aid).Limit(1).Find(&old).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return tx.Create(rel).Error
+		}
+		rel.ID, rel.CreatedAt = old.ID, old.CreatedAt
+		return tx.Save(rel).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// activeAt reports whether a membership is in effect as of p: joined at or
+// before it and not left by then. A join or leave that cannot be placed
+// against p in story order counts as not having happened yet.
+func activeAt(o chrono.Order, m models.OrganizationMembership, p chrono.Point) bool {
+	if m.JoinEventID != 0 && !chrono.NotAfter(o.Of(m.JoinEventID), p) {
+		return false
+	}
+	return m.LeaveEventID == 0 || !chrono.NotAfter(o.Of(m.LeaveEventID), p)
+}
+
+// members lists the memberships q selects, those in effect as of eventID
+// unless it is 0, ordered by when they were joined.
+func (s *Services) members(q *gorm.DB, eventID uint) ([]Member, error) {
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	if eventID == 0 {
+		return s.membersAt(q, o, nil)
+	}
+	p := o.Of(eventID)
+	return s.membersAt(q, o, &p)
+}
+
+// membersAt lists the memberships q selects, those in effect as of p
+// unless it is nil, ordered by when they were joined.
+func (s *Services) membersAt(q *gorm.DB, o chrono.Order, p *chrono.Point) ([]Member, error) {
+	var ms []models.OrganizationMembership
+	if err := q.Order("id asc").Find(&ms).Error; err != nil {
+		return nil, err
+	}
+	// Memberships from before the story come first.
+	slices.SortStableFunc(ms, func(a, b models.OrganizationMembership) int {
+		if a.JoinEventID == 0 || b.JoinEventID == 0 {
+			return cmp.Compare(min(a.JoinEventID, 1), min(b.JoinEventID, 1))
+		}
+		return chrono.Cmp(o.Of(a.JoinEventID), o.Of(b.JoinEventID))
+	})
+	out := []Member{}
+	for _, m := range ms {
+		if p != nil && !activeAt(o, m, *p) {
+			continue
+		}
+		mb := Member{OrganizationMembership: m}
+		var c models.Character
+		if s.DB.First(&c, m.CharacterID).Error == nil {
+			mb.Character = c.Name
+		}
+		var org models.Organization
+		if s.DB.First(&org, m.OrganizationID).Error == nil {
+			mb.Organization = org.Name
+		}
+		out = append(out, mb)
+	}
+	return out, nil
+}
+
+// OrganizationMembers lists the members of an organization as of an event,
+// or every membership it has had when eventID is 0. withSub counts members
+// of the organizations under it too.
+func (s *Services) OrganizationMembers(organizationID, eventID uint, withSub bool) ([]Member, error) {
+	if err := s.DB.First(&models.Organization{}, organizationID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "organizationID", Msg: fmt.Sprintf("organization %d not found", organizationID)}
+	}
+	if err := s.checkEvent(eventID); err != nil {
+		return nil, err
+	}
+	ids := []uint{organizationID}
+	if withSub {
+		var err error
+		if ids, err = s.subTree(&models.Organization{}, organizationID); err != nil {
+			return nil, err
+		}
+	}
+	return s.members(s.DB.Where("organization_id IN ?", ids), eventID)
+}
+
+// CharacterMemberships lists the organizations a character belongs to as
+// of an event, or every membership they have had when eventID is 0.
+func (s *Services) CharacterMemberships(characterID, eventID uint) ([]Member, error) {
+	if err := s.DB.First(&models.Character{}, characterID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+	}
+	if err := s.checkEvent(eventID); err != nil {
+		return nil, err
+	}
+	return s.members(s.DB.Where("character_id = ?", characterID), eventID)
+}
+
+// checkEvent rejects an eventID, unless it is 0, that names no event.
+func (s *Services) checkEvent(eventID uint) error {
+	if eventID == 0 {
+		return nil
+	}
+	if err := s.DB.First(&models.Event{}, eventID).Error; err != nil {
+		return &tool.FieldError{Field: "eventID", Msg: fmt.Sprintf("event %d not found", eventID)}
+	}
+	return nil
+}
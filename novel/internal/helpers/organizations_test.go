@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+	"testing"
+)
+
+// testOrganizations adds world 2 to testStory, and organizations 门
+// (1) with 堂 (2) under it and 院 (3) under that in world 1, and 宗 (4)
+// in world 2.
+func testOrganizations(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	for _, r := range []any{
+		&models.World{ID: 2, Name: "W2"},
+		&models.Organization{ID: 1, WorldID: 1, Name: "门"}, &models.Organization{ID: 2, WorldID: 1, ParentID: 1, Name: "堂"},
+		&models.Organization{ID: 3, WorldID: 1, ParentID: 2, Name: "院"}, &models.Organization{ID: 4, WorldID: 2, Name: "宗"},
+	} {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestOrganizationParent(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(s *Services) error
+		field string
+		msg   string
+	}{
+		{"create under a sub-organization", func(s *Services) error {
+			_, err := s.CreateOrganization(&models.Organization{WorldID: 1, ParentID: 3, Name: "舍"})
+			return err
+		}, "", ""},
+		{"create under a missing parent", func(s *Services) error {
+			_, err := s.CreateOrganization(&models.Organization{WorldID: 1, ParentID: 9, Name: "舍"})
+			return err
+		}, "parentID", "organization 9 not found"},
+		{"create under another world", func(s *Services) error {
+			_, err := s.CreateOrganization(&models.Organization{WorldID: 1, ParentID: 4, Name: "舍"})
+			return err
+		}, "parentID", "organization 4 is in world 2, not 1"},
+		{"create in a missing world", func(s *Services) error {
+			_, err := s.CreateOrganization(&models.Organization{WorldID: 9, Name: "舍"})
+			return err
+		}, "worldID", "world 9 not found"},
+		{"under itself", func(s *Services) error {
+			_, err := s.UpdateOrganization(1, map[string]any{"parentID": float64(1)})
+			return err
+		}, "parentID", "must not be the organization itself"},
+		{"under its grandchild", func(s *Services) error {
+			_, err := s.UpdateOrganization(1, map[string]any{"parentID": float64(3)})
+			return err
+		}, "parentID", "organization 3 is under organization 1 already"},
+		{"up a level", func(s *Services) error {
+			_, err := s.UpdateOrganization(3, map[string]any{"parentID": float64(1)})
+			return err
+		}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testOrganizations(t)
+			err := tt.write(s)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if fe, ok := err.(*tool.FieldError); !ok || fe.Field != tt.field || fe.Msg != tt.msg {
+				t.Errorf("write = %v; want %s: %s", err, tt.field, tt.msg)
+			}
+			var o models.Organization
+			if err := s.DB.First(&o, 1).Error; err != nil || o.ParentID != 0 {
+				t.Errorf("organization 1 has parent %d after a rejected write", o.ParentID)
+			}
+		})
+	}
+}
+
+// memberList puts members as character@organization, in order.
+func memberList(ms []Member) string {
+	var out []string
+	for _, m := range ms {
+		out = append(out, m.Character+"@"+m.Organization)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestOrganizationMembers(t *testing.T) {
+	s := testOrganizations(t)
+	// 甲 belongs to 堂 from before the story and to 门 from event 1 until
+	// event 3; 乙 joins 院 at event 2.
+	for _, m := range []models.OrganizationMembership{
+		{OrganizationID: 1, CharacterID: 1, JoinEventID: 1, LeaveEventID: 3},
+		{OrganizationID: 3, CharacterID: 2, JoinEventID: 2},
+		{OrganizationID: 2, CharacterID: 1},
+	} {
+		if _, err := s.AddMembership(&m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		organization, event uint
+		withSub             bool
+		want                string
+	}{
+		{1, 1, false, "甲@门"},
+		{1, 2, false, "甲@门"},
+		{1, 3, false, ""},
+		{1, 0, false, "甲@门"},
+		{1, 1, true, "甲@堂 甲@门"},
+		{1, 2, true, "甲@堂 甲@门 乙@院"},
+		{1, 3, true, "甲@堂 乙@院"},
+		{2, 1, true, "甲@堂"},
+		{2, 1, false, "甲@堂"},
+		{3, 2, false, "乙@院"},
+		{4, 2, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d at %d sub %v", tt.organization, tt.event, tt.withSub), func(t *testing.T) {
+			ms, err := s.OrganizationMembers(tt.organization, tt.event, tt.withSub)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := memberList(ms); got != tt.want {
+				t.Errorf("members = %q; want %q", got, tt.want)
+			}
+		})
+	}
+	ms, err := s.CharacterMemberships(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := memberList(ms); got != "甲@堂" {
+		t.Errorf("memberships of 甲 at event 3 = %q", got)
+	}
+	if _, err := s.OrganizationMembers(1, 9, false); err == nil {
+		t.Error("members as of a missing event succeeded")
+	}
+}
@@ -0,0 +1,169 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// PatchResult is a chapter after one patch: the revision it was saved as
+// (nil when the patch left the text unchanged), its new paragraph and word
+// counts, and the paragraphs the patch touched.
+type PatchResult struct {
+	ChapterID  uint
+	Revision   *Revision
+	Paragraphs int
+	WordCount  int
+	Changes    []ParagraphChange
+}
+
+// patchContent applies edit to a chapter's content and saves the result as
+// one revision, all in one transaction.
+func (s *Services) patchContent(chapterID uint, message string, edit func(content string) (string, error)) (*PatchResult, error) {
+	var r *PatchResult
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var c models.Chapter
+		if err := tx.First(&c, chapterID).Error; err != nil {
+			return err
+		}
+		old := c.Content
+		content, err := edit(old)
+		if err != nil {
+			return err
+		}
+		rev, err := (&Services{DB: tx}).setContent(&c, content, message)
+		if err != nil {
+			return err
+		}
+		r = &PatchResult{ChapterID: chapterID, Paragraphs: len(paragraphStarts(content)), WordCount: wordCount(content), Changes: paragraphDiff(old, content)}
+		if rev != nil {
+			info := revision(*rev)
+			r.Revision = &info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// paragraphEnd is the offset just past the text of the paragraph starting
+// at off.
+func paragraphEnd(content string, off int) int {
+	if i := strings.IndexByte(content[off:], '\n'); i >= 0 {
+		return off + i
+	}
+	return len(content)
+}
+
+// AppendChapter adds text as new paragraphs at the end of a chapter.
+func (s *Services) AppendChapter(chapterID uint, text, message string) (*PatchResult, error) {
+	return s.patchContent(chapterID, message, func(content string) (string, error) {
+		head := strings.TrimRightFunc(content, unicode.IsSpace)
+		if head == "" {
+			return text, nil
+		}
+		return head + paragraphSep(content) + text, nil
+	})
+}
+
+// InsertChapter adds text as new paragraphs before the paragraph-th
+// paragraph (1-based); one past the last paragraph appends.
+func (s *Services) InsertChapter(chapterID uint, paragraph int, text, message string) (*PatchResult, error) {
+	return s.patchContent(chapterID, message, func(content string) (string, error) {
+		starts := paragraphStarts(content)
+		if paragraph < 1 || paragraph > len(starts)+1 {
+			return "", &tool.FieldError{Field: "paragraph", Msg: fmt.Sprintf("chapter %d has %d paragraphs; must be between 1 and %d", chapterID, len(starts), len(starts)+1)}
+		}
+		if paragraph > len(starts) {
+			head := strings.TrimRightFunc(content, unicode.IsSpace)
+			if head == "" {
+				return text, nil
+			}
+			return head + paragraphSep(content) + text, nil
+		}
+		at := starts[paragraph-1]
+		return content[:at] + text + paragraphSep(content) + content[at:], nil
+	})
+}
+
+// ReplaceChapter replaces paragraphs from through to (1-based, inclusive)
+// with text, or removes them when text is empty.
+func (s *Services) ReplaceChapter(chapterID uint, from, to int, text, message string) (*PatchResult, error) {
+	return s.patchContent(chapterID, message, func(content string) (string, error) {
+		starts := paragraphStarts(content)
+		if from < 1 || from > len(starts) {
+			return "", &tool.FieldError{Field: "from", Msg: fmt.Sprintf("chapter %d has %d paragraphs; must be between 1 and %d", chapterID, len(starts), len(starts))}
+		}
+		if to == 0 {
+			to = from
+		}
+		if to < from || to > len(starts) {
+			return "", &tool.FieldError{Field: "to", Msg: fmt.Sprintf("must be between %d and %d", from, len(starts))}
+		}
+		start, end := starts[from-1], paragraphEnd(content, starts[to-1])
+		if text == "" {
+			// Take the separator along so no blank gap is left behind.
+			if to < len(starts) {
+				end = starts[to]
+			} else {
+				start = len(strings.TrimRightFunc(content[:start], unicode.IsSpace))
+			}
+		}
+		return content[:start] + text + content[end:], nil
+	})
+}
+
+// FindReplaceChapter replaces the one occurrence of find in a chapter with
+// replace. It fails when find is missing or occurs more than once, counting
+// overlapping occurrences, and names the paragraphs it occurs in so the
+// caller can quote more context.
+func (s *Services) FindReplaceChapter(chapterID uint, find, replace, message string) (*PatchResult, error) {
+	return s.patchContent(chapterID, message, func(content string) (string, error) {
+		at := matches(content, find)
+		if len(at) == 0 {
+			return "", &tool.FieldError{Field: "find", Msg: fmt.Sprintf("not found in chapter %d", chapterID)}
+		}
+		if len(at) > 1 {
+			return "", &tool.FieldError{Field: "find", Msg: fmt.Sprintf("occurs %d times, in paragraphs %s; include more surrounding text", len(at), matchParagraphs(content, at))}
+		}
+		return content[:at[0]] + replace + content[at[0]+len(find):], nil
+	})
+}
+
+// matches lists the byte offsets at which find occurs in content, including
+// occurrences that overlap an earlier one.
+func matches(content, find string) []int {
+	var out []int
+	for off := 0; off < len(content); {
+		i := strings.Index(content[off:], find)
+		if i < 0 {
+			break
+		}
+		out = append(out, off+i)
+		off += i + 1
+	}
+	return out
+}
+
+// matchParagraphs lists the paragraph numbers in which the matches at
+// offsets start, once each.
+func matchParagraphs(content string, offsets []int) string {
+	starts := paragraphStarts(content)
+	var out []string
+	for _, off := range offsets {
+		n := 0
+		for n < len(starts) && starts[n] <= off {
+			n++
+		}
+		if p := fmt.Sprint(max(n, 1)); len(out) == 0 || out[len(out)-1] != p {
+			out = append(out, p)
+		}
+	}
+	return strings.Join(out, ", ")
+}
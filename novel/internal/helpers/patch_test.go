@@ -0,0 +1,100 @@
+package helpers
+
+import (
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"testing"
+)
+
+func TestPatchChapter(t *testing.T) {
+	const text = "甲\n\n乙\n\n丙"
+	tests := []struct {
+		name    string
+		content string
+		patch   func(s *Services, id uint) (*PatchResult, error)
+		want    string
+		field   string
+	}{
+		{"append", text, func(s *Services, id uint) (*PatchResult, error) { return s.AppendChapter(id, "丁", "") }, "甲\n\n乙\n\n丙\n\n丁", ""},
+		{"append to empty", "", func(s *Services, id uint) (*PatchResult, error) { return s.AppendChapter(id, "丁", "") }, "丁", ""},
+		{"append after a trailing newline", "甲\n乙\n", func(s *Services, id uint) (*PatchResult, error) { return s.AppendChapter(id, "丁", "") }, "甲\n乙\n丁", ""},
+		{"insert first", text, func(s *Services, id uint) (*PatchResult, error) { return s.InsertChapter(id, 1, "丁", "") }, "丁\n\n甲\n\n乙\n\n丙", ""},
+		{"insert middle", text, func(s *Services, id uint) (*PatchResult, error) { return s.InsertChapter(id, 3, "丁", "") }, "甲\n\n乙\n\n丁\n\n丙", ""},
+		{"insert past last", text, func(s *Services, id uint) (*PatchResult, error) { return s.InsertChapter(id, 4, "丁", "") }, "甲\n\n乙\n\n丙\n\n丁", ""},
+		{"insert out of range", text, func(s *Services, id uint) (*PatchResult, error) { return s.InsertChapter(id, 5, "丁", "") }, text, "paragraph"},
+		{"replace one", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 2, 0, "丁", "") }, "甲\n\n丁\n\n丙", ""},
+		{"replace range", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 1, 2, "丁", "") }, "丁\n\n丙", ""},
+		{"remove middle", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 2, 0, "", "") }, "甲\n\n丙", ""},
+		{"remove last", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 3, 0, "", "") }, "甲\n\n乙", ""},
+		{"replace from out of range", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 4, 0, "丁", "") }, text, "from"},
+		{"replace to before from", text, func(s *Services, id uint) (*PatchResult, error) { return s.ReplaceChapter(id, 2, 1, "丁", "") }, text, "to"},
+		{"find and replace", text, func(s *Services, id uint) (*PatchResult, error) { return s.FindReplaceChapter(id, "乙", "丁", "") }, "甲\n\n丁\n\n丙", ""},
+		{"find missing", text, func(s *Services, id uint) (*PatchResult, error) { return s.FindReplaceChapter(id, "丁", "戊", "") }, text, "find"},
+		{"find ambiguous", "甲乙\n\n乙", func(s *Services, id uint) (*PatchResult, error) { return s.FindReplaceChapter(id, "乙", "丁", "") }, "甲乙\n\n乙", "find"},
+		{"find overlapping", "他哈哈哈地笑", func(s *Services, id uint) (*PatchResult, error) {
+			return s.FindReplaceChapter(id, "哈哈", "呵呵", "")
+		}, "他哈哈哈地笑", "find"},
+		{"find with a longer match", "他哈哈哈地笑", func(s *Services, id uint) (*PatchResult, error) {
+			return s.FindReplaceChapter(id, "哈哈哈", "呵呵", "")
+		}, "他呵呵地笑", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, id := testChapter(t, tt.content)
+			r, err := tt.patch(s, id)
+			if tt.field != "" {
+				fe, ok := err.(*tool.FieldError)
+				if !ok || fe.Field != tt.field {
+					t.Errorf("patch = %v; want an error on %s", err, tt.field)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if r.Paragraphs != len(paragraphStarts(tt.want)) || r.WordCount != wordCount(tt.want) || r.Revision == nil {
+				t.Errorf("patch = %+v", r)
+			}
+			var c models.Chapter
+			if err := s.DB.First(&c, id).Error; err != nil {
+				t.Fatal(err)
+			}
+			if c.Content != tt.want {
+				t.Errorf("content = %q; want %q", c.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchChapterReports(t *testing.T) {
+	s, id := testChapter(t, "甲\n\n乙")
+	r, err := s.FindReplaceChapter(id, "乙", "乙", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Revision != nil || len(r.Changes) != 0 {
+		t.Errorf("unchanged patch = %+v; want no revision and no changes", r)
+	}
+	r, err = s.InsertChapter(id, 2, "丙", "插入")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Changes) != 1 || r.Changes[0] != (ParagraphChange{Op: "added", To: 2, New: "丙"}) {
+		t.Errorf("changes = %+v", r.Changes)
+	}
+	if r.Revision.Message != "插入" {
+		t.Errorf("revision message = %q", r.Revision.Message)
+	}
+	_, err = s.FindReplaceChapter(id, "丙丙", "丁", "")
+	if fe, ok := err.(*tool.FieldError); !ok || fe.Msg != "not found in chapter 1" {
+		t.Errorf("missing find = %v", err)
+	}
+	if _, err := s.AppendChapter(id, "丙丙丙", ""); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.FindReplaceChapter(id, "丙丙", "丁", "")
+	if fe, ok := err.(*tool.FieldError); !ok || fe.Msg != "occurs 2 times, in paragraphs 4; include more surrounding text" {
+		t.Errorf("overlapping find = %v", err)
+	}
+	_, err = s.FindReplaceChapter(id, "\n", "", "")
+	if fe, ok := err.(*tool.FieldError); !ok || fe.Msg != "occurs 6 times, in paragraphs 1, 2, 3; include more surrounding text" {
+		t.Errorf("ambiguous find = %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RelationshipState is how one character stands toward another at some
+// point: the change in effect, EventID 0 when it dates from before the
+// story.
+type RelationshipState struct {
+	RelationshipID uint
+	AID            uint
+	BID            uint
+	EventID        uint
+	Type           string
+	Intimacy       float64
+	Note           string
+}
+
+// Relationship is how two characters stand toward each other, each way,
+// as of an event, or after every change when EventID is 0. A way is nil
+// when there is no relationship that way by then.
+type Relationship struct {
+	AID     uint
+	BID     uint
+	EventID uint
+	AToB    *RelationshipState
+	BToA    *RelationshipState
+}
+
+func (st *RelationshipState) text() string {
+	if st == nil {
+		return "无"
+	}
+	out := fmt.Sprintf("%s（亲密度 %g", st.Type, st.Intimacy)
+	if st.EventID != 0 {
+		out += fmt.Sprintf("，自事件 %d 起", st.EventID)
+	}
+	return out + "）"
+}
+
+func (r Relationship) Text() string {
+	at := "当前"
+	if r.EventID != 0 {
+		at = fmt.Sprintf("事件 %d 时", r.EventID)
+	}
+	return fmt.Sprintf("%s人物 %d 对人物 %d：%s；人物 %d 对人物 %d：%s", at, r.AID, r.BID, r.AToB.text(), r.BID, r.AID, r.BToA.text())
+}
+
+// IntimacyPoint is one change of a relationship in story order. At is the
+// story time of its event, nil when it has none or dates from before the
+// story.
+type IntimacyPoint struct {
+	EventID  uint
+	At       *time.Time
+	Type     string
+	Intimacy float64
+	Note     string
+}
+
+// IntimacySeries is how the relationships between two characters changed
+// over the story, each way.
+type IntimacySeries struct {
+	AID  uint
+	BID  uint
+	AToB []IntimacyPoint
+	BToA []IntimacyPoint
+}
+
+// symmetric reports whether a relationship type is registered as holding
+// both ways.
+func (s *Services) symmetric(rtype string) (bool, error) {
+	var n int64
+	err := s.DB.Model(&models.RelationshipType{}).Where("name = ? AND symmetric = ?", rtype, true).Count(&n).Error
+	return n > 0, err
+}
+
+// SetRelationshipType registers a relationship type, or changes whether it
+// is symmetric and its description. Relationships already set are left as
+// they are.
+func (s *Services) SetRelationshipType(name string, symmetric bool, description string) (*models.RelationshipType, error) {
+	rt := &models.RelationshipType{Name: name, Symmetric: symmetric, Description: description}
+	if err := validateModel("relationshipType", rt, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var old models.RelationshipType
+		if err := tx.Where("name = ?", name).Limit(1).Find(&old).Error; err != nil {
+			return err
+		}
+		if old.ID == 0 {
+			return tx.Create(rt).Error
+		}
+		rt.ID, rt.CreatedAt = old.ID, old.CreatedAt
+		return tx.Save(rt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rt, nil
+}
+
+// ListRelationshipTypes lists the registered relationship types by name.
+func (s *Services) ListRelationshipTypes() ([]models.RelationshipType, error) {
+	out := []models.RelationshipType{}
+	if err := s.DB.Order("name asc").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetCharacterRelationship records A's relationship toward B becoming
+// rtype with intimacy at an event, or how it stood before the story when
+// eventID is 0, replacing any change it already has at that event. A
+// symmetric type is recorded from B toward A too.
+func (s *Services) SetCharacterRelationship(aid, bid uint, rtype string, intimacy float64, eventID uint, note string) (*models.CharacterRelationship, error) {
+	if err := validateModel("characterRelationship", &models.CharacterRelationship{AID: aid, BID: bid, Intimacy: intimacy}, nil); err != nil {
+		return nil, err
+	}
+	var rel *models.CharacterRelationship
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		for _, ref := range []struct {
+			field string
+			id    uint
+		}{{"aid", aid}, {"bid", bid}} {
+			if err := tx.First(&models.Character{}, ref.id).Error; err != nil {
+				return &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("character %d not found", ref.id)}
+			}
+		}
+		if err := t.checkEvent(eventID); err != nil {
+			return err
+		}
+		o, err := chrono.Load(tx)
+		if err != nil {
+			return err
+		}
+		if rel, err = t.setRelationship(o, aid, bid, rtype, intimacy, eventID, note); err != nil {
+			return err
+		}
+		if sym, err := t.symmetric(rtype); err != nil || !sym {
+			return err
+		}
+		_, err = t.setRelationship(o, bid, aid, rtype, intimacy, eventID, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// setRelationship records one way of SetCharacterRelationship and brings
+// the relationship up to its latest change.
+func (s *Services) setRelationship(o chrono.Order, aid, bid uint, rtype string, intimacy float64, eventID uint, note string) (*models.CharacterRelationship, error) {
+	var rel models.CharacterRelationship
+	if err := s.DB.Where("a_id = ? AND b_id = ?", aid, bid).Limit(1).Find(&rel).Error; err != nil {
+		return nil, err
+	}
+	if rel.ID == 0 {
+		rel = models.CharacterRelationship{AID: aid, BID: bid, Type: rtype, Intimacy: intimacy}
+		if err := s.DB.Create(&rel).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		// A relationship from before changes were recorded stood as it is
+		// from the start.
+		var n int64
+		if err := s.DB.Model(&models.CharacterRelationshipChange{}).Where("relationship_id = ?", rel.ID).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			if err := s.DB.Create(&models.CharacterRelationshipChange{RelationshipID: rel.ID, Type: rel.Type, Intimacy: rel.Intimacy}).Error; err != nil {
+				return nil, err
+			}
+		}
+	}
+	ch := &models.CharacterRelationshipChange{RelationshipID: rel.ID, EventID: eventID, Type: rtype, Intimacy: intimacy, Note: note}
+	var old models.CharacterRelationshipChange
+	if err := s.DB.Where("relationship_id = ? AND event_id = ?", rel.ID, eventID).Limit(1).Find(&old).Error; err != nil {
+		return nil, err
+	}
+	if old.ID == 0 {
+		if err := s.DB.Create(ch).Error; err != nil {
+			return nil, err
+		}
+	} else {
+		ch.ID, ch.CreatedAt = old.ID, old.CreatedAt
+		if err := s.DB.Save(ch).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := s.refreshRelationship(o, &rel); err != nil {
+		return nil, err
+	}
+	return &rel, nil
+}
+
+// refreshRelationship brings a relationship up to its latest change, if it
+// has any.
+func (s *Services) refreshRelationship(o chrono.Order, rel *models.CharacterRelationship) error {
+	changes, err := s.relationshipChanges(o, []uint{rel.ID})
+	if err != nil || len(changes[rel.ID]) == 0 {
+		return err
+	}
+	last := changes[rel.ID][len(changes[rel.ID])-1]
+	rel.Type, rel.Intimacy = last.Type, last.Intimacy
+	return s.DB.Model(rel).Select("Type", "Intimacy").Updates(rel).Error
+}
+
+// RemoveRelationshipChange deletes a change of a relationship and brings
+// the relationship up to its latest remaining change.
+func (s *Services) RemoveRelationshipChange(id uint) (*DeleteReport, error) {
+	var ch models.CharacterRelationshipChange
+	if err := s.DB.First(&ch, id).Error; err != nil {
+		return nil, err
+	}
+	r, err := s.DeleteEntity("characterRelationshipChange", id, DeleteOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var rel models.CharacterRelationship
+	if err := s.DB.First(&rel, ch.RelationshipID).Error; err != nil {
+		return r, nil
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	return r, s.refreshRelationship(o, &rel)
+}
+
+// relationshipChanges loads the changes of relationships, keyed by
+// relationship, in story order: how they stood before the story first.
+func (s *Services) relationshipChanges(o chrono.Order, relationshipIDs []uint) (map[uint][]models.CharacterRelationshipChange, error) {
+	var rows []models.CharacterRelationshipChange
+	if err := s.DB.Where("relationship_id IN ?", relationshipIDs).Order("id asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(rows, func(a, b models.CharacterRelationshipChange) int {
+		if a.EventID == 0 || b.EventID == 0 {
+			return cmp.Compare(min(a.EventID, 1), min(b.EventID, 1))
+		}
+		return chrono.Cmp(o.Of(a.EventID), o.Of(b.EventID))
+	})
+	out := map[uint][]models.CharacterRelationshipChange{}
+	for _, c := range rows {
+		out[c.RelationshipID] = append(out[c.RelationshipID], c)
+	}
+	return out, nil
+}
+
+// stateAt is how rel stands as of p, given its changes in story order, or
+// after all of them when p is nil; nil when it had not formed by then.
+// Changes that cannot be placed against p have not happened yet.
+func stateAt(o chrono.Order, rel models.CharacterRelationship, changes []models.CharacterRelationshipChange, p *chrono.Point) *RelationshipState {
+	st := &RelationshipState{RelationshipID: rel.ID, AID: rel.AID, BID: rel.BID, Type: rel.Type, Intimacy: rel.Intimacy}
+	if len(changes) == 0 {
+		return st
+	}
+	found := false
+	for _, c := range changes {
+		if p == nil || happened(o, c.EventID, *p) {
+			st.EventID, st.Type, st.Intimacy, st.Note, found = c.EventID, c.Type, c.Intimacy, c.Note, true
+		}
+	}
+	if !found {
+		return nil
+	}
+	return st
+}
+
+// pair loads the relationships between two characters, either way, and
+// their changes.
+func (s *Services) pair(o chrono.Order, aid, bid uint) (ab, ba *models.CharacterRelationship, changes map[uint][]models.CharacterRelationshipChange, err error) {
+	for _, ref := range []struct {
+		field string
+		id    uint
+	}{{"aid", aid}, {"bid", bid}} {
+		if err := s.DB.First(&models.Character{}, ref.id).Error; err != nil {
+			return nil, nil, nil, &tool.FieldError{Field: ref.field, Msg: fmt.Sprintf("character %d not found", ref.id)}
+		}
+	}
+	var rels []models.CharacterRelationship
+	if err := s.DB.Where("(a_id = ? AND b_id = ?) OR (a_id = ? AND b_id = ?)", aid, bid, bid, aid).Order("id asc").Find(&rels).Error; err != nil {
+		return nil, nil, nil, err
+	}
+	ids := []uint{}
+	for i := range rels {
+		ids = append(ids, rels[i].ID)
+		if rels[i].AID == aid {
+			ab = &rels[i]
+		} else {
+			ba = &rels[i]
+		}
+	}
+	changes, err = s.relationshipChanges(o, ids)
+	return ab, ba, changes, err
+}
+
+// RelationshipAt returns how two characters stand toward each other, each
+// way, as of an event, or after every change when eventID is 0.
+func (s *Services) RelationshipAt(aid, bid, eventID uint) (*Relationship, error) {
+	if err := s.checkEvent(eventID); err != nil {
+		return nil, err
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	ab, ba, changes, err := s.pair(o, aid, bid)
+	if err != nil {
+		return nil, err
+	}
+	var p *chrono.Point
+	if eventID != 0 {
+		at := o.Of(eventID)
+		p = &at
+	}
+	r := &Relationship{AID: aid, BID: bid, EventID: eventID}
+	if ab != nil {
+		r.AToB = stateAt(o, *ab, changes[ab.ID], p)
+	}
+	if ba != nil {
+		r.BToA = stateAt(o, *ba, changes[ba.ID], p)
+	}
+	return r, nil
+}
+
+// RelationshipHistory returns how the relationships between two characters
+// changed over the story, each way, in story order.
+func (s *Services) RelationshipHistory(aid, bid uint) (*IntimacySeries, error) {
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	ab, ba, changes, err := s.pair(o, aid, bid)
+	if err != nil {
+		return nil, err
+	}
+	series := func(rel *models.CharacterRelationship) []IntimacyPoint {
+		out := []IntimacyPoint{}
+		if rel == nil {
+			return out
+		}
+		if len(changes[rel.ID]) == 0 {
+			return append(out, IntimacyPoint{Type: rel.Type, Intimacy: rel.Intimacy})
+		}
+		for _, c := range changes[rel.ID] {
+			pt := IntimacyPoint{EventID: c.EventID, Type: c.Type, Intimacy: c.Intimacy, Note: c.Note}
+			if c.EventID != 0 {
+				pt.At = o.Of(c.EventID).At
+			}
+			out = append(out, pt)
+		}
+		return out
+	}
+	return &IntimacySeries{AID: aid, BID: bid, AToB: series(ab), BToA: series(ba)}, nil
+}
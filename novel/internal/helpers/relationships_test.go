@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"strings"
+	"testing"
+)
+
+// relationshipStory adds character 丙 (3) to testStory. 甲 is 乙's 师父
+// from event 1 and turns 敌人 at event 3, while 乙 has looked up to 甲
+// since before the story; 甲 and 丙 marry at event 2, and 夫妻 is
+// symmetric.
+func relationshipStory(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	if err := s.DB.Create(&models.Character{ID: 3, Name: "丙"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetRelationshipType("夫妻", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct {
+		aid, bid uint
+		rtype    string
+		intimacy float64
+		event    uint
+	}{
+		{1, 2, "师徒", 0.5, 1},
+		{1, 2, "敌人", 0.1, 3},
+		{2, 1, "敬仰", 0.8, 0},
+		{1, 3, "夫妻", 0.9, 2},
+	} {
+		if _, err := s.SetCharacterRelationship(r.aid, r.bid, r.rtype, r.intimacy, r.event, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func (st *RelationshipState) summary() string {
+	if st == nil {
+		return "无"
+	}
+	return fmt.Sprintf("%s %g@%d", st.Type, st.Intimacy, st.EventID)
+}
+
+func TestRelationshipAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		aid, bid uint
+		event    uint
+		want     string
+	}{
+		{"at the first change", 1, 2, 1, "师徒 0.5@1 | 敬仰 0.8@0"},
+		{"between two changes", 1, 2, 2, "师徒 0.5@1 | 敬仰 0.8@0"},
+		{"at the second change", 1, 2, 3, "敌人 0.1@3 | 敬仰 0.8@0"},
+		{"after every change", 1, 2, 0, "敌人 0.1@3 | 敬仰 0.8@0"},
+		{"the other way round", 2, 1, 2, "敬仰 0.8@0 | 师徒 0.5@1"},
+		{"symmetric before it formed", 1, 3, 1, "无 | 无"},
+		{"symmetric mirrored", 3, 1, 2, "夫妻 0.9@2 | 夫妻 0.9@2"},
+		{"none", 2, 3, 0, "无 | 无"},
+	}
+	s := relationshipStory(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.RelationshipAt(tt.aid, tt.bid, tt.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.AToB.summary() + " | " + r.BToA.summary(); got != tt.want {
+				t.Errorf("relationship = %q; want %q", got, tt.want)
+			}
+		})
+	}
+	if _, err := s.RelationshipAt(1, 9, 0); err == nil {
+		t.Error("relationship with a missing character succeeded")
+	}
+}
+
+func TestRelationshipHistory(t *testing.T) {
+	series := func(ps []IntimacyPoint) string {
+		var out []string
+		for _, p := range ps {
+			out = append(out, fmt.Sprintf("%s %g@%d", p.Type, p.Intimacy, p.EventID))
+		}
+		return strings.Join(out, ", ")
+	}
+	s := relationshipStory(t)
+	h, err := s.RelationshipHistory(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 师徒 is not symmetric, so 乙's side keeps only its own change.
+	if got, want := series(h.AToB), "师徒 0.5@1, 敌人 0.1@3"; got != want {
+		t.Errorf("甲 to 乙 = %q; want %q", got, want)
+	}
+	if got, want := series(h.BToA), "敬仰 0.8@0"; got != want {
+		t.Errorf("乙 to 甲 = %q; want %q", got, want)
+	}
+	h, err = s.RelationshipHistory(3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := series(h.AToB) + " | " + series(h.BToA); got != "夫妻 0.9@2 | 夫妻 0.9@2" {
+		t.Errorf("丙 and 甲 = %q", got)
+	}
+}
+
+func TestRemoveRelationshipChange(t *testing.T) {
+	s := relationshipStory(t)
+	var rel models.CharacterRelationship
+	if err := s.DB.Where("a_id = 1 AND b_id = 2").First(&rel).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rel.Type != "敌人" {
+		t.Fatalf("relationship is %s before removal; want 敌人", rel.Type)
+	}
+	var ch models.CharacterRelationshipChange
+	if err := s.DB.Where("relationship_id = ? AND event_id = 3", rel.ID).First(&ch).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RemoveRelationshipChange(ch.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.First(&rel, rel.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rel.Type != "师徒" || rel.Intimacy != 0.5 {
+		t.Errorf("relationship after removal = %s %g; want 师徒 0.5", rel.Type, rel.Intimacy)
+	}
+	r, err := s.RelationshipAt(1, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.AToB.summary(); got != "师徒 0.5@1" {
+		t.Errorf("relationship at event 3 after removal = %q", got)
+	}
+}
+
+func TestSymmetricOptIn(t *testing.T) {
+	s := relationshipStory(t)
+	// Making a type symmetric mirrors only relationships set from then on.
+	if _, err := s.SetRelationshipType("师徒", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.RelationshipAt(2, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.AToB.summary(); got != "敬仰 0.8@0" {
+		t.Errorf("乙 to 甲 after opting in = %q; want it unchanged", got)
+	}
+	if _, err := s.SetCharacterRelationship(2, 3, "师徒", 0.6, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if r, err = s.RelationshipAt(3, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.AToB.summary(); got != "师徒 0.6@1" {
+		t.Errorf("丙 to 乙 = %q; want the mirrored 师徒", got)
+	}
+}
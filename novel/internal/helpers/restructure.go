@@ -0,0 +1,324 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// siblings lists the IDs of model rows under parentID in reading order,
+// leaving out skip.
+func (s *Services) siblings(model any, column string, parentID uint, skip uint) ([]uint, error) {
+	var ids []uint
+	err := s.DB.Model(model).Where(column+" = ? AND id <> ?", parentID, skip).Order("`index` asc, id asc").Pluck("id", &ids).Error
+	return ids, err
+}
+
+// reindex numbers rows of model from 1 in the order of ids.
+func (s *Services) reindex(model any, ids []uint) error {
+	for i, id := range ids {
+		if err := s.DB.Model(model).Where("id = ?", id).UpdateColumn("index", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// place moves row id of model under parentID at 1-based position pos (0 or
+// past the end for the end) and renumbers its new and old siblings.
+func (s *Services) place(model any, column string, id uint, oldParent uint, parentID uint, pos int) error {
+	ids, err := s.siblings(model, column, parentID, id)
+	if err != nil {
+		return err
+	}
+	if pos <= 0 || pos > len(ids) {
+		pos = len(ids) + 1
+	}
+	if err := s.DB.Model(model).Where("id = ?", id).UpdateColumn(column, parentID).Error; err != nil {
+		return err
+	}
+	if err := s.reindex(model, slices.Insert(ids, pos-1, id)); err != nil {
+		return err
+	}
+	if oldParent == parentID {
+		return nil
+	}
+	old, err := s.siblings(model, column, oldParent, id)
+	if err != nil {
+		return err
+	}
+	return s.reindex(model, old)
+}
+
+// reorder renumbers the rows of model under parentID in the given order,
+// which must list each of them once.
+func (s *Services) reorder(model any, column string, parentID uint, order []uint) error {
+	ids, err := s.siblings(model, column, parentID, 0)
+	if err != nil {
+		return err
+	}
+	want := slices.Clone(ids)
+	got := slices.Clone(order)
+	slices.Sort(want)
+	slices.Sort(got)
+	if !slices.Equal(want, got) {
+		return &tool.FieldError{Field: "order", Msg: fmt.Sprintf("must list each of %v exactly once", want)}
+	}
+	return s.reindex(model, order)
+}
+
+// MoveChapter puts a chapter at 1-based position pos of volumeID (0 for the
+// end; volumeID 0 keeps its volume) and renumbers the chapters of both
+// volumes.
+func (s *Services) MoveChapter(chapterID uint, volumeID uint, pos int) ([]models.Chapter, error) {
+	var c models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&c, chapterID).Error; err != nil {
+			return err
+		}
+		if volumeID == 0 {
+			volumeID = c.VolumeID
+		}
+		if err := tx.First(&models.Volume{}, volumeID).Error; err != nil {
+			return &tool.FieldError{Field: "volumeID", Msg: fmt.Sprintf("volume %d not found", volumeID)}
+		}
+		return (&Services{DB: tx}).place(&models.Chapter{}, "volume_id", chapterID, c.VolumeID, volumeID, pos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.volumeChapters(volumeID)
+}
+
+// ReorderChapters numbers a volume's chapters from 1 in the given order.
+func (s *Services) ReorderChapters(volumeID uint, order []uint) ([]models.Chapter, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return (&Services{DB: tx}).reorder(&models.Chapter{}, "volume_id", volumeID, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.volumeChapters(volumeID)
+}
+
+// MoveVolume puts a volume at 1-based position pos of novelID (0 for the
+// end; novelID 0 keeps its novel) and renumbers the volumes of both novels.
+func (s *Services) MoveVolume(volumeID uint, novelID uint, pos int) ([]models.Volume, error) {
+	var v models.Volume
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&v, volumeID).Error; err != nil {
+			return err
+		}
+		if novelID == 0 {
+			novelID = v.NovelID
+		}
+		if err := tx.First(&models.Novel{}, novelID).Error; err != nil {
+			return &tool.FieldError{Field: "novelID", Msg: fmt.Sprintf("novel %d not found", novelID)}
+		}
+		return (&Services{DB: tx}).place(&models.Volume{}, "novel_id", volumeID, v.NovelID, novelID, pos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.novelVolumes(novelID)
+}
+
+// ReorderVolumes numbers a novel's volumes from 1 in the given order.
+func (s *Services) ReorderVolumes(novelID uint, order []uint) ([]models.Volume, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return (&Services{DB: tx}).reorder(&models.Volume{}, "novel_id", novelID, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.novelVolumes(novelID)
+}
+
+func (s *Services) volumeChapters(volumeID uint) ([]models.Chapter, error) {
+	chs := []models.Chapter{}
+	err := s.DB.Where("volume_id = ?", volumeID).Order("`index` asc, id asc").Find(&chs).Error
+	return chs, err
+}
+
+func (s *Services) novelVolumes(novelID uint) ([]models.Volume, error) {
+	vols := []models.Volume{}
+	err := s.DB.Where("novel_id = ?", novelID).Order("`index` asc, id asc").Find(&vols).Error
+	return vols, err
+}
+
+// paragraphStarts returns the byte offset at which each paragraph of
+// content starts. A paragraph is a line with text; blank lines only
+// separate paragraphs.
+func paragraphStarts(content string) []int {
+	var starts []int
+	for off := 0; off < len(content); {
+		end := strings.IndexByte(content[off:], '\n')
+		if end < 0 {
+			end = len(content) - off
+		}
+		if strings.TrimSpace(content[off:off+end]) != "" {
+			starts = append(starts, off)
+		}
+		off += end + 1
+	}
+	return starts
+}
+
+// paragraphSep is the separator content already uses between paragraphs.
+func paragraphSep(content string) string {
+	if strings.Contains(content, "\n\n") {
+		return "\n\n"
+	}
+	return "\n"
+}
+
+// SplitResult is a chapter split in two, with the events that moved to the
+// second part.
+type SplitResult struct {
+	First  models.Chapter
+	Second models.Chapter
+	Moved  []uint
+}
+
+// SplitChapter cuts a chapter before its paragraph-th paragraph (1-based,
+// at least 2). The rest becomes a new chapter titled title right after it,
+// and eventsFrom, if set, moves with every event told after it.
+func (s *Services) SplitChapter(chapterID uint, paragraph int, title string, eventsFrom uint) (*SplitResult, error) {
+	r := &SplitResult{Moved: []uint{}}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if err := tx.First(&r.First, chapterID).Error; err != nil {
+			return err
+		}
+		starts := paragraphStarts(r.First.Content)
+		if paragraph < 2 || paragraph > len(starts) {
+			return &tool.FieldError{Field: "paragraph", Msg: fmt.Sprintf("chapter %d has %d paragraphs; must be at least 2 and at most that", chapterID, len(starts))}
+		}
+		evs, err := sc.chapterEvents(chapterID, 0)
+		if err != nil {
+			return err
+		}
+		cut := len(evs)
+		if eventsFrom != 0 {
+			if cut = slices.Index(evs, eventsFrom); cut < 0 {
+				return &tool.FieldError{Field: "eventsFrom", Msg: fmt.Sprintf("event %d is not in chapter %d", eventsFrom, chapterID)}
+			}
+		}
+		content := r.First.Content
+		at := starts[paragraph-1]
+		r.Second = models.Chapter{VolumeID: r.First.VolumeID, Title: title, Status: r.First.Status}
+		if err := tx.Create(&r.Second).Error; err != nil {
+			return err
+		}
+		if _, err := sc.setContent(&r.Second, content[at:], fmt.Sprintf("从章节 %d 拆分", chapterID)); err != nil {
+			return err
+		}
+		if err := sc.splitScenes(chapterID, paragraph, r.Second.ID); err != nil {
+			return err
+		}
+		if _, err := sc.setContent(&r.First, strings.TrimRightFunc(content[:at], unicode.IsSpace), fmt.Sprintf("拆分出章节 %d", r.Second.ID)); err != nil {
+			return err
+		}
+		r.Moved = append(r.Moved, evs[cut:]...)
+		if len(r.Moved) > 0 {
+			if err := tx.Model(&models.Event{}).Where("id IN ?", r.Moved).Update("chapter_id", r.Second.ID).Error; err != nil {
+				return err
+			}
+			if err := sc.renumber(r.Moved); err != nil {
+				return err
+			}
+		}
+		for _, id := range []uint{chapterID, r.Second.ID} {
+			if err := sc.dropForeignScenes(id); err != nil {
+				return err
+			}
+		}
+		ids, err := sc.siblings(&models.Chapter{}, "volume_id", r.First.VolumeID, r.Second.ID)
+		if err != nil {
+			return err
+		}
+		return sc.reindex(&models.Chapter{}, slices.Insert(ids, slices.Index(ids, chapterID)+1, r.Second.ID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.DB.First(&r.First, r.First.ID)
+	s.DB.First(&r.Second, r.Second.ID)
+	return r, nil
+}
+
+// MergeResult is a chapter after absorbing the one that followed it. The
+// absorbed chapter is in the trash entry TrashID.
+type MergeResult struct {
+	Chapter  models.Chapter
+	Absorbed uint
+	TrashID  uint
+}
+
+// MergeChapters appends the chapter right after chapterID in its volume to
+// it: content, then events in their narrative order.
+func (s *Services) MergeChapters(chapterID uint) (*MergeResult, error) {
+	r := &MergeResult{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		c := &r.Chapter
+		if err := tx.First(c, chapterID).Error; err != nil {
+			return err
+		}
+		ids, err := sc.siblings(&models.Chapter{}, "volume_id", c.VolumeID, 0)
+		if err != nil {
+			return err
+		}
+		i := slices.Index(ids, chapterID)
+		if i+1 >= len(ids) {
+			return &tool.FieldError{Field: "id", Msg: fmt.Sprintf("chapter %d is the last of its volume", chapterID)}
+		}
+		var next models.Chapter
+		if err := tx.First(&next, ids[i+1]).Error; err != nil {
+			return err
+		}
+		content := c.Content
+		switch {
+		case next.Content == "":
+		case content == "":
+			content = next.Content
+		default:
+			content += paragraphSep(content) + next.Content
+		}
+		// Not setContent: the appended paragraphs belong to next's scenes,
+		// not to the last scene of c.
+		if _, err := sc.recordRevision(c.ID, c.Content, content, fmt.Sprintf("并入章节 %d", next.ID)); err != nil {
+			return err
+		}
+		if err := sc.absorbScenes(c.ID, next.ID, len(paragraphStarts(c.Content))); err != nil {
+			return err
+		}
+		c.Content = content
+		if err := tx.Model(c).Update("content", content).Error; err != nil {
+			return err
+		}
+		d, err := sc.DeleteEntity("chapter", next.ID, DeleteOptions{Events: "move", MoveEventsTo: c.ID})
+		if err != nil {
+			return err
+		}
+		r.Absorbed, r.TrashID = next.ID, d.TrashID
+		evs, err := sc.chapterEvents(c.ID, 0)
+		if err != nil {
+			return err
+		}
+		if err := sc.renumber(evs); err != nil {
+			return err
+		}
+		return sc.reindex(&models.Chapter{}, slices.Delete(ids, i+1, i+2))
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.DB.First(&r.Chapter, chapterID)
+	return r, nil
+}
@@ -0,0 +1,163 @@
+package helpers
+
+import (
+	"context"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"testing"
+)
+
+// callTool calls an action of one of the helper tools, as tools/call does.
+func callTool(t *testing.T, s *Services, name string, args map[string]any) (any, error) {
+	t.Helper()
+	for _, tl := range Tools(s) {
+		if tl.Name() == name {
+			return tl.Call(context.Background(), args)
+		}
+	}
+	t.Fatalf("no tool %s", name)
+	return nil, nil
+}
+
+// indexes maps each chapter of a volume to its index.
+func indexes(t *testing.T, s *Services, volumeID uint) map[uint]int {
+	t.Helper()
+	cs, err := s.volumeChapters(volumeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := map[uint]int{}
+	for _, c := range cs {
+		out[c.ID] = c.Index
+	}
+	return out
+}
+
+func TestIndexWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(t *testing.T, s *Services) (any, error)
+		field string
+	}{
+		{"sqlHelper chapter index", func(t *testing.T, s *Services) (any, error) {
+			return s.SQLUpdate("chapter", 2, map[string]any{"index": float64(1)})
+		}, "fields.index"},
+		{"sqlHelper chapter volume", func(t *testing.T, s *Services) (any, error) {
+			return s.SQLUpdate("chapter", 2, map[string]any{"VolumeID": float64(2)})
+		}, "fields.VolumeID"},
+		{"sqlHelper volume index", func(t *testing.T, s *Services) (any, error) {
+			return s.SQLUpdate("volume", 2, map[string]any{"Index": float64(1)})
+		}, "fields.Index"},
+		{"sqlHelper volume novel", func(t *testing.T, s *Services) (any, error) {
+			return s.SQLUpdate("volume", 2, map[string]any{"novelID": float64(1)})
+		}, "fields.novelID"},
+		{"chapterHelper index", func(t *testing.T, s *Services) (any, error) {
+			return callTool(t, s, "chapterHelper", map[string]any{"action": "update", "id": float64(2), "index": float64(1)})
+		}, "index"},
+		{"chapterHelper volume", func(t *testing.T, s *Services) (any, error) {
+			return callTool(t, s, "chapterHelper", map[string]any{"action": "update", "id": float64(2), "volumeID": float64(2)})
+		}, "volumeID"},
+		{"volumeHelper index", func(t *testing.T, s *Services) (any, error) {
+			return callTool(t, s, "volumeHelper", map[string]any{"action": "update", "id": float64(2), "index": float64(1)})
+		}, "index"},
+		{"characterAbilityHelper level", func(t *testing.T, s *Services) (any, error) {
+			ab, err := s.CreateAbility(1, "剑法", 1, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return callTool(t, s, "characterAbilityHelper", map[string]any{"action": "update", "id": float64(ab.ID), "level": float64(3)})
+		}, "level"},
+		{"chapterHelper title", func(t *testing.T, s *Services) (any, error) {
+			return callTool(t, s, "chapterHelper", map[string]any{"action": "update", "id": float64(2), "title": "二"})
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testStory(t)
+			for _, r := range []any{
+				&models.Volume{ID: 2, NovelID: 1, Index: 2},
+				&models.Chapter{ID: 2, VolumeID: 1, Index: 2}, &models.Chapter{ID: 3, VolumeID: 1, Index: 3},
+			} {
+				if err := s.DB.Create(r).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.DB.Model(&models.Chapter{}).Where("id = 1").Update("index", 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			_, err := tt.write(t, s)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if fe, ok := err.(*tool.FieldError); !ok || fe.Field != tt.field {
+				t.Errorf("write = %v; want an error on %s", err, tt.field)
+			}
+			if got := indexes(t, s, 1); got[1] != 1 || got[2] != 2 || got[3] != 3 {
+				t.Errorf("chapter indexes = %v; want unchanged", got)
+			}
+		})
+	}
+}
+
+func TestMoveChapterRenumbers(t *testing.T) {
+	s := testStory(t)
+	for _, r := range []any{
+		&models.Volume{ID: 2, NovelID: 1, Index: 2},
+		&models.Chapter{ID: 2, VolumeID: 1, Index: 2}, &models.Chapter{ID: 3, VolumeID: 2, Index: 1},
+	} {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.MoveChapter(1, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := indexes(t, s, 1); len(got) != 1 || got[2] != 1 {
+		t.Errorf("volume 1 indexes = %v; want chapter 2 at 1", got)
+	}
+	if got := indexes(t, s, 2); len(got) != 2 || got[1] != 1 || got[3] != 2 {
+		t.Errorf("volume 2 indexes = %v; want chapter 1 at 1, chapter 3 at 2", got)
+	}
+}
+
+func TestPreviousChapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		chapter uint
+		want    uint
+	}{
+		{"first of the novel", 1, 0},
+		{"same index, lower id", 2, 1},
+		{"next index", 3, 2},
+		{"across an empty volume", 4, 3},
+		{"same volume index, lower id", 5, 4},
+	}
+	s := testStory(t)
+	// Volume 1 holds chapters 1, 2 (both at index 0) and 3; volume 2 is
+	// empty; volumes 3 and 4 share index 2 and hold chapters 4 and 5.
+	for _, r := range []any{
+		&models.Volume{ID: 2, NovelID: 1, Index: 1}, &models.Volume{ID: 3, NovelID: 1, Index: 2}, &models.Volume{ID: 4, NovelID: 1, Index: 2},
+		&models.Chapter{ID: 2, VolumeID: 1}, &models.Chapter{ID: 3, VolumeID: 1, Index: 1},
+		&models.Chapter{ID: 4, VolumeID: 3}, &models.Chapter{ID: 5, VolumeID: 4},
+	} {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev, err := s.PreviousChapter(tt.chapter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got uint
+			if prev != nil {
+				got = prev.ID
+			}
+			if got != tt.want {
+				t.Errorf("previous of %d = %d; want %d", tt.chapter, got, tt.want)
+			}
+		})
+	}
+}
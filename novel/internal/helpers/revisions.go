@@ -0,0 +1,267 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// snapshotEvery is how often a revision stores the full text instead of a
+// delta, which bounds how many deltas rebuilding any revision applies.
+const snapshotEvery = 20
+
+// Revision describes one saved version of a chapter's content.
+type Revision struct {
+	ID        uint
+	ChapterID uint
+	Number    int
+	WordCount int
+	Message   string
+	CreatedAt time.Time
+}
+
+// RevisionContent is a revision with its full text.
+type RevisionContent struct {
+	Revision
+	Content string
+}
+
+// RevisionDiff compares two revisions. Unified is set in unified mode and
+// Paragraphs in paragraph mode.
+type RevisionDiff struct {
+	From       Revision
+	To         Revision
+	Unified    string
+	Paragraphs []ParagraphChange
+}
+
+func (d RevisionDiff) Text() string {
+	if d.Paragraphs == nil {
+		return d.Unified
+	}
+	if len(d.Paragraphs) == 0 {
+		return "无差异"
+	}
+	var sb strings.Builder
+	for _, p := range d.Paragraphs {
+		switch p.Op {
+		case "added":
+			fmt.Fprintf(&sb, "新增第 %d 段：\n+ %s\n", p.To, p.New)
+		case "removed":
+			fmt.Fprintf(&sb, "删除第 %d 段：\n- %s\n", p.From, p.Old)
+		case "changed":
+			fmt.Fprintf(&sb, "修改第 %d 段（新第 %d 段）：\n- %s\n+ %s\n", p.From, p.To, p.Old, p.New)
+		}
+	}
+	return sb.String()
+}
+
+// wordCount counts each CJK character as a word, and each run of other
+// letters or digits as one word. Punctuation and spaces are not counted.
+func wordCount(s string) int {
+	n := 0
+	inWord := false
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			n++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				n++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	return n
+}
+
+func revision(r models.ChapterRevision) Revision {
+	return Revision{ID: r.ID, ChapterID: r.ChapterID, Number: r.Number, WordCount: r.WordCount, Message: r.Message, CreatedAt: r.CreatedAt}
+}
+
+// revisionText rebuilds the content of r from the nearest snapshot at or
+// before it.
+func (s *Services) revisionText(r models.ChapterRevision) (string, error) {
+	if r.Snapshot {
+		return r.Data, nil
+	}
+	var chain []models.ChapterRevision
+	base := s.DB.Model(&models.ChapterRevision{}).Select("MAX(number)").Where("chapter_id = ? AND snapshot = ? AND number <= ?", r.ChapterID, true, r.Number)
+	if err := s.DB.Where("chapter_id = ? AND number >= (?) AND number <= ?", r.ChapterID, base, r.Number).Order("number asc").Find(&chain).Error; err != nil {
+		return "", err
+	}
+	if len(chain) == 0 || !chain[0].Snapshot {
+		return "", fmt.Errorf("revision %d of chapter %d has no snapshot to rebuild from", r.Number, r.ChapterID)
+	}
+	text := chain[0].Data
+	for _, c := range chain[1:] {
+		var err error
+		if text, err = applyDelta(text, c.Data); err != nil {
+			return "", fmt.Errorf("revision %d of chapter %d: %w", c.Number, c.ChapterID, err)
+		}
+	}
+	return text, nil
+}
+
+// recordRevision saves content as the newest revision of a chapter whose
+// content was old, unless it matches the newest revision already, in which
+// case it returns nil. The first revision of a chapter that had content
+// before history was kept saves that content first, so it can be restored.
+func (s *Services) recordRevision(chapterID uint, old, content, message string) (*models.ChapterRevision, error) {
+	var last models.ChapterRevision
+	err := s.DB.Where("chapter_id = ?", chapterID).Order("number desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+	prev := ""
+	switch {
+	case last.ID != 0:
+		if prev, err = s.revisionText(last); err != nil {
+			return nil, err
+		}
+		if prev == content {
+			return nil, nil
+		}
+	case old == content:
+		return nil, nil
+	case old != "":
+		last = models.ChapterRevision{ChapterID: chapterID, Number: 1, Snapshot: true, Data: old, WordCount: wordCount(old), Message: "启用版本记录前的正文"}
+		if err := s.DB.Create(&last).Error; err != nil {
+			return nil, err
+		}
+		prev = old
+	}
+	r := &models.ChapterRevision{ChapterID: chapterID, Number: last.Number + 1, WordCount: wordCount(content), Message: message}
+	r.Data = makeDelta(prev, content)
+	if (r.Number-1)%snapshotEvery == 0 || len(r.Data) >= len(content) {
+		r.Snapshot, r.Data = true, content
+	}
+	if err := s.DB.Create(r).Error; err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// setContent replaces a chapter's content and records it as a revision,
+// which it returns (nil if the content did not change). Scene spans follow
+// their paragraphs.
+func (s *Services) setContent(c *models.Chapter, content, message string) (*models.ChapterRevision, error) {
+	r, err := s.recordRevision(c.ID, c.Content, content, message)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.moveSpans(c.ID, c.Content, content); err != nil {
+		return nil, err
+	}
+	c.Content = content
+	return r, s.DB.Model(c).Update("content", content).Error
+}
+
+// ListRevisions returns a chapter's revisions, oldest first.
+func (s *Services) ListRevisions(chapterID uint) ([]Revision, error) {
+	if err := s.DB.First(&models.Chapter{}, chapterID).Error; err != nil {
+		return nil, err
+	}
+	var rs []models.ChapterRevision
+	if err := s.DB.Where("chapter_id = ?", chapterID).Order("number asc").Find(&rs).Error; err != nil {
+		return nil, err
+	}
+	out := []Revision{}
+	for _, r := range rs {
+		out = append(out, revision(r))
+	}
+	return out, nil
+}
+
+func (s *Services) loadRevision(field string, id uint) (models.ChapterRevision, error) {
+	var r models.ChapterRevision
+	if err := s.DB.First(&r, id).Error; err != nil {
+		return r, &tool.FieldError{Field: field, Msg: fmt.Sprintf("revision %d not found", id)}
+	}
+	return r, nil
+}
+
+// GetRevision returns one revision with its full text.
+func (s *Services) GetRevision(revisionID uint) (*RevisionContent, error) {
+	r, err := s.loadRevision("revisionID", revisionID)
+	if err != nil {
+		return nil, err
+	}
+	text, err := s.revisionText(r)
+	if err != nil {
+		return nil, err
+	}
+	return &RevisionContent{Revision: revision(r), Content: text}, nil
+}
+
+// DiffRevisions compares revision from with revision to, or with the newest
+// revision of the same chapter when to is 0. mode is "unified" (default) or
+// "paragraph".
+func (s *Services) DiffRevisions(from, to uint, mode string) (*RevisionDiff, error) {
+	a, err := s.loadRevision("from", from)
+	if err != nil {
+		return nil, err
+	}
+	var b models.ChapterRevision
+	if to == 0 {
+		err = s.DB.Where("chapter_id = ?", a.ChapterID).Order("number desc").First(&b).Error
+	} else {
+		b, err = s.loadRevision("to", to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	at, err := s.revisionText(a)
+	if err != nil {
+		return nil, err
+	}
+	bt, err := s.revisionText(b)
+	if err != nil {
+		return nil, err
+	}
+	d := &RevisionDiff{From: revision(a), To: revision(b)}
+	if mode == "paragraph" {
+		d.Paragraphs = paragraphDiff(at, bt)
+	} else {
+		name := func(r models.ChapterRevision) string { return fmt.Sprintf("chapter %d r%d", r.ChapterID, r.Number) }
+		d.Unified = unifiedDiff(name(a), name(b), at, bt)
+	}
+	return d, nil
+}
+
+// RestoreRevision makes an old revision's text the chapter's content again,
+// as a new revision.
+func (s *Services) RestoreRevision(revisionID uint, message string) (*models.Chapter, error) {
+	var c models.Chapter
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		r, err := sc.loadRevision("revisionID", revisionID)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&c, r.ChapterID).Error; err != nil {
+			return fmt.Errorf("chapter %d of revision %d is missing or in the trash; restore it first", r.ChapterID, revisionID)
+		}
+		text, err := sc.revisionText(r)
+		if err != nil {
+			return err
+		}
+		if message == "" {
+			message = fmt.Sprintf("恢复到第 %d 版", r.Number)
+		}
+		_, err = sc.setContent(&c, text, message)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,223 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"strings"
+	"testing"
+)
+
+// testChapter opens an empty database with one chapter holding content.
+func testChapter(t *testing.T, content string) (*Services, uint) {
+	t.Helper()
+	db, err := storage.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Volume{}, &models.Chapter{}, &models.ChapterRevision{}, &models.Scene{}); err != nil {
+		t.Fatal(err)
+	}
+	c := &models.Chapter{VolumeID: 1, Title: "C", Content: content}
+	if err := db.Create(c).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &Services{DB: db}, c.ID
+}
+
+func TestDelta(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+	}{
+		{"empty to text", "", "a\nb"},
+		{"text to empty", "a\nb", ""},
+		{"same", "a\nb\nc", "a\nb\nc"},
+		{"insert", "a\nc", "a\nb\nc"},
+		{"delete", "a\nb\nc", "a\nc"},
+		{"change", "a\nb\nc", "a\nB\nc"},
+		{"prepend and append", "b", "a\nb\nc"},
+		{"reorder", "a\nb\nc\nd", "d\nc\nb\na"},
+		{"blank lines", "a\n\nb\n", "a\n\n\nb\n\n"},
+		{"trailing newline", "a", "a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyDelta(tt.from, makeDelta(tt.from, tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.to {
+				t.Errorf("applyDelta = %q; want %q", got, tt.to)
+			}
+		})
+	}
+	if _, err := applyDelta("a", makeDelta("a\nb\nc", "a\nc")); err == nil {
+		t.Error("applyDelta on the wrong base succeeded")
+	}
+}
+
+func TestWordCount(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"林冲夜奔。", 4},
+		{"hello world", 2},
+		{"第3回 Chapter3", 4},
+		{"「你好」，他说", 4},
+		{"カタカナ 한글", 6},
+	}
+	for _, tt := range tests {
+		if got := wordCount(tt.s); got != tt.want {
+			t.Errorf("wordCount(%q) = %d; want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"same", "a\nb", "a\nb", ""},
+		{"change", "a\nb\nc", "a\nB\nc", "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"from empty", "", "a", "@@ -0,0 +1 @@\n+a\n"},
+		{"to empty", "a\nb", "", "@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"two hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11", "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\ny",
+			"@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -8,4 +8,4 @@\n 8\n 9\n 10\n-11\n+y\n"},
+		{"one hunk across close changes", "1\n2\n3\n4\n5", "x\n2\n3\n4\ny",
+			"@@ -1,5 +1,5 @@\n-1\n+x\n 2\n 3\n 4\n-5\n+y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("a", "b", tt.a, tt.b)
+			if want := "--- a\n+++ b\n" + tt.want; got != want {
+				t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestParagraphDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []ParagraphChange
+	}{
+		{"same", "a\n\nb", "a\nb", []ParagraphChange{}},
+		{"added", "a\n\nc", "a\n\nb\n\nc", []ParagraphChange{{Op: "added", To: 2, New: "b"}}},
+		{"removed", "a\n\nb\n\nc", "a\n\nc", []ParagraphChange{{Op: "removed", From: 2, Old: "b"}}},
+		{"changed", "a\n\nb", "a\n\nB", []ParagraphChange{{Op: "changed", From: 2, To: 2, Old: "b", New: "B"}}},
+		{"changed and added", "a\n\nb", "A\n\nA2\n\nb", []ParagraphChange{{Op: "changed", From: 1, To: 1, Old: "a", New: "A"}, {Op: "added", To: 2, New: "A2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := paragraphDiff(tt.a, tt.b)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("paragraphDiff = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	s, id := testChapter(t, "原有正文")
+	var c models.Chapter
+	if err := s.DB.First(&c, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	// Write enough versions to pass a snapshot, each one paragraph longer
+	// and long enough that a delta is shorter than the text.
+	var lines []string
+	for i := 1; i <= snapshotEvery+2; i++ {
+		lines = append(lines, fmt.Sprintf("第%d段%s", i, strings.Repeat("文", 40)))
+		r, err := s.setContent(&c, strings.Join(lines, "\n\n"), fmt.Sprint(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r == nil {
+			t.Fatalf("version %d saved no revision", i)
+		}
+	}
+	if r, err := s.setContent(&c, c.Content, "unchanged"); err != nil || r != nil {
+		t.Fatalf("saving unchanged content = %v, %v; want no revision", r, err)
+	}
+	rs, err := s.ListRevisions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != snapshotEvery+3 {
+		t.Fatalf("got %d revisions, want %d", len(rs), snapshotEvery+3)
+	}
+	var rows []models.ChapterRevision
+	if err := s.DB.Where("chapter_id = ? AND snapshot = ?", id, true).Order("number asc").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	var snaps []int
+	for _, r := range rows {
+		snaps = append(snaps, r.Number)
+	}
+	if fmt.Sprint(snaps) != fmt.Sprint([]int{1, 2, snapshotEvery + 1}) {
+		t.Errorf("snapshots = %v", snaps)
+	}
+	for i, r := range rs {
+		got, err := s.GetRevision(r.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "原有正文"
+		if i > 0 {
+			want = strings.Join(lines[:i], "\n\n")
+		}
+		if got.Content != want {
+			t.Errorf("revision %d = %q; want %q", r.Number, got.Content, want)
+		}
+		if got.WordCount != wordCount(want) {
+			t.Errorf("revision %d counts %d words; want %d", r.Number, got.WordCount, wordCount(want))
+		}
+	}
+
+	d, err := s.DiffRevisions(rs[1].ID, 0, "paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Paragraphs) != snapshotEvery+1 || d.To.ID != rs[len(rs)-1].ID {
+		t.Errorf("diff to newest = %d changes to revision %d", len(d.Paragraphs), d.To.Number)
+	}
+	if _, err := s.RestoreRevision(rs[2].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.First(&c, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(lines[:2], "\n\n"); c.Content != want {
+		t.Errorf("restored content = %q; want %q", c.Content, want)
+	}
+	rs, _ = s.ListRevisions(id)
+	if last := rs[len(rs)-1]; last.Message != "恢复到第 3 版" {
+		t.Errorf("restore message = %q", last.Message)
+	}
+}
+
+func TestRevisionsStoreShortDeltasAsText(t *testing.T) {
+	s, id := testChapter(t, "")
+	var c models.Chapter
+	if err := s.DB.First(&c, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, content := range []string{"甲", "乙"} {
+		if _, err := s.setContent(&c, content, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var r models.ChapterRevision
+	if err := s.DB.Where("chapter_id = ? AND number = 2", id).First(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !r.Snapshot || r.Data != "乙" {
+		t.Errorf("revision 2 = snapshot %v, %q; want the text itself", r.Snapshot, r.Data)
+	}
+}
@@ -0,0 +1,265 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// SceneEvents is a scene with its events in narrative order.
+type SceneEvents struct {
+	models.Scene
+	Events []models.Event
+}
+
+// checkSpan rejects a scene span that runs past its chapter's content.
+func (s *Services) checkSpan(sc *models.Scene) error {
+	var c models.Chapter
+	if err := s.DB.First(&c, sc.ChapterID).Error; err != nil {
+		return &tool.FieldError{Field: "chapterID", Msg: fmt.Sprintf("chapter %d not found", sc.ChapterID)}
+	}
+	if n := len(paragraphStarts(c.Content)); sc.EndParagraph > n {
+		return &tool.FieldError{Field: "endParagraph", Msg: fmt.Sprintf("chapter %d has %d paragraphs", sc.ChapterID, n)}
+	}
+	return nil
+}
+
+// CreateScene adds a scene to its chapter at 1-based position pos (0 for
+// the end) and renumbers the chapter's scenes.
+func (s *Services) CreateScene(sc *models.Scene, pos int) (*models.Scene, error) {
+	if err := validateModel("scene", sc, nil); err != nil {
+		return nil, err
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		if err := t.checkSpan(sc); err != nil {
+			return err
+		}
+		if err := tx.Create(sc).Error; err != nil {
+			return err
+		}
+		return t.place(&models.Scene{}, "chapter_id", sc.ID, sc.ChapterID, sc.ChapterID, pos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sc, s.DB.First(sc, sc.ID).Error
+}
+
+// UpdateScene changes the given fields of a scene.
+func (s *Services) UpdateScene(sceneID uint, fields map[string]any) (*models.Scene, error) {
+	var sc *models.Scene
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		t := &Services{DB: tx}
+		m, err := t.UpdateEntity("scene", sceneID, fields)
+		if err != nil {
+			return err
+		}
+		sc = m.(*models.Scene)
+		return t.checkSpan(sc)
+	})
+	return sc, err
+}
+
+// ReorderScenes numbers a chapter's scenes from 1 in the given order.
+func (s *Services) ReorderScenes(chapterID uint, order []uint) ([]SceneEvents, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		return (&Services{DB: tx}).reorder(&models.Scene{}, "chapter_id", chapterID, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.ChapterScenes(chapterID)
+}
+
+// ChapterScenes lists a chapter's scenes in order, each with its events.
+func (s *Services) ChapterScenes(chapterID uint) ([]SceneEvents, error) {
+	if err := s.DB.First(&models.Chapter{}, chapterID).Error; err != nil {
+		return nil, err
+	}
+	var scs []models.Scene
+	if err := s.DB.Where("chapter_id = ?", chapterID).Order("`index` asc, id asc").Find(&scs).Error; err != nil {
+		return nil, err
+	}
+	out := []SceneEvents{}
+	for _, sc := range scs {
+		evs := []models.Event{}
+		if err := s.withLinks().Where("scene_id = ?", sc.ID).Order(narrative).Find(&evs).Error; err != nil {
+			return nil, err
+		}
+		out = append(out, SceneEvents{Scene: sc, Events: evs})
+	}
+	return out, nil
+}
+
+// sceneChapter is the chapter of a scene.
+func (s *Services) sceneChapter(sceneID uint) (uint, error) {
+	var sc models.Scene
+	if err := s.DB.First(&sc, sceneID).Error; err != nil {
+		return 0, &tool.FieldError{Field: "sceneID", Msg: fmt.Sprintf("scene %d not found", sceneID)}
+	}
+	return sc.ChapterID, nil
+}
+
+// checkScene rejects an event whose scene is missing or in another chapter.
+func (s *Services) checkScene(e *models.Event) error {
+	if e.SceneID == 0 {
+		return nil
+	}
+	chapterID, err := s.sceneChapter(e.SceneID)
+	if err != nil {
+		return err
+	}
+	if chapterID != e.ChapterID {
+		return &tool.FieldError{Field: "sceneID", Msg: fmt.Sprintf("scene %d is in chapter %d, not %d", e.SceneID, chapterID, e.ChapterID)}
+	}
+	return nil
+}
+
+// dropForeignScenes clears the scene of every event of a chapter whose
+// scene is not in that chapter, as after the event moved chapters.
+func (s *Services) dropForeignScenes(chapterID uint) error {
+	own := s.DB.Model(&models.Scene{}).Select("id").Where("chapter_id = ?", chapterID)
+	return s.DB.Model(&models.Event{}).Where("chapter_id = ? AND scene_id <> 0 AND scene_id NOT IN (?)", chapterID, own).UpdateColumn("scene_id", 0).Error
+}
+
+// moveSpans keeps a chapter's scene spans on the same paragraphs when its
+// content changes from old to content. A paragraph the change adds belongs
+// to the scene of the paragraph before it, or after it at the very start; a
+// scene left without paragraphs gets an empty span.
+func (s *Services) moveSpans(chapterID uint, old, content string) error {
+	var scs []models.Scene
+	if err := s.DB.Where("chapter_id = ? AND start_paragraph > 0", chapterID).Order("`index` asc, id asc").Find(&scs).Error; err != nil || len(scs) == 0 {
+		return err
+	}
+	before := paragraphs(old)
+	owner := make([]uint, len(before))
+	for _, sc := range scs {
+		for p := sc.StartParagraph; p <= sc.EndParagraph && p <= len(owner); p++ {
+			owner[p-1] = sc.ID
+		}
+	}
+	spans := map[uint][2]int{}
+	own := func(id uint, p int) {
+		if id == 0 {
+			return
+		}
+		if sp, ok := spans[id]; ok {
+			spans[id] = [2]int{min(sp[0], p), max(sp[1], p)}
+		} else {
+			spans[id] = [2]int{p, p}
+		}
+	}
+	var prev uint
+	seen := false
+	var top []int
+	for _, e := range diffLines(before, paragraphs(content)) {
+		switch e.Op {
+		case ' ', '-':
+			prev, seen = owner[e.A], true
+			for _, p := range top {
+				own(prev, p)
+			}
+			top = nil
+			if e.Op == ' ' {
+				own(prev, e.B+1)
+			}
+		case '+':
+			if seen {
+				own(prev, e.B+1)
+			} else {
+				top = append(top, e.B+1)
+			}
+		}
+	}
+	for _, sc := range scs {
+		sp := spans[sc.ID]
+		if sp[0] == sc.StartParagraph && sp[1] == sc.EndParagraph {
+			continue
+		}
+		if err := s.DB.Model(&sc).UpdateColumns(map[string]any{"start_paragraph": sp[0], "end_paragraph": sp[1]}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitScenes moves the scenes of chapterID that start at or after its
+// paragraph-th paragraph to chapter to, renumbering their spans, and cuts
+// short a scene that runs across the split.
+func (s *Services) splitScenes(chapterID uint, paragraph int, to uint) error {
+	shift := paragraph - 1
+	if err := s.DB.Model(&models.Scene{}).Where("chapter_id = ? AND start_paragraph >= ?", chapterID, paragraph).UpdateColumns(map[string]any{
+		"chapter_id":      to,
+		"start_paragraph": gorm.Expr("start_paragraph - ?", shift),
+		"end_paragraph":   gorm.Expr("end_paragraph - ?", shift),
+	}).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Model(&models.Scene{}).Where("chapter_id = ? AND end_paragraph >= ?", chapterID, paragraph).UpdateColumn("end_paragraph", shift).Error; err != nil {
+		return err
+	}
+	for _, id := range []uint{chapterID, to} {
+		ids, err := s.siblings(&models.Scene{}, "chapter_id", id, 0)
+		if err != nil {
+			return err
+		}
+		if err := s.reindex(&models.Scene{}, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// absorbScenes moves the scenes of chapter from after those of chapterID,
+// whose content had n paragraphs before from's was appended to it.
+func (s *Services) absorbScenes(chapterID uint, from uint, n int) error {
+	ids, err := s.siblings(&models.Scene{}, "chapter_id", chapterID, 0)
+	if err != nil {
+		return err
+	}
+	moved, err := s.siblings(&models.Scene{}, "chapter_id", from, 0)
+	if err != nil || len(moved) == 0 {
+		return err
+	}
+	if err := s.DB.Model(&models.Scene{}).Where("id IN ? AND start_paragraph > 0", moved).UpdateColumns(map[string]any{
+		"start_paragraph": gorm.Expr("start_paragraph + ?", n),
+		"end_paragraph":   gorm.Expr("end_paragraph + ?", n),
+	}).Error; err != nil {
+		return err
+	}
+	if err := s.DB.Model(&models.Scene{}).Where("id IN ?", moved).UpdateColumn("chapter_id", chapterID).Error; err != nil {
+		return err
+	}
+	return s.reindex(&models.Scene{}, append(ids, moved...))
+}
+
+// sceneBreak marks where one scene ends and the next begins in exports.
+const sceneBreak = "* * *"
+
+// chapterText is a chapter's content with a scene break before each scene
+// that does not start at its first paragraph.
+func (s *Services) chapterText(c models.Chapter) (string, error) {
+	var at []int
+	if err := s.DB.Model(&models.Scene{}).Where("chapter_id = ? AND start_paragraph > 1", c.ID).Distinct().Order("start_paragraph asc").Pluck("start_paragraph", &at).Error; err != nil {
+		return "", err
+	}
+	starts := paragraphStarts(c.Content)
+	sep := paragraphSep(c.Content)
+	var b strings.Builder
+	last := 0
+	for _, p := range at {
+		if p > len(starts) {
+			break
+		}
+		off := starts[p-1]
+		b.WriteString(strings.TrimRight(c.Content[last:off], "\n"))
+		b.WriteString(sep + sceneBreak + sep)
+		last = off
+	}
+	b.WriteString(c.Content[last:])
+	return b.String(), nil
+}
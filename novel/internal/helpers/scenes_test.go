@@ -0,0 +1,154 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"strings"
+	"testing"
+)
+
+const fourParagraphs = "一\n\n二\n\n三\n\n四"
+
+// sceneStory gives testStory's chapter four paragraphs and two scenes,
+// 1 over paragraphs 1-2 and 2 over 3-4.
+func sceneStory(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	if err := s.DB.Model(&models.Chapter{}).Where("id = 1").Update("content", fourParagraphs).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, sc := range []*models.Scene{
+		{ID: 1, ChapterID: 1, Index: 1, StartParagraph: 1, EndParagraph: 2},
+		{ID: 2, ChapterID: 1, Index: 2, StartParagraph: 3, EndParagraph: 4},
+	} {
+		if err := s.DB.Create(sc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+// spans lists a chapter's scenes in order as id:start-end.
+func spans(t *testing.T, s *Services, chapterID uint) string {
+	t.Helper()
+	var scs []models.Scene
+	if err := s.DB.Where("chapter_id = ?", chapterID).Order("`index` asc, id asc").Find(&scs).Error; err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, sc := range scs {
+		out = append(out, fmt.Sprintf("%d:%d-%d", sc.ID, sc.StartParagraph, sc.EndParagraph))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestMoveSpans(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unchanged paragraphs, changed text", "一\n\n二二\n\n三\n\n四", "1:1-2 2:3-4"},
+		{"added inside a scene", "一\n\n新\n\n二\n\n三\n\n四", "1:1-3 2:4-5"},
+		{"added at the start", "新\n\n" + fourParagraphs, "1:1-3 2:4-5"},
+		{"added at the end", fourParagraphs + "\n\n新", "1:1-2 2:3-5"},
+		{"added between scenes", "一\n\n二\n\n新\n\n三\n\n四", "1:1-3 2:4-5"},
+		{"removed from a scene", "一\n\n三\n\n四", "1:1-1 2:2-3"},
+		{"scene emptied", "三\n\n四", "1:0-0 2:1-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sceneStory(t)
+			var c models.Chapter
+			if err := s.DB.First(&c, 1).Error; err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.setContent(&c, tt.content, ""); err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(t, s, 1); got != tt.want {
+				t.Errorf("spans = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitAndMergeScenes(t *testing.T) {
+	tests := []struct {
+		name          string
+		paragraph     int
+		first, second string
+	}{
+		{"between scenes", 3, "1:1-2", "2:1-2"},
+		{"inside a scene", 2, "1:1-1", "2:2-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sceneStory(t)
+			r, err := s.SplitChapter(1, tt.paragraph, "下", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := spans(t, s, 1); got != tt.first {
+				t.Errorf("first chapter spans = %s; want %s", got, tt.first)
+			}
+			if got := spans(t, s, r.Second.ID); got != tt.second {
+				t.Errorf("second chapter spans = %s; want %s", got, tt.second)
+			}
+			if _, err := s.MergeChapters(1); err != nil {
+				t.Fatal(err)
+			}
+			// A scene cut short by the split stays short.
+			want := "1:1-2 2:3-4"
+			if tt.paragraph == 2 {
+				want = "1:1-1 2:3-4"
+			}
+			if got := spans(t, s, 1); got != want {
+				t.Errorf("merged spans = %s; want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestExportSceneBreaks(t *testing.T) {
+	tests := []struct {
+		name   string
+		scenes []*models.Scene
+		want   string
+	}{
+		{"none", nil, fourParagraphs},
+		{"from the first paragraph", []*models.Scene{{StartParagraph: 1, EndParagraph: 4}}, fourParagraphs},
+		{"two scenes", []*models.Scene{{StartParagraph: 1, EndParagraph: 2}, {StartParagraph: 3, EndParagraph: 4}}, "一\n\n二\n\n* * *\n\n三\n\n四"},
+		{"shared start", []*models.Scene{{StartParagraph: 2, EndParagraph: 2}, {StartParagraph: 2, EndParagraph: 3}}, "一\n\n* * *\n\n二\n\n三\n\n四"},
+		{"no span", []*models.Scene{{}}, fourParagraphs},
+		{"past the end", []*models.Scene{{StartParagraph: 9, EndParagraph: 9}}, fourParagraphs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testStory(t)
+			if err := s.DB.Model(&models.Chapter{}).Where("id = 1").Updates(map[string]any{"content": fourParagraphs, "title": "甲"}).Error; err != nil {
+				t.Fatal(err)
+			}
+			for _, sc := range tt.scenes {
+				sc.ChapterID = 1
+				if err := s.DB.Create(sc).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			r, err := s.ExportChapter(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Content != tt.want {
+				t.Errorf("export = %q; want %q", r.Content, tt.want)
+			}
+			v, err := s.ExportVolume(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "甲\n" + tt.want + "\n\n"; v.Content != want {
+				t.Errorf("volume export = %q; want %q", v.Content, want)
+			}
+		})
+	}
+}
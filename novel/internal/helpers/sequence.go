@@ -0,0 +1,229 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// narrative orders a chapter's events as they are told. Events written
+// before Seq existed share 0 and fall back to creation order.
+const narrative = "seq asc, id asc"
+
+// Placement puts an event right before or right after another event, in
+// that event's chapter. The zero Placement means the end of the chapter.
+type Placement struct {
+	Before uint
+	After  uint
+}
+
+// chapterEvents lists the IDs of a chapter's events in narrative order,
+// leaving out skip.
+func (s *Services) chapterEvents(chapterID uint, skip uint) ([]uint, error) {
+	var ids []uint
+	err := s.DB.Model(&models.Event{}).Where("chapter_id = ? AND id <> ?", chapterID, skip).Order(narrative).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// locate resolves where event eventID (0 for a new one) goes: the chapter
+// and the index among that chapter's other events, -1 meaning the end.
+func (s *Services) locate(eventID uint, chapterID uint, at Placement) (uint, int, error) {
+	if at.Before != 0 && at.After != 0 {
+		return 0, 0, &tool.FieldError{Field: "before", Msg: "give only one of before, after"}
+	}
+	ref, field := at.Before, "before"
+	if at.After != 0 {
+		ref, field = at.After, "after"
+	}
+	if ref == 0 {
+		if chapterID == 0 {
+			return 0, 0, &tool.FieldError{Field: "chapterID", Msg: "required unless before or after is given"}
+		}
+		return chapterID, -1, nil
+	}
+	if ref == eventID {
+		return 0, 0, &tool.FieldError{Field: field, Msg: "must name another event"}
+	}
+	var a models.Event
+	if err := s.DB.First(&a, ref).Error; err != nil {
+		return 0, 0, &tool.FieldError{Field: field, Msg: fmt.Sprintf("event %d not found", ref)}
+	}
+	if chapterID != 0 && chapterID != a.ChapterID {
+		return 0, 0, &tool.FieldError{Field: field, Msg: fmt.Sprintf("event %d is in chapter %d, not %d", ref, a.ChapterID, chapterID)}
+	}
+	ids, err := s.chapterEvents(a.ChapterID, eventID)
+	if err != nil {
+		return 0, 0, err
+	}
+	pos := slices.Index(ids, ref)
+	if at.After != 0 {
+		pos++
+	}
+	return a.ChapterID, pos, nil
+}
+
+// placeEvent moves an event into chapterID at index pos of the chapter's
+// other events (-1 for the end) and renumbers the chapter from 1. An event
+// that leaves its chapter leaves its scene too.
+func (s *Services) placeEvent(eventID uint, chapterID uint, pos int) error {
+	ids, err := s.chapterEvents(chapterID, eventID)
+	if err != nil {
+		return err
+	}
+	if pos < 0 || pos > len(ids) {
+		pos = len(ids)
+	}
+	if err := s.DB.Model(&models.Event{}).Where("id = ?", eventID).Update("chapter_id", chapterID).Error; err != nil {
+		return err
+	}
+	if err := s.dropForeignScenes(chapterID); err != nil {
+		return err
+	}
+	return s.renumber(slices.Insert(ids, pos, eventID))
+}
+
+func (s *Services) renumber(ids []uint) error {
+	for i, id := range ids {
+		if err := s.DB.Model(&models.Event{}).Where("id = ?", id).UpdateColumn("seq", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveEvent puts an event right before or after another one, moving it to
+// that event's chapter if needed.
+func (s *Services) MoveEvent(eventID uint, at Placement) (*models.Event, error) {
+	if at.Before == 0 && at.After == 0 {
+		return nil, &tool.FieldError{Field: "before", Msg: "one of before, after is required"}
+	}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		if err := tx.First(&models.Event{}, eventID).Error; err != nil {
+			return err
+		}
+		chID, pos, err := sc.locate(eventID, 0, at)
+		if err != nil {
+			return err
+		}
+		return sc.placeEvent(eventID, chID, pos)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEvent(eventID)
+}
+
+// ReorderEvents sets the narrative order of a chapter's events; order must
+// list each of them exactly once.
+func (s *Services) ReorderEvents(chapterID uint, order []uint) ([]models.Event, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		sc := &Services{DB: tx}
+		ids, err := sc.chapterEvents(chapterID, 0)
+		if err != nil {
+			return err
+		}
+		want := slices.Clone(ids)
+		got := slices.Clone(order)
+		slices.Sort(want)
+		slices.Sort(got)
+		if !slices.Equal(want, got) {
+			return &tool.FieldError{Field: "order", Msg: fmt.Sprintf("must list each event of chapter %d exactly once: %v", chapterID, want)}
+		}
+		return sc.renumber(order)
+	})
+	if err != nil {
+		return nil, err
+	}
+	evs := []models.Event{}
+	if err := s.withLinks().Where("chapter_id = ?", chapterID).Order(narrative).Find(&evs).Error; err != nil {
+		return nil, err
+	}
+	return evs, nil
+}
+
+// checkStoryTime requires an event's story time to fall inside its time
+// segment when it has both.
+func (s *Services) checkStoryTime(e *models.Event) error {
+	if e.StoryTime == nil || e.TimeSegmentID == 0 {
+		return nil
+	}
+	var ts models.TimeSegment
+	if err := s.DB.First(&ts, e.TimeSegmentID).Error; err != nil {
+		return nil
+	}
+	if e.StoryTime.Before(ts.Start) || e.StoryTime.After(ts.End) {
+		return &tool.FieldError{Field: "storyTime", Msg: fmt.Sprintf("must lie within time segment %s (%s – %s)", ts.Name, ts.Start.Format(time.RFC3339), ts.End.Format(time.RFC3339))}
+	}
+	return nil
+}
+
+// TimelineEntry is an event placed in story time: At is its StoryTime, or
+// the start of its time segment when it has none.
+type TimelineEntry struct {
+	At    time.Time
+	Event models.Event
+}
+
+// Timeline lists a novel's events in story-time order. Events at the same
+// moment keep their narrative order; events with neither a story time nor
+// a time segment are listed apart as Untimed.
+type Timeline struct {
+	Events  []TimelineEntry
+	Untimed []models.Event
+}
+
+func (s *Services) Timeline(novelID uint) (*Timeline, error) {
+	if err := s.DB.First(&models.Novel{}, novelID).Error; err != nil {
+		return nil, err
+	}
+	var vols []models.Volume
+	if err := s.DB.Where("novel_id = ?", novelID).Order("`index` asc, id asc").Find(&vols).Error; err != nil {
+		return nil, err
+	}
+	// Reading order of the novel's events, which breaks ties in story time.
+	var evs []models.Event
+	for _, v := range vols {
+		var chs []models.Chapter
+		if err := s.DB.Where("volume_id = ?", v.ID).Order("`index` asc, id asc").Find(&chs).Error; err != nil {
+			return nil, err
+		}
+		for _, c := range chs {
+			var ces []models.Event
+			if err := s.withLinks().Where("chapter_id = ?", c.ID).Order(narrative).Find(&ces).Error; err != nil {
+				return nil, err
+			}
+			evs = append(evs, ces...)
+		}
+	}
+	segs := map[uint]*models.TimeSegment{}
+	t := &Timeline{Events: []TimelineEntry{}, Untimed: []models.Event{}}
+	for _, e := range evs {
+		if e.StoryTime != nil {
+			t.Events = append(t.Events, TimelineEntry{At: *e.StoryTime, Event: e})
+			continue
+		}
+		if e.TimeSegmentID != 0 {
+			ts, ok := segs[e.TimeSegmentID]
+			if !ok {
+				ts = &models.TimeSegment{}
+				if err := s.DB.First(ts, e.TimeSegmentID).Error; err != nil {
+					ts = nil
+				}
+				segs[e.TimeSegmentID] = ts
+			}
+			if ts != nil {
+				t.Events = append(t.Events, TimelineEntry{At: ts.Start, Event: e})
+				continue
+			}
+		}
+		t.Untimed = append(t.Untimed, e)
+	}
+	sort.SliceStable(t.Events, func(i, j int) bool { return t.Events[i].At.Before(t.Events[j].At) })
+	return t, nil
+}
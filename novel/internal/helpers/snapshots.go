@@ -0,0 +1,354 @@
+package helpers
+
+import (
+	"cmp"
+	"fmt"
+	"mcpnovel/internal/chrono"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"slices"
+	"strings"
+)
+
+// CharacterSnapshot is the state of a character as of an event, or as of
+// the end of a time segment: whether they are alive, where they were last
+// seen, what they hold, what they can do, what they remember, who they
+// stand with and which organizations they belong to.
+type CharacterSnapshot struct {
+	Character     models.Character
+	EventID       uint
+	TimeSegmentID uint
+	Status        string
+	Location      *Sighting
+	Items         []HeldItem
+	Abilities     []AbilityState
+	Memories      []models.Memory
+	Relationships []models.CharacterRelationship
+	Organizations []Member
+}
+
+// LocationSnapshot is the state of a location at the same kind of point:
+// the characters last seen there or within it and what it holds.
+type LocationSnapshot struct {
+	Location      models.Location
+	EventID       uint
+	TimeSegmentID uint
+	Characters    []Sighting
+	Items         []HeldItem
+}
+
+// Sighting is the last event at which a character was present (as
+// protagonist or observer) somewhere, and the place.
+type Sighting struct {
+	CharacterID uint
+	Name        string
+	Status      string `json:",omitempty"`
+	EventID     uint
+	LocationID  uint
+	Location    string
+}
+
+// HeldItem is how much of an item a holder has.
+type HeldItem struct {
+	ItemID   uint
+	Name     string
+	Quantity int
+}
+
+// AbilityState is an ability with its level as of the snapshot, how often
+// it had been used by then and the event of its last use.
+type AbilityState struct {
+	models.Ability
+	Uses            int
+	LastUsedEventID uint
+}
+
+// at says what point a snapshot is of.
+func at(eventID, timeSegmentID uint) string {
+	if eventID != 0 {
+		return fmt.Sprintf("事件 %d 时", eventID)
+	}
+	return fmt.Sprintf("时间段 %d 结束时", timeSegmentID)
+}
+
+func (c CharacterSnapshot) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "人物 %d「%s」%s：%s", c.Character.ID, c.Character.Name, at(c.EventID, c.TimeSegmentID), c.Status)
+	if c.Location != nil {
+		fmt.Fprintf(&b, "\n所在：%s（事件 %d）", c.Location.Location, c.Location.EventID)
+	}
+	for _, it := range c.Items {
+		fmt.Fprintf(&b, "\n持有：%s ×%d", it.Name, it.Quantity)
+	}
+	for _, ab := range c.Abilities {
+		fmt.Fprintf(&b, "\n能力：%s %d 级，已使用 %d 次", ab.Name, ab.Level, ab.Uses)
+	}
+	for _, m := range c.Memories {
+		fmt.Fprintf(&b, "\n记忆：%s", m.Content)
+	}
+	for _, r := range c.Relationships {
+		fmt.Fprintf(&b, "\n关系：人物 %d %s（亲密度 %g）", r.BID, r.Type, r.Intimacy)
+	}
+	for _, m := range c.Organizations {
+		fmt.Fprintf(&b, "\n组织：%s %s", m.Organization, m.Rank)
+	}
+	return b.String()
+}
+
+func (l LocationSnapshot) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "地点 %d「%s」%s", l.Location.ID, l.Location.Name, at(l.EventID, l.TimeSegmentID))
+	for _, c := range l.Characters {
+		fmt.Fprintf(&b, "\n人物：%s（%s，事件 %d 在%s）", c.Name, c.Status, c.EventID, c.Location)
+	}
+	for _, it := range l.Items {
+		fmt.Fprintf(&b, "\n物品：%s ×%d", it.Name, it.Quantity)
+	}
+	return b.String()
+}
+
+// snapshotPoint is the point in the story a snapshot is taken at: an event,
+// or the end of a time segment. Exactly one of the two must be given.
+func (s *Services) snapshotPoint(eventID, timeSegmentID uint) (chrono.Order, chrono.Point, error) {
+	if (eventID == 0) == (timeSegmentID == 0) {
+		return nil, chrono.Point{}, &tool.FieldError{Field: "eventID", Msg: "give exactly one of eventID and timeSegmentID"}
+	}
+	o, err := chrono.Load(s.DB)
+	if err != nil {
+		return nil, chrono.Point{}, err
+	}
+	if eventID != 0 {
+		if err := s.checkEvent(eventID); err != nil {
+			return nil, chrono.Point{}, err
+		}
+		return o, o.Of(eventID), nil
+	}
+	var ts models.TimeSegment
+	if err := s.DB.First(&ts, timeSegmentID).Error; err != nil {
+		return nil, chrono.Point{}, &tool.FieldError{Field: "timeSegmentID", Msg: fmt.Sprintf("time segment %d not found", timeSegmentID)}
+	}
+	return o, chrono.Point{At: &ts.End}, nil
+}
+
+// happened reports whether eventID, 0 for the start of the story, is
+// certainly at or before p.
+func happened(o chrono.Order, eventID uint, p chrono.Point) bool {
+	return eventID == 0 || chrono.NotAfter(o.Of(eventID), p)
+}
+
+// sightings finds, for the characters given, or every character when none
+// are, the last event at or before p at which they were present at a
+// location.
+func (s *Services) sightings(o chrono.Order, p chrono.Point, characterIDs ...uint) (map[uint]Sighting, error) {
+	var rows []struct {
+		CharacterID uint
+		EventID     uint
+		LocationID  uint
+	}
+	q := s.DB.Table("event_participants").
+		Select("event_participants.character_id, events.id AS event_id, events.location_id").
+		Joins("JOIN events ON events.id = event_participants.event_id AND events.deleted_at IS NULL").
+		Where("event_participants.deleted_at IS NULL AND event_participants.role IN ? AND events.location_id <> 0", []string{"protagonist", "observer"})
+	if len(characterIDs) > 0 {
+		q = q.Where("event_participants.character_id IN ?", characterIDs)
+	}
+	if err := q.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := map[uint]Sighting{}
+	for _, r := range rows {
+		if !chrono.NotAfter(o.Of(r.EventID), p) {
+			continue
+		}
+		if last, ok := out[r.CharacterID]; ok && chrono.Before(o.Of(r.EventID), o.Of(last.EventID)) {
+			continue
+		}
+		out[r.CharacterID] = Sighting{CharacterID: r.CharacterID, EventID: r.EventID, LocationID: r.LocationID}
+	}
+	for id, sg := range out {
+		sg.Name = s.holderName(custody.Holder{CharacterID: id})
+		sg.Location = s.holderName(custody.Holder{LocationID: sg.LocationID})
+		out[id] = sg
+	}
+	return out, nil
+}
+
+// heldAt lists what h holds of each item as of p.
+func (s *Services) heldAt(o chrono.Order, p chrono.Point, h custody.Holder) ([]HeldItem, error) {
+	var items []models.Item
+	if err := s.DB.Order("id asc").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	out := []HeldItem{}
+	for _, it := range items {
+		ts, err := s.itemTransfers(o, it.ID)
+		if err != nil {
+			return nil, err
+		}
+		l, _ := custody.Replay(it, custody.AsOf(o, ts, p))
+		if n := l[h]; n > 0 {
+			out = append(out, HeldItem{ItemID: it.ID, Name: it.Name, Quantity: n})
+		}
+	}
+	return out, nil
+}
+
+// CharacterSnapshot returns the state of a character as of an event or the
+// end of a time segment, replaying everything recorded against events up
+// to that point. Relationships carry their type and intimacy as of then.
+func (s *Services) CharacterSnapshot(characterID, eventID, timeSegmentID uint) (*CharacterSnapshot, error) {
+	snap := &CharacterSnapshot{EventID: eventID, TimeSegmentID: timeSegmentID}
+	if err := s.DB.First(&snap.Character, characterID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "characterID", Msg: fmt.Sprintf("character %d not found", characterID)}
+	}
+	o, p, err := s.snapshotPoint(eventID, timeSegmentID)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Status, _, err = s.lifeStatusAt(o, snap.Character, p); err != nil {
+		return nil, err
+	}
+	seen, err := s.sightings(o, p, characterID)
+	if err != nil {
+		return nil, err
+	}
+	if sg, ok := seen[characterID]; ok {
+		snap.Location = &sg
+	}
+	if snap.Items, err = s.heldAt(o, p, custody.Holder{CharacterID: characterID}); err != nil {
+		return nil, err
+	}
+	if snap.Abilities, err = s.abilitiesAt(o, p, characterID); err != nil {
+		return nil, err
+	}
+	var mems []models.Memory
+	if err := s.DB.Where("character_id = ?", characterID).Order("id asc").Find(&mems).Error; err != nil {
+		return nil, err
+	}
+	snap.Memories = []models.Memory{}
+	for _, m := range mems {
+		if happened(o, m.EventID, p) {
+			snap.Memories = append(snap.Memories, m)
+		}
+	}
+	slices.SortStableFunc(snap.Memories, func(a, b models.Memory) int {
+		if a.EventID == 0 || b.EventID == 0 {
+			return cmp.Compare(min(a.EventID, 1), min(b.EventID, 1))
+		}
+		return chrono.Cmp(o.Of(a.EventID), o.Of(b.EventID))
+	})
+	if snap.Relationships, err = s.relationshipsAt(o, p, characterID); err != nil {
+		return nil, err
+	}
+	if snap.Organizations, err = s.membersAt(s.DB.Where("character_id = ?", characterID), o, &p); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// relationshipsAt lists how a character stood toward others as of p, each
+// relationship with its type and intimacy then.
+func (s *Services) relationshipsAt(o chrono.Order, p chrono.Point, characterID uint) ([]models.CharacterRelationship, error) {
+	var rels []models.CharacterRelationship
+	if err := s.DB.Where("a_id = ?", characterID).Order("id asc").Find(&rels).Error; err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	for _, r := range rels {
+		ids = append(ids, r.ID)
+	}
+	changes, err := s.relationshipChanges(o, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := []models.CharacterRelationship{}
+	for _, r := range rels {
+		if st := stateAt(o, r, changes[r.ID], &p); st != nil {
+			r.Type, r.Intimacy = st.Type, st.Intimacy
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// abilitiesAt lists the abilities a character had gained as of p, each
+// with its level then and its uses up to then.
+func (s *Services) abilitiesAt(o chrono.Order, p chrono.Point, characterID uint) ([]AbilityState, error) {
+	var abs []models.Ability
+	if err := s.DB.Where("character_id = ?", characterID).Order("id asc").Find(&abs).Error; err != nil {
+		return nil, err
+	}
+	ids := []uint{}
+	for _, ab := range abs {
+		ids = append(ids, ab.ID)
+	}
+	ups, err := s.abilityUpgrades(o, ids)
+	if err != nil {
+		return nil, err
+	}
+	var uses []models.AbilityUsage
+	if err := s.DB.Where("ability_id IN ?", ids).Order("id asc").Find(&uses).Error; err != nil {
+		return nil, err
+	}
+	out := []AbilityState{}
+	for _, ab := range abs {
+		if !happened(o, ab.EventID, p) {
+			continue
+		}
+		st := AbilityState{Ability: ab}
+		st.Level = levelAt(o, ab, ups[ab.ID], &p)
+		for _, u := range uses {
+			if u.AbilityID != ab.ID || u.EventID == 0 || !chrono.NotAfter(o.Of(u.EventID), p) {
+				continue
+			}
+			st.Uses++
+			if st.LastUsedEventID == 0 || !chrono.Before(o.Of(u.EventID), o.Of(st.LastUsedEventID)) {
+				st.LastUsedEventID = u.EventID
+			}
+		}
+		out = append(out, st)
+	}
+	return out, nil
+}
+
+// LocationSnapshot returns the state of a location as of an event or the
+// end of a time segment: the characters whose last sighting by then was
+// there or at a place within it, with their life status, and the items it
+// held.
+func (s *Services) LocationSnapshot(locationID, eventID, timeSegmentID uint) (*LocationSnapshot, error) {
+	snap := &LocationSnapshot{EventID: eventID, TimeSegmentID: timeSegmentID, Characters: []Sighting{}}
+	if err := s.DB.First(&snap.Location, locationID).Error; err != nil {
+		return nil, &tool.FieldError{Field: "locationID", Msg: fmt.Sprintf("location %d not found", locationID)}
+	}
+	o, p, err := s.snapshotPoint(eventID, timeSegmentID)
+	if err != nil {
+		return nil, err
+	}
+	within, err := s.subTree(&models.Location{}, locationID)
+	if err != nil {
+		return nil, err
+	}
+	seen, err := s.sightings(o, p)
+	if err != nil {
+		return nil, err
+	}
+	for _, sg := range seen {
+		if !slices.Contains(within, sg.LocationID) {
+			continue
+		}
+		var c models.Character
+		if err := s.DB.First(&c, sg.CharacterID).Error; err != nil {
+			continue
+		}
+		if sg.Status, _, err = s.lifeStatusAt(o, c, p); err != nil {
+			return nil, err
+		}
+		snap.Characters = append(snap.Characters, sg)
+	}
+	slices.SortFunc(snap.Characters, func(a, b Sighting) int { return cmp.Compare(a.CharacterID, b.CharacterID) })
+	if snap.Items, err = s.heldAt(o, p, custody.Holder{LocationID: locationID}); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
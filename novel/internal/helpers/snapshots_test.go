@@ -0,0 +1,179 @@
+package helpers
+
+import (
+	"fmt"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"strings"
+	"testing"
+)
+
+// snapshotStory fills testStory with a little history: event 1 in 宫
+// (location 1), events 2 and 3 in 城 (location 2); a sword that 甲 gets at
+// event 1 and gives to 乙 at event 2; 甲's 剑法, upgraded at event 2 and
+// used at events 1 and 3, and 轻功, gained at event 3; memories; a
+// friendship that turns to enmity at event 3; and an organization 甲 joins
+// at event 2. 乙 dies at event 3.
+func snapshotStory(t *testing.T) *Services {
+	t.Helper()
+	s := testStory(t)
+	for id, loc := range map[uint]uint{1: 1, 2: 2, 3: 2} {
+		if err := s.DB.Model(&models.Event{}).Where("id = ?", id).Update("location_id", loc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	parts := map[uint][]models.EventParticipant{
+		1: {{CharacterID: 1, Role: "protagonist"}, {CharacterID: 2, Role: "observer"}},
+		2: {{CharacterID: 1, Role: "protagonist"}},
+		3: {{CharacterID: 2, Role: "mentioned"}},
+	}
+	for id, ps := range parts {
+		if err := s.SetEventParticipants(id, ps); err != nil {
+			t.Fatal(err)
+		}
+	}
+	it, err := s.CreateItem("剑", custody.Holder{CharacterID: 1}, 1, "", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.TransferItem(&models.ItemTransfer{ItemID: it.ID, FromCharacterID: 1, ToCharacterID: 2, EventID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	ab, err := s.CreateAbility(1, "剑法", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UpgradeAbility(ab.ID, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []uint{1, 3} {
+		if _, err := s.UseAbility(ab.ID, e, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.CreateAbility(1, "轻功", 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []uint{3, 0, 1} {
+		if _, err := s.CreateMemory(1, e, fmt.Sprintf("m%d", e), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SetCharacterRelationship(1, 2, "朋友", 0.5, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetCharacterRelationship(1, 2, "敌人", 0.1, 3, ""); err != nil {
+		t.Fatal(err)
+	}
+	o, err := s.CreateOrganization(&models.Organization{WorldID: 1, Name: "门"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddMembership(&models.OrganizationMembership{OrganizationID: o.ID, CharacterID: 1, JoinEventID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetCharacterStatus(2, 3, "dead", ""); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// summary puts a character snapshot on one line.
+func (c CharacterSnapshot) summary() string {
+	var parts []string
+	if c.Location != nil {
+		parts = append(parts, fmt.Sprintf("at %d@%d", c.Location.LocationID, c.Location.EventID))
+	}
+	for _, it := range c.Items {
+		parts = append(parts, fmt.Sprintf("%s×%d", it.Name, it.Quantity))
+	}
+	for _, ab := range c.Abilities {
+		parts = append(parts, fmt.Sprintf("%s L%d used %d last %d", ab.Name, ab.Level, ab.Uses, ab.LastUsedEventID))
+	}
+	for _, m := range c.Memories {
+		parts = append(parts, m.Content)
+	}
+	for _, r := range c.Relationships {
+		parts = append(parts, fmt.Sprintf("%s→%d", r.Type, r.BID))
+	}
+	for _, m := range c.Organizations {
+		parts = append(parts, m.Organization)
+	}
+	return c.Status + "; " + strings.Join(parts, "; ")
+}
+
+// summary lists who was last seen at a location snapshot, and where.
+func (l LocationSnapshot) summary() string {
+	var parts []string
+	for _, sg := range l.Characters {
+		parts = append(parts, fmt.Sprintf("%d %s at %d@%d", sg.CharacterID, sg.Status, sg.LocationID, sg.EventID))
+	}
+	for _, it := range l.Items {
+		parts = append(parts, fmt.Sprintf("%s×%d", it.Name, it.Quantity))
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestCharacterSnapshot(t *testing.T) {
+	tests := []struct {
+		name      string
+		character uint
+		event     uint
+		want      string
+	}{
+		{"before the upgrade", 1, 1, "alive; at 1@1; 剑×1; 剑法 L1 used 1 last 1; m0; m1; 朋友→2"},
+		{"after the transfer and joining", 1, 2, "alive; at 2@2; 剑法 L3 used 1 last 1; m0; m1; 朋友→2; 门"},
+		{"after the falling out", 1, 3, "alive; at 2@2; 剑法 L3 used 2 last 3; 轻功 L1 used 0 last 0; m0; m1; m3; 敌人→2; 门"},
+		{"receiver", 2, 2, "alive; at 1@1; 剑×1"},
+		{"mentioned after death", 2, 3, "dead; at 1@1; 剑×1"},
+	}
+	s := snapshotStory(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap, err := s.CharacterSnapshot(tt.character, tt.event, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := snap.summary(); got != tt.want {
+				t.Errorf("snapshot = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocationSnapshot(t *testing.T) {
+	tests := []struct {
+		name     string
+		location uint
+		event    uint
+		want     string
+	}{
+		{"seen within", 2, 1, "1 alive at 1@1; 2 alive at 1@1"},
+		{"seen there", 1, 1, "1 alive at 1@1; 2 alive at 1@1"},
+		{"moved on", 1, 2, "2 alive at 1@1"},
+		{"moved in", 2, 2, "1 alive at 2@2; 2 alive at 1@1"},
+		{"died", 1, 3, "2 dead at 1@1"},
+	}
+	s := snapshotStory(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snap, err := s.LocationSnapshot(tt.location, tt.event, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := snap.summary(); got != tt.want {
+				t.Errorf("snapshot = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotPoint(t *testing.T) {
+	s := snapshotStory(t)
+	if _, err := s.CharacterSnapshot(1, 0, 0); err == nil {
+		t.Error("snapshot with no point succeeded")
+	}
+	if _, err := s.LocationSnapshot(9, 1, 0); err == nil {
+		t.Error("snapshot of a missing location succeeded")
+	}
+}
@@ -0,0 +1,1384 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"mcpnovel/internal/custody"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+	"reflect"
+	"time"
+)
+
+type entityKind string
+
+func (entityKind) Enum() []string {
+	return []string{"world", "period", "timeSegment", "location", "character", "novel", "volume", "chapter"}
+}
+
+type modelKind string
+
+func (modelKind) Enum() []string { return ModelKinds }
+
+type listEntityKind string
+
+func (listEntityKind) Enum() []string {
+	return append(entityKind("").Enum(), "event", "item", "ability", "memory", "plotThread", "organization")
+}
+
+type chapterStatus string
+
+func (chapterStatus) Enum() []string { return models.ChapterStatuses }
+
+type participantRole string
+
+func (participantRole) Enum() []string { return models.ParticipantRoles }
+
+type plotStage string
+
+func (plotStage) Enum() []string { return models.PlotStages }
+
+type idArgs struct {
+	ID uint `json:"id" schema:"required,minimum=1" desc:"目标 ID"`
+}
+
+type novelRefArgs struct {
+	ID         uint   `json:"id" desc:"小说 ID，与 novelTitle 二选一"`
+	NovelTitle string `json:"novelTitle" desc:"小说标题，id 为空时按标题查找"`
+}
+
+type parentRefs struct {
+	WorldID  uint `json:"worldID" desc:"所属世界 ID（period、location、organization）"`
+	PeriodID uint `json:"periodID" desc:"所属时期 ID（timeSegment）"`
+	NovelID  uint `json:"novelID" desc:"所属小说 ID（volume）；world、character、location 按该小说的成员查找"`
+	VolumeID uint `json:"volumeID" desc:"所属分卷 ID（chapter）"`
+}
+
+type sqlGetByIDArgs struct {
+	Entity entityKind `json:"entity" schema:"required" desc:"实体类型"`
+	ID     uint       `json:"id" schema:"required,minimum=1" desc:"实体 ID"`
+}
+
+type sqlFindByNameArgs struct {
+	Entity     entityKind `json:"entity" schema:"required" desc:"实体类型"`
+	Name       string     `json:"name" desc:"名称（world、period、timeSegment、location、character）"`
+	Title      string     `json:"title" desc:"标题（novel、volume、chapter）"`
+	PreferName bool       `json:"preferName" desc:"character 的名称既是某人本名又是他人别名时只取本名匹配"`
+	parentRefs
+}
+
+type sqlListArgs struct {
+	Entity listEntityKind `json:"entity" schema:"required" desc:"实体类型"`
+	parentRefs
+}
+
+type novelCreateArgs struct {
+	Title       string `json:"title" schema:"required" desc:"小说标题"`
+	Description string `json:"description" desc:"小说简介"`
+}
+
+type volumeCreateArgs struct {
+	NovelID uint   `json:"novelID" schema:"required,minimum=1" desc:"所属小说 ID"`
+	Title   string `json:"title" schema:"required" desc:"分卷标题"`
+	Index   int    `json:"index" desc:"分卷序号"`
+}
+
+type chapterCreateArgs struct {
+	VolumeID uint          `json:"volumeID" schema:"required,minimum=1" desc:"所属分卷 ID"`
+	Title    string        `json:"title" schema:"required" desc:"章节标题"`
+	Index    int           `json:"index" desc:"章节在分卷内的序号"`
+	Status   chapterStatus `json:"status" desc:"章节状态"`
+}
+
+type chapterUpdateArgs struct {
+	ID      uint           `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Title   *string        `json:"title" desc:"章节标题"`
+	Status  *chapterStatus `json:"status" desc:"章节状态"`
+	Content *string        `json:"content" desc:"章节正文（整章覆盖）"`
+	Message string         `json:"message" desc:"正文修改说明，记入版本历史"`
+}
+
+type chapterAppendArgs struct {
+	ID      uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Text    string `json:"text" schema:"required,minLength=1" desc:"追加的正文，可含多段"`
+	Message string `json:"message" desc:"正文修改说明，记入版本历史"`
+}
+
+type chapterInsertArgs struct {
+	ID        uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Paragraph int    `json:"paragraph" schema:"required,minimum=1" desc:"插到第几段之前，从 1 计数，空行不算段落；段落数加 1 表示末尾"`
+	Text      string `json:"text" schema:"required,minLength=1" desc:"插入的正文，可含多段"`
+	Message   string `json:"message" desc:"正文修改说明，记入版本历史"`
+}
+
+type chapterReplaceArgs struct {
+	ID      uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	From    int    `json:"from" schema:"required,minimum=1" desc:"替换的起始段，从 1 计数，空行不算段落"`
+	To      int    `json:"to" schema:"minimum=0" desc:"替换的结束段（含），为空时只替换 from 一段"`
+	Text    string `json:"text" desc:"替换后的正文，可含多段；为空时删除这些段落"`
+	Message string `json:"message" desc:"正文修改说明，记入版本历史"`
+}
+
+type chapterFindReplaceArgs struct {
+	ID      uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Find    string `json:"find" schema:"required,minLength=1" desc:"要替换的原文，须在章节中恰好出现一次"`
+	Replace string `json:"replace" desc:"替换后的文字，为空时删除原文"`
+	Message string `json:"message" desc:"正文修改说明，记入版本历史"`
+}
+
+type revisionArgs struct {
+	RevisionID uint `json:"revisionID" schema:"required,minimum=1" desc:"版本 ID"`
+}
+
+type revisionDiffArgs struct {
+	From uint   `json:"from" schema:"required,minimum=1" desc:"旧版本 ID"`
+	To   uint   `json:"to" desc:"新版本 ID，为空时与同一章节的最新版本比较"`
+	Mode string `json:"mode" schema:"enum=unified|paragraph" desc:"unified 输出统一差异格式（默认），paragraph 按段落列出增删改"`
+}
+
+type revisionRestoreArgs struct {
+	RevisionID uint   `json:"revisionID" schema:"required,minimum=1" desc:"要恢复的版本 ID"`
+	Message    string `json:"message" desc:"版本说明，默认为“恢复到第 N 版”"`
+}
+
+type eventCreateArgs struct {
+	ChapterID       uint              `json:"chapterID" desc:"所属章节 ID，或以 novelTitle + volumeTitle + chapterTitle 指定"`
+	NovelTitle      string            `json:"novelTitle" desc:"小说标题"`
+	VolumeTitle     string            `json:"volumeTitle" desc:"分卷标题"`
+	ChapterTitle    string            `json:"chapterTitle" desc:"章节标题"`
+	SceneID         uint              `json:"sceneID" desc:"所属场景 ID，须在所属章节内；只给出 sceneID 时事件加入该场景所在章节"`
+	WorldID         uint              `json:"worldID" desc:"世界 ID，或以 worldName 指定"`
+	WorldName       string            `json:"worldName" desc:"世界名称，同时用于解析 locationName 与 periodName"`
+	LocationID      uint              `json:"locationID" desc:"地点 ID，或以 worldName + locationName 指定"`
+	LocationName    string            `json:"locationName" desc:"地点名称"`
+	TimeSegmentID   uint              `json:"timeSegmentID" desc:"时间段 ID，或以 worldName + periodName + timeSegmentName 指定"`
+	PeriodName      string            `json:"periodName" desc:"时期名称"`
+	TimeSegmentName string            `json:"timeSegmentName" desc:"时间段名称"`
+	StoryTime       *time.Time        `json:"storyTime" desc:"故事内时间，RFC3339，须落在所属时间段内"`
+	Before          uint              `json:"before" desc:"插入到该事件之前（同章节），可省略 chapterID"`
+	After           uint              `json:"after" desc:"插入到该事件之后（同章节），可省略 chapterID"`
+	Description     string            `json:"description" schema:"required" desc:"事件描述"`
+	Characters      []uint            `json:"characters" desc:"参与人物 ID 列表，角色为 protagonist"`
+	CharacterNames  []string          `json:"characterNames" desc:"参与人物姓名或别名列表，characters 为空时使用；无法解析或有歧义时报错"`
+	PreferName      bool              `json:"preferName" desc:"characterNames 中的名称既是某人本名又是他人别名时只取本名匹配"`
+	Participants    []participantArgs `json:"participants" desc:"带角色的参与人物，与 characters 合并"`
+	Items           []uint            `json:"items" desc:"涉及物品 ID 列表，角色为 protagonist"`
+	ItemLinks       []itemLinkArgs    `json:"itemLinks" desc:"带角色的涉及物品，与 items 合并"`
+}
+
+type participantArgs struct {
+	CharacterID uint            `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	Role        participantRole `json:"role" desc:"人物在事件中的角色，默认 protagonist"`
+}
+
+type itemLinkArgs struct {
+	ItemID uint            `json:"itemID" schema:"required,minimum=1" desc:"物品 ID"`
+	Role   participantRole `json:"role" desc:"物品在事件中的角色，默认 protagonist"`
+}
+
+// participants merges plain character IDs, which take the default role,
+// with role-bearing entries; nil when neither was given.
+func participants(ids []uint, with []participantArgs) []models.EventParticipant {
+	if ids == nil && with == nil {
+		return nil
+	}
+	out := []models.EventParticipant{}
+	for _, id := range ids {
+		out = append(out, models.EventParticipant{CharacterID: id})
+	}
+	for _, p := range with {
+		out = append(out, models.EventParticipant{CharacterID: p.CharacterID, Role: string(p.Role)})
+	}
+	return out
+}
+
+// itemLinks is participants for items.
+func itemLinks(ids []uint, with []itemLinkArgs) []models.EventItem {
+	if ids == nil && with == nil {
+		return nil
+	}
+	out := []models.EventItem{}
+	for _, id := range ids {
+		out = append(out, models.EventItem{ItemID: id})
+	}
+	for _, it := range with {
+		out = append(out, models.EventItem{ItemID: it.ItemID, Role: string(it.Role)})
+	}
+	return out
+}
+
+type eventMoveArgs struct {
+	ID     uint `json:"id" schema:"required,minimum=1" desc:"事件 ID"`
+	Before uint `json:"before" desc:"移到该事件之前，可跨章节"`
+	After  uint `json:"after" desc:"移到该事件之后，可跨章节"`
+}
+
+type eventReorderArgs struct {
+	ChapterID uint   `json:"chapterID" schema:"required,minimum=1" desc:"章节 ID"`
+	Order     []uint `json:"order" schema:"required" desc:"章节内全部事件 ID，按叙事顺序排列"`
+}
+
+type characterEventsArgs struct {
+	CharacterID uint            `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	Role        participantRole `json:"role" desc:"只列出人物以该角色参与的事件"`
+}
+
+type worldCreateArgs struct {
+	Name        string `json:"name" schema:"required" desc:"世界名称"`
+	Description string `json:"description" desc:"世界描述"`
+	NovelID     uint   `json:"novelID" desc:"创建后加入的小说 ID"`
+}
+
+type periodCreateArgs struct {
+	WorldID uint   `json:"worldID" schema:"required,minimum=1" desc:"所属世界 ID"`
+	Name    string `json:"name" schema:"required" desc:"时期名称"`
+	Index   int    `json:"index" desc:"时期序号"`
+}
+
+type timeSegmentCreateArgs struct {
+	PeriodID uint      `json:"periodID" schema:"required,minimum=1" desc:"所属时期 ID"`
+	Name     string    `json:"name" schema:"required" desc:"时间段名称"`
+	Start    time.Time `json:"start" schema:"required" desc:"开始时间，RFC3339"`
+	End      time.Time `json:"end" schema:"required" desc:"结束时间，RFC3339，不早于开始时间"`
+}
+
+type characterCreateArgs struct {
+	Name               string `json:"name" schema:"required" desc:"人物姓名"`
+	Bio                string `json:"bio" desc:"人物简介"`
+	BirthTimeSegmentID uint   `json:"birthTimeSegmentID" desc:"出生所在的时间段 ID"`
+	NovelID            uint   `json:"novelID" desc:"创建后加入的小说 ID"`
+}
+
+type novelWorldArgs struct {
+	NovelID uint `json:"novelID" schema:"required,minimum=1" desc:"小说 ID"`
+	WorldID uint `json:"worldID" schema:"required,minimum=1" desc:"世界 ID"`
+}
+
+type novelCharacterArgs struct {
+	NovelID     uint `json:"novelID" schema:"required,minimum=1" desc:"小说 ID"`
+	CharacterID uint `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+}
+
+type characterAliasArgs struct {
+	CharacterID uint   `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	Name        string `json:"name" schema:"required,minLength=1" desc:"别名，不同人物可共用"`
+	Kind        string `json:"kind" desc:"别名类别，如字、号、绰号、封号"`
+}
+
+type characterRefArgs struct {
+	CharacterID uint `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+}
+
+type lifeStatus string
+
+func (lifeStatus) Enum() []string { return models.LifeStatuses }
+
+type characterStatusArgs struct {
+	CharacterID uint       `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	EventID     uint       `json:"eventID" schema:"required,minimum=1" desc:"状态变化发生的事件 ID"`
+	Status      lifeStatus `json:"status" schema:"required" desc:"变化后的状态：alive 存活，dead 死亡，missing 失踪，sealed 封印，resurrected 复活"`
+	Note        string     `json:"note" desc:"说明，如死因"`
+}
+
+type characterStatusAtArgs struct {
+	CharacterID uint `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	EventID     uint `json:"eventID" schema:"required,minimum=1" desc:"事件 ID"`
+}
+
+type relationshipSetArgs struct {
+	AID      uint    `json:"aid" schema:"required,minimum=1" desc:"人物 A 的 ID"`
+	BID      uint    `json:"bid" schema:"required,minimum=1" desc:"人物 B 的 ID"`
+	Type     string  `json:"type" desc:"A 对 B 的关系类型，如 同盟、师徒、暗恋、仇视"`
+	Intimacy float64 `json:"intimacy" schema:"minimum=0,maximum=1" desc:"A 对 B 的亲密度，0 到 1 之间"`
+	EventID  uint    `json:"eventID" desc:"关系变化发生的事件 ID；为空表示故事开始前的关系"`
+	Note     string  `json:"note" desc:"变化说明"`
+}
+
+type relationshipAtArgs struct {
+	AID     uint `json:"aid" schema:"required,minimum=1" desc:"人物 A 的 ID"`
+	BID     uint `json:"bid" schema:"required,minimum=1" desc:"人物 B 的 ID"`
+	EventID uint `json:"eventID" desc:"事件 ID，查询该事件时的关系；为空时查询当前关系"`
+}
+
+type relationshipPairArgs struct {
+	AID uint `json:"aid" schema:"required,minimum=1" desc:"人物 A 的 ID"`
+	BID uint `json:"bid" schema:"required,minimum=1" desc:"人物 B 的 ID"`
+}
+
+type relationshipTypeArgs struct {
+	Name        string `json:"name" schema:"required,minLength=1" desc:"关系类型名称，与 set 的 type 对应"`
+	Symmetric   bool   `json:"symmetric" desc:"是否对称：为真时设置 A 对 B 也同时设置 B 对 A，如 同盟、结义"`
+	Description string `json:"description" desc:"说明"`
+}
+
+type noArgs struct{}
+
+type locationCreateArgs struct {
+	WorldID     uint   `json:"worldID" schema:"required,minimum=1" desc:"所属世界 ID"`
+	ParentID    uint   `json:"parentID" desc:"所在的上级地点 ID，须在同一世界，如城市所在的国家"`
+	Name        string `json:"name" schema:"required" desc:"地点名称"`
+	Description string `json:"description" desc:"地点描述"`
+}
+
+type locationLinkType string
+
+func (locationLinkType) Enum() []string { return models.LocationLinkTypes }
+
+type locationLinkArgs struct {
+	AID         uint             `json:"aid" schema:"required,minimum=1" desc:"地点 A 的 ID"`
+	BID         uint             `json:"bid" schema:"required,minimum=1" desc:"地点 B 的 ID"`
+	Type        locationLinkType `json:"type" schema:"required" desc:"连接方式：adjacent 相邻，road 道路，portal 传送阵"`
+	Distance    float64          `json:"distance" schema:"minimum=0" desc:"距离，单位由小说自定，为空表示未知"`
+	TravelHours *float64         `json:"travelHours" schema:"minimum=0" desc:"最快通行所需小时数，为空表示未知，不参与路线计算"`
+	OneWay      bool             `json:"oneWay" desc:"是否只能从 A 到 B"`
+}
+
+type routeArgs struct {
+	FromID uint `json:"fromID" schema:"required,minimum=1" desc:"出发地点 ID"`
+	ToID   uint `json:"toID" schema:"required,minimum=1" desc:"目的地点 ID"`
+}
+
+type organizationCreateArgs struct {
+	WorldID     uint   `json:"worldID" schema:"required,minimum=1" desc:"所属世界 ID"`
+	ParentID    uint   `json:"parentID" desc:"上级组织 ID，须在同一世界，如峰的上级是宗门"`
+	Name        string `json:"name" schema:"required,minLength=1" desc:"组织名称"`
+	Description string `json:"description" desc:"组织描述"`
+}
+
+type organizationUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"组织 ID"`
+	WorldID     *uint   `json:"worldID" schema:"minimum=1" desc:"所属世界 ID，下级组织随之迁移"`
+	ParentID    *uint   `json:"parentID" desc:"上级组织 ID，0 表示没有上级"`
+	Name        *string `json:"name" desc:"组织名称"`
+	Description *string `json:"description" desc:"组织描述"`
+}
+
+type membershipCreateArgs struct {
+	OrganizationID uint   `json:"organizationID" schema:"required,minimum=1" desc:"组织 ID"`
+	CharacterID    uint   `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	Rank           string `json:"rank" desc:"身份或职位，如内门弟子、长老、尚书"`
+	JoinEventID    uint   `json:"joinEventID" desc:"加入的事件 ID，为空表示故事开始前已加入"`
+	LeaveEventID   uint   `json:"leaveEventID" desc:"离开的事件 ID，为空表示尚未离开"`
+	Note           string `json:"note" desc:"说明"`
+}
+
+type membershipUpdateArgs struct {
+	ID           uint    `json:"id" schema:"required,minimum=1" desc:"成员记录 ID"`
+	Rank         *string `json:"rank" desc:"身份或职位；升迁请离开旧记录并在同一事件加入新记录"`
+	JoinEventID  *uint   `json:"joinEventID" desc:"加入的事件 ID，0 表示故事开始前"`
+	LeaveEventID *uint   `json:"leaveEventID" desc:"离开的事件 ID，0 表示尚未离开"`
+	Note         *string `json:"note" desc:"说明"`
+}
+
+type organizationRelationArgs struct {
+	AID       uint   `json:"aid" schema:"required,minimum=1" desc:"组织 A 的 ID"`
+	BID       uint   `json:"bid" schema:"required,minimum=1" desc:"组织 B 的 ID"`
+	Type      string `json:"type" desc:"关系类型，如 同盟、世仇、附庸"`
+	Exclusive bool   `json:"exclusive" desc:"互斥：人物不得同时属于双方（含其下级组织），冲突检测据此报告"`
+}
+
+type organizationMembersArgs struct {
+	OrganizationID uint `json:"organizationID" schema:"required,minimum=1" desc:"组织 ID"`
+	EventID        uint `json:"eventID" desc:"事件 ID，列出该事件时的成员；为空时列出全部成员记录"`
+	WithSub        bool `json:"withSub" desc:"是否包括下级组织的成员"`
+}
+
+type characterMembershipsArgs struct {
+	CharacterID uint `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	EventID     uint `json:"eventID" desc:"事件 ID，列出该事件时所属的组织；为空时列出全部成员记录"`
+}
+
+type itemCreateArgs struct {
+	Name        string `json:"name" schema:"required" desc:"物品名称"`
+	OwnerID     uint   `json:"ownerID" desc:"持有人物 ID"`
+	LocationID  uint   `json:"locationID" desc:"所在地点 ID"`
+	ContainerID uint   `json:"containerID" desc:"所在容器物品 ID；持有人物、地点、容器至多给一个"`
+	Quantity    int    `json:"quantity" schema:"minimum=0" desc:"数量，默认 1"`
+	Status      string `json:"status" desc:"物品状态"`
+	EventID     uint   `json:"eventID" desc:"物品出现的事件 ID"`
+}
+
+func (a itemCreateArgs) holder() custody.Holder {
+	return custody.Holder{CharacterID: a.OwnerID, LocationID: a.LocationID, ContainerItemID: a.ContainerID}
+}
+
+type itemTransferArgs struct {
+	ItemID          uint `json:"itemID" schema:"required,minimum=1" desc:"物品 ID"`
+	FromID          uint `json:"fromID" desc:"转出人物 ID；转出方都不给时取该事件时物品的唯一持有者"`
+	FromLocationID  uint `json:"fromLocationID" desc:"转出地点 ID"`
+	FromContainerID uint `json:"fromContainerID" desc:"转出容器物品 ID"`
+	ToID            uint `json:"toID" desc:"转入人物 ID；转入方须给且只给一个"`
+	ToLocationID    uint `json:"toLocationID" desc:"转入地点 ID"`
+	ToContainerID   uint `json:"toContainerID" desc:"转入容器物品 ID"`
+	Quantity        int  `json:"quantity" schema:"minimum=0" desc:"流转数量，为空时转出转出方的全部"`
+	EventID         uint `json:"eventID" desc:"发生流转的事件 ID；为空时视为在所有事件之后"`
+}
+
+func (a itemTransferArgs) transfer(kind string) *models.ItemTransfer {
+	return &models.ItemTransfer{
+		ItemID: a.ItemID, Kind: kind, Quantity: a.Quantity, EventID: a.EventID,
+		FromCharacterID: a.FromID, FromLocationID: a.FromLocationID, FromContainerItemID: a.FromContainerID,
+		ToCharacterID: a.ToID, ToLocationID: a.ToLocationID, ToContainerItemID: a.ToContainerID,
+	}
+}
+
+type itemDestroyArgs struct {
+	ItemID          uint `json:"itemID" schema:"required,minimum=1" desc:"物品 ID"`
+	FromID          uint `json:"fromID" desc:"持有人物 ID；都不给时取该事件时物品的唯一持有者"`
+	FromLocationID  uint `json:"fromLocationID" desc:"所在地点 ID"`
+	FromContainerID uint `json:"fromContainerID" desc:"所在容器物品 ID"`
+	Quantity        int  `json:"quantity" schema:"minimum=0" desc:"销毁或消耗的数量，为空时为持有的全部"`
+	EventID         uint `json:"eventID" desc:"销毁发生的事件 ID"`
+}
+
+type itemCustodyArgs struct {
+	ItemID  uint `json:"itemID" schema:"required,minimum=1" desc:"物品 ID"`
+	EventID uint `json:"eventID" desc:"事件 ID，查询该事件时的归属；为空时查询当前归属"`
+}
+
+type abilityCreateArgs struct {
+	CharacterID uint   `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	Name        string `json:"name" schema:"required" desc:"能力名称"`
+	Level       int    `json:"level" desc:"能力等级"`
+	EventID     uint   `json:"eventID" desc:"获得能力的事件 ID，为空表示故事开始时已有"`
+}
+
+type abilityUpgradeArgs struct {
+	AbilityID uint `json:"abilityID" schema:"required,minimum=1" desc:"能力 ID"`
+	Level     int  `json:"level" schema:"required" desc:"新等级"`
+	EventID   uint `json:"eventID" desc:"升级发生的事件 ID；为空时视为在所有事件之后"`
+}
+
+type abilityUseArgs struct {
+	AbilityID uint   `json:"abilityID" schema:"required,minimum=1" desc:"能力 ID"`
+	EventID   uint   `json:"eventID" desc:"使用能力的事件 ID"`
+	Note      string `json:"note" desc:"使用说明"`
+}
+
+type plotCreateArgs struct {
+	NovelID uint      `json:"novelID" schema:"required,minimum=1" desc:"所属小说 ID"`
+	Name    string    `json:"name" schema:"required" desc:"线索名称"`
+	Stage   plotStage `json:"stage" desc:"线索阶段"`
+}
+
+type plotUpdateArgs struct {
+	PlotID uint       `json:"plotID" schema:"required,minimum=1" desc:"线索 ID"`
+	Name   *string    `json:"name" desc:"线索名称"`
+	Stage  *plotStage `json:"stage" desc:"线索阶段"`
+}
+
+type memoryCreateArgs struct {
+	CharacterID uint   `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	EventID     uint   `json:"eventID" desc:"记忆来源事件 ID"`
+	Content     string `json:"content" schema:"required" desc:"记忆内容"`
+	Trigger     string `json:"trigger" desc:"触发条件"`
+}
+
+type styleSetArgs struct {
+	NovelID    uint   `json:"novelID" desc:"小说 ID，与 novelTitle 二选一"`
+	NovelTitle string `json:"novelTitle" desc:"小说标题"`
+	Content    string `json:"content" schema:"required" desc:"参考正文"`
+}
+
+type styleGetArgs struct {
+	NovelID    uint   `json:"novelID" desc:"小说 ID，与 novelTitle 二选一"`
+	NovelTitle string `json:"novelTitle" desc:"小说标题"`
+}
+
+type sqlCreateArgs struct {
+	Entity modelKind      `json:"entity" schema:"required" desc:"实体类型"`
+	Fields map[string]any `json:"fields" schema:"required" desc:"字段值，键为模型字段名（不区分大小写），如 {\"title\": \"第一卷\", \"novelID\": 1}"`
+}
+
+type sqlUpdateArgs struct {
+	Entity modelKind      `json:"entity" schema:"required" desc:"实体类型"`
+	ID     uint           `json:"id" schema:"required,minimum=1" desc:"实体 ID"`
+	Fields map[string]any `json:"fields" schema:"required" desc:"要修改的字段，未列出的字段保持不变"`
+}
+
+type sqlDeleteArgs struct {
+	Entity modelKind `json:"entity" schema:"required" desc:"实体类型"`
+	ID     uint      `json:"id" schema:"required,minimum=1" desc:"实体 ID"`
+	deleteOptionArgs
+}
+
+type deleteOptionArgs struct {
+	Events       string `json:"events" schema:"enum=delete|move" desc:"删除章节时其事件的处理方式：delete 一并删除（默认），move 移到 moveEventsTo"`
+	MoveEventsTo uint   `json:"moveEventsTo" desc:"events 为 move 时接收事件的章节 ID"`
+	Items        string `json:"items" schema:"enum=release|delete" desc:"删除人物时其持有物品的处理方式：release 解除持有（默认），delete 一并删除"`
+}
+
+func (a deleteOptionArgs) options() DeleteOptions {
+	return DeleteOptions{Events: a.Events, MoveEventsTo: a.MoveEventsTo, Items: a.Items}
+}
+
+type deleteArgs struct {
+	ID uint `json:"id" schema:"required,minimum=1" desc:"要删除的 ID"`
+}
+
+type chapterMoveArgs struct {
+	ID       uint `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	VolumeID uint `json:"volumeID" desc:"目标分卷 ID，为空时在原分卷内移动"`
+	Position int  `json:"position" schema:"minimum=0" desc:"在目标分卷中的位置，从 1 开始，为空时放到末尾"`
+}
+
+type chapterReorderArgs struct {
+	VolumeID uint   `json:"volumeID" schema:"required,minimum=1" desc:"分卷 ID"`
+	Order    []uint `json:"order" schema:"required" desc:"分卷内全部章节 ID，按新顺序排列"`
+}
+
+type sceneCreateArgs struct {
+	ChapterID      uint   `json:"chapterID" schema:"required,minimum=1" desc:"所属章节 ID"`
+	Title          string `json:"title" desc:"场景标题"`
+	POVCharacterID uint   `json:"povCharacterID" desc:"视角人物 ID"`
+	LocationID     uint   `json:"locationID" desc:"地点 ID"`
+	TimeSegmentID  uint   `json:"timeSegmentID" desc:"时间段 ID"`
+	Goal           string `json:"goal" desc:"场景目标"`
+	Conflict       string `json:"conflict" desc:"场景冲突"`
+	Outcome        string `json:"outcome" desc:"场景结果"`
+	StartParagraph int    `json:"startParagraph" schema:"minimum=0" desc:"场景在章节正文中的起始段，从 1 计数，空行不算段落；尚未写成时为 0"`
+	EndParagraph   int    `json:"endParagraph" schema:"minimum=0" desc:"场景的结束段（含）"`
+	Position       int    `json:"position" schema:"minimum=0" desc:"在章节场景中的位置，从 1 开始，为空时放到末尾"`
+}
+
+type sceneUpdateArgs struct {
+	ID             uint    `json:"id" schema:"required,minimum=1" desc:"场景 ID"`
+	Title          *string `json:"title" desc:"场景标题"`
+	POVCharacterID *uint   `json:"povCharacterID" desc:"视角人物 ID"`
+	LocationID     *uint   `json:"locationID" desc:"地点 ID"`
+	TimeSegmentID  *uint   `json:"timeSegmentID" desc:"时间段 ID"`
+	Goal           *string `json:"goal" desc:"场景目标"`
+	Conflict       *string `json:"conflict" desc:"场景冲突"`
+	Outcome        *string `json:"outcome" desc:"场景结果"`
+	StartParagraph *int    `json:"startParagraph" schema:"minimum=0" desc:"起始段，从 1 计数"`
+	EndParagraph   *int    `json:"endParagraph" schema:"minimum=0" desc:"结束段（含）"`
+}
+
+type sceneReorderArgs struct {
+	ChapterID uint   `json:"chapterID" schema:"required,minimum=1" desc:"章节 ID"`
+	Order     []uint `json:"order" schema:"required" desc:"章节内全部场景 ID，按新顺序排列"`
+}
+
+type chapterSplitArgs struct {
+	ID         uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Paragraph  int    `json:"paragraph" schema:"required,minimum=2" desc:"新章节从原章节的第几段开始，从 1 计数，空行不算段落"`
+	Title      string `json:"title" schema:"required" desc:"新章节标题"`
+	EventsFrom uint   `json:"eventsFrom" desc:"从该事件起（按叙事顺序）的事件移到新章节，为空时事件都留在原章节"`
+}
+
+type volumeMoveArgs struct {
+	ID       uint `json:"id" schema:"required,minimum=1" desc:"分卷 ID"`
+	NovelID  uint `json:"novelID" desc:"目标小说 ID，为空时在原小说内移动"`
+	Position int  `json:"position" schema:"minimum=0" desc:"在目标小说中的位置，从 1 开始，为空时放到末尾"`
+}
+
+type volumeReorderArgs struct {
+	NovelID uint   `json:"novelID" schema:"required,minimum=1" desc:"小说 ID"`
+	Order   []uint `json:"order" schema:"required" desc:"小说内全部分卷 ID，按新顺序排列"`
+}
+
+type chapterDeleteArgs struct {
+	ID           uint   `json:"id" schema:"required,minimum=1" desc:"章节 ID"`
+	Events       string `json:"events" schema:"enum=delete|move" desc:"事件的处理方式：delete 一并删除（默认），move 移到 moveEventsTo"`
+	MoveEventsTo uint   `json:"moveEventsTo" desc:"events 为 move 时接收事件的章节 ID"`
+}
+
+type characterDeleteArgs struct {
+	ID    uint   `json:"id" schema:"required,minimum=1" desc:"人物 ID"`
+	Items string `json:"items" schema:"enum=release|delete" desc:"持有物品的处理方式：release 解除持有（默认），delete 一并删除"`
+}
+
+type trashListArgs struct {
+	Entity modelKind `json:"entity" desc:"只列出该类型实体的删除记录"`
+	Limit  int       `json:"limit" schema:"minimum=0" desc:"最多返回的条数，0 表示不限"`
+}
+
+type trashRestoreArgs struct {
+	ID uint `json:"id" schema:"required,minimum=1" desc:"回收站记录 ID"`
+}
+
+type trashPurgeArgs struct {
+	OlderThanDays *float64 `json:"olderThanDays" schema:"minimum=0" desc:"清除多少天以前的删除记录，默认 30"`
+}
+
+type novelUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"小说 ID"`
+	Title       *string `json:"title" desc:"小说标题"`
+	Description *string `json:"description" desc:"小说简介"`
+}
+
+type volumeUpdateArgs struct {
+	ID    uint    `json:"id" schema:"required,minimum=1" desc:"分卷 ID"`
+	Title *string `json:"title" desc:"分卷标题"`
+}
+
+type eventUpdateArgs struct {
+	ID            uint              `json:"id" schema:"required,minimum=1" desc:"事件 ID"`
+	ChapterID     *uint             `json:"chapterID" schema:"minimum=1" desc:"所属章节 ID，换章时事件离开原场景"`
+	SceneID       *uint             `json:"sceneID" desc:"所属场景 ID，须在所属章节内，0 表示不属于任何场景"`
+	WorldID       *uint             `json:"worldID" desc:"世界 ID"`
+	LocationID    *uint             `json:"locationID" desc:"地点 ID"`
+	TimeSegmentID *uint             `json:"timeSegmentID" desc:"时间段 ID"`
+	StoryTime     *time.Time        `json:"storyTime" desc:"故事内时间，RFC3339，须落在所属时间段内"`
+	Description   *string           `json:"description" desc:"事件描述"`
+	Characters    []uint            `json:"characters" desc:"参与人物 ID 列表，与 participants 一起整体替换"`
+	Participants  []participantArgs `json:"participants" desc:"带角色的参与人物，与 characters 一起整体替换"`
+	Items         []uint            `json:"items" desc:"涉及物品 ID 列表，与 itemLinks 一起整体替换"`
+	ItemLinks     []itemLinkArgs    `json:"itemLinks" desc:"带角色的涉及物品，与 items 一起整体替换"`
+}
+
+type worldUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"世界 ID"`
+	Name        *string `json:"name" desc:"世界名称"`
+	Description *string `json:"description" desc:"世界描述"`
+}
+
+type periodUpdateArgs struct {
+	ID      uint    `json:"id" schema:"required,minimum=1" desc:"时期 ID"`
+	WorldID *uint   `json:"worldID" schema:"minimum=1" desc:"所属世界 ID"`
+	Name    *string `json:"name" desc:"时期名称"`
+	Index   *int    `json:"index" desc:"时期序号"`
+}
+
+type timeSegmentUpdateArgs struct {
+	ID       uint       `json:"id" schema:"required,minimum=1" desc:"时间段 ID"`
+	PeriodID *uint      `json:"periodID" schema:"minimum=1" desc:"所属时期 ID"`
+	Name     *string    `json:"name" desc:"时间段名称"`
+	Start    *time.Time `json:"start" desc:"开始时间，RFC3339"`
+	End      *time.Time `json:"end" desc:"结束时间，RFC3339，不早于开始时间"`
+}
+
+type characterUpdateArgs struct {
+	ID                 uint    `json:"id" schema:"required,minimum=1" desc:"人物 ID"`
+	Name               *string `json:"name" desc:"人物姓名"`
+	Bio                *string `json:"bio" desc:"人物简介"`
+	BirthTimeSegmentID *uint   `json:"birthTimeSegmentID" desc:"出生所在的时间段 ID，0 表示未知"`
+}
+
+type locationUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"地点 ID"`
+	WorldID     *uint   `json:"worldID" schema:"minimum=1" desc:"所属世界 ID，所辖地点随之迁移"`
+	ParentID    *uint   `json:"parentID" desc:"所在的上级地点 ID，0 表示没有上级"`
+	Name        *string `json:"name" desc:"地点名称"`
+	Description *string `json:"description" desc:"地点描述"`
+}
+
+type itemUpdateArgs struct {
+	ID     uint    `json:"id" schema:"required,minimum=1" desc:"物品 ID"`
+	Name   *string `json:"name" desc:"物品名称"`
+	Status *string `json:"status" desc:"物品状态"`
+}
+
+type abilityUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"能力 ID"`
+	CharacterID *uint   `json:"characterID" schema:"minimum=1" desc:"人物 ID"`
+	Name        *string `json:"name" desc:"能力名称"`
+	EventID     *uint   `json:"eventID" desc:"获得能力的事件 ID"`
+}
+
+type memoryUpdateArgs struct {
+	ID          uint    `json:"id" schema:"required,minimum=1" desc:"记忆 ID"`
+	CharacterID *uint   `json:"characterID" schema:"minimum=1" desc:"人物 ID"`
+	EventID     *uint   `json:"eventID" desc:"记忆来源事件 ID"`
+	Content     *string `json:"content" desc:"记忆内容"`
+	Trigger     *string `json:"trigger" desc:"触发条件"`
+}
+
+// patch collects the set pointer fields of an update argument struct,
+// keyed by field name, which matches the model field it updates.
+func patch(a any) map[string]any {
+	out := map[string]any{}
+	rv := reflect.ValueOf(a)
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Field(i)
+		if f.Kind() != reflect.Pointer || f.IsNil() {
+			continue
+		}
+		out[rv.Type().Field(i).Name] = f.Elem().Interface()
+	}
+	return out
+}
+
+type resolveArgs struct {
+	Entity      entityKind    `json:"entity" schema:"required" desc:"实体类型"`
+	Name        string        `json:"name" desc:"名称（world、period、timeSegment、location、character）"`
+	Title       string        `json:"title" desc:"标题（novel、volume、chapter）"`
+	Description string        `json:"description" desc:"创建时使用的描述（world、location、novel）"`
+	Bio         string        `json:"bio" desc:"创建时使用的人物简介（character）"`
+	Index       int           `json:"index" desc:"创建时使用的序号（period、volume、chapter）"`
+	Status      chapterStatus `json:"status" desc:"创建时使用的章节状态（chapter）"`
+	Start       time.Time     `json:"start" desc:"创建时使用的开始时间（timeSegment）"`
+	End         time.Time     `json:"end" desc:"创建时使用的结束时间（timeSegment）"`
+	PreferName  bool          `json:"preferName" desc:"character 的名称既是某人本名又是他人别名时只取本名匹配"`
+	parentRefs
+}
+
+type contextNovelArgs struct {
+	NovelID uint `json:"novelID" schema:"required,minimum=1" desc:"小说 ID"`
+}
+
+type contextCharacterArgs struct {
+	CharacterID   uint `json:"characterID" schema:"required,minimum=1" desc:"人物 ID"`
+	EventID       uint `json:"eventID" desc:"事件 ID，取该事件时的状态；与 timeSegmentID 二选一"`
+	TimeSegmentID uint `json:"timeSegmentID" desc:"时间段 ID，取该时间段结束时的状态"`
+}
+
+type contextLocationArgs struct {
+	LocationID    uint `json:"locationID" schema:"required,minimum=1" desc:"地点 ID"`
+	EventID       uint `json:"eventID" desc:"事件 ID，取该事件时的状态；与 timeSegmentID 二选一"`
+	TimeSegmentID uint `json:"timeSegmentID" desc:"时间段 ID，取该时间段结束时的状态"`
+}
+
+// parent returns the reference that scopes entity, or 0 for top-level kinds.
+func (r parentRefs) parent(entity string) uint {
+	switch entity {
+	case "period", "location", "organization":
+		return r.WorldID
+	case "timeSegment":
+		return r.PeriodID
+	case "volume":
+		return r.NovelID
+	case "chapter":
+		return r.VolumeID
+	}
+	return 0
+}
+
+// Tools returns the storage, authoring, export, style, resolve and context
+// tools backed by s.
+func Tools(s *Services) []tool.Tool {
+	return []tool.Tool{
+		tool.NewActions("sqlHelper", "SQL操作",
+			tool.Handle("getByID", "按 ID 获取实体", func(_ context.Context, a sqlGetByIDArgs) (any, error) {
+				return s.GetByID(string(a.Entity), a.ID)
+			}).ReadOnly(),
+			tool.Handle("findByName", "按名称或标题查找实体", func(_ context.Context, a sqlFindByNameArgs) (any, error) {
+				name := a.Name
+				if name == "" {
+					name = a.Title
+				}
+				return s.FindByName(string(a.Entity), name, a.parent(string(a.Entity)), a.NovelID, a.PreferName)
+			}).ReadOnly(),
+			tool.Handle("list", "列出实体", func(_ context.Context, a sqlListArgs) (any, error) {
+				return s.List(string(a.Entity), a.parent(string(a.Entity)), a.NovelID)
+			}).ReadOnly(),
+			tool.Handle("create", "按字段创建任意实体", func(_ context.Context, a sqlCreateArgs) (any, error) {
+				return s.SQLCreate(string(a.Entity), a.Fields)
+			}),
+			tool.Handle("update", "按字段修改任意实体", func(_ context.Context, a sqlUpdateArgs) (any, error) {
+				return s.SQLUpdate(string(a.Entity), a.ID, a.Fields)
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除任意实体并级联处理依赖，返回影响报告", func(_ context.Context, a sqlDeleteArgs) (any, error) {
+				return s.DeleteEntity(string(a.Entity), a.ID, a.options())
+			}).Destructive(),
+		),
+		tool.NewActions("novelHelper", "小说管理",
+			tool.Handle("create", "创建小说", func(_ context.Context, a novelCreateArgs) (any, error) {
+				return s.CreateNovel(a.Title, a.Description)
+			}),
+			tool.Handle("update", "修改小说", func(_ context.Context, a novelUpdateArgs) (any, error) {
+				return s.UpdateEntity("novel", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除小说及其分卷、章节、事件、线索与文风参考", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("novel", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("export", "导出整本小说正文", func(ctx context.Context, a idArgs) (any, error) {
+				return s.ExportNovel(ctx, a.ID)
+			}).ReadOnly(),
+			tool.Handle("addWorld", "把世界加入小说；同一世界可加入多部小说", func(_ context.Context, a novelWorldArgs) (any, error) {
+				return s.AddNovelWorld(a.NovelID, a.WorldID)
+			}).Idempotent(),
+			tool.Handle("removeWorld", "把世界移出小说，世界本身保留", func(_ context.Context, a novelWorldArgs) (any, error) {
+				return s.RemoveNovelWorld(a.NovelID, a.WorldID)
+			}).Destructive(),
+			tool.Handle("addCharacter", "把人物加入小说", func(_ context.Context, a novelCharacterArgs) (any, error) {
+				return s.AddNovelCharacter(a.NovelID, a.CharacterID)
+			}).Idempotent(),
+			tool.Handle("removeCharacter", "把人物移出小说，人物本身保留", func(_ context.Context, a novelCharacterArgs) (any, error) {
+				return s.RemoveNovelCharacter(a.NovelID, a.CharacterID)
+			}).Destructive(),
+			tool.Handle("members", "列出小说的世界与人物", func(_ context.Context, a idArgs) (any, error) {
+				return s.GetNovelMembers(a.ID)
+			}).ReadOnly(),
+		),
+		tool.NewActions("volumeHelper", "分卷管理",
+			tool.Handle("create", "创建分卷", func(_ context.Context, a volumeCreateArgs) (any, error) {
+				return s.CreateVolume(a.NovelID, a.Title, a.Index)
+			}),
+			tool.Handle("update", "修改分卷", func(_ context.Context, a volumeUpdateArgs) (any, error) {
+				return s.UpdateEntity("volume", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除分卷及其章节与事件", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("volume", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("move", "把分卷移到指定位置，可移到其他小说，并重新编号", func(_ context.Context, a volumeMoveArgs) (any, error) {
+				return s.MoveVolume(a.ID, a.NovelID, a.Position)
+			}).Idempotent(),
+			tool.Handle("reorder", "按给定顺序重排小说的分卷并重新编号", func(_ context.Context, a volumeReorderArgs) (any, error) {
+				return s.ReorderVolumes(a.NovelID, a.Order)
+			}).Idempotent(),
+		),
+		tool.NewActions("chapterHelper", "章节管理",
+			tool.Handle("create", "创建章节", func(_ context.Context, a chapterCreateArgs) (any, error) {
+				return s.CreateChapter(a.VolumeID, a.Title, a.Index, string(a.Status))
+			}),
+			tool.Handle("update", "修改章节，content 整章覆盖正文", func(_ context.Context, a chapterUpdateArgs) (any, error) {
+				return s.updateEntity("chapter", a.ID, patch(a), a.Message)
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除章节，其事件一并删除或移到其他章节", func(_ context.Context, a chapterDeleteArgs) (any, error) {
+				return s.DeleteEntity("chapter", a.ID, DeleteOptions{Events: a.Events, MoveEventsTo: a.MoveEventsTo})
+			}).Destructive(),
+			tool.Handle("export", "导出章节正文", func(_ context.Context, a idArgs) (any, error) {
+				return s.ExportChapter(a.ID)
+			}).ReadOnly(),
+			tool.Handle("move", "把章节移到指定位置，可移到其他分卷，并重新编号", func(_ context.Context, a chapterMoveArgs) (any, error) {
+				return s.MoveChapter(a.ID, a.VolumeID, a.Position)
+			}).Idempotent(),
+			tool.Handle("reorder", "按给定顺序重排分卷的章节并重新编号", func(_ context.Context, a chapterReorderArgs) (any, error) {
+				return s.ReorderChapters(a.VolumeID, a.Order)
+			}).Idempotent(),
+			tool.Handle("split", "在指定段落处把章节拆成两章", func(_ context.Context, a chapterSplitArgs) (any, error) {
+				return s.SplitChapter(a.ID, a.Paragraph, a.Title, a.EventsFrom)
+			}),
+			tool.Handle("merge", "把紧随其后的章节并入本章，被并入的章节进入回收站", func(_ context.Context, a idArgs) (any, error) {
+				return s.MergeChapters(a.ID)
+			}),
+			tool.Handle("append", "在章节末尾追加正文", func(_ context.Context, a chapterAppendArgs) (any, error) {
+				return s.AppendChapter(a.ID, a.Text, a.Message)
+			}),
+			tool.Handle("insert", "在指定段落前插入正文", func(_ context.Context, a chapterInsertArgs) (any, error) {
+				return s.InsertChapter(a.ID, a.Paragraph, a.Text, a.Message)
+			}),
+			tool.Handle("replace", "替换或删除连续的若干段落", func(_ context.Context, a chapterReplaceArgs) (any, error) {
+				return s.ReplaceChapter(a.ID, a.From, a.To, a.Text, a.Message)
+			}).Destructive(),
+			tool.Handle("findReplace", "替换正文中恰好出现一次的一段文字", func(_ context.Context, a chapterFindReplaceArgs) (any, error) {
+				return s.FindReplaceChapter(a.ID, a.Find, a.Replace, a.Message)
+			}).Destructive(),
+			tool.Handle("revisions", "列出章节正文的历史版本", func(_ context.Context, a idArgs) (any, error) {
+				return s.ListRevisions(a.ID)
+			}).ReadOnly(),
+			tool.Handle("revision", "读取某个历史版本的正文", func(_ context.Context, a revisionArgs) (any, error) {
+				return s.GetRevision(a.RevisionID)
+			}).ReadOnly(),
+			tool.Handle("diff", "比较两个历史版本的正文", func(_ context.Context, a revisionDiffArgs) (any, error) {
+				return s.DiffRevisions(a.From, a.To, a.Mode)
+			}).ReadOnly(),
+			tool.Handle("restoreRevision", "把章节正文恢复为某个历史版本，记为新版本", func(_ context.Context, a revisionRestoreArgs) (any, error) {
+				return s.RestoreRevision(a.RevisionID, a.Message)
+			}),
+		),
+		tool.NewActions("sceneHelper", "场景管理：章节内的视角、地点、时间与正文段落范围",
+			tool.Handle("create", "在章节中创建场景", func(_ context.Context, a sceneCreateArgs) (any, error) {
+				return s.CreateScene(&models.Scene{ChapterID: a.ChapterID, Title: a.Title, POVCharacterID: a.POVCharacterID, LocationID: a.LocationID, TimeSegmentID: a.TimeSegmentID, Goal: a.Goal, Conflict: a.Conflict, Outcome: a.Outcome, StartParagraph: a.StartParagraph, EndParagraph: a.EndParagraph}, a.Position)
+			}),
+			tool.Handle("update", "修改场景", func(_ context.Context, a sceneUpdateArgs) (any, error) {
+				return s.UpdateScene(a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除场景，其事件保留在章节中", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("scene", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("list", "按顺序列出章节的场景及各场景的事件", func(_ context.Context, a idArgs) (any, error) {
+				return s.ChapterScenes(a.ID)
+			}).ReadOnly(),
+			tool.Handle("reorder", "按给定顺序重排章节的场景并重新编号", func(_ context.Context, a sceneReorderArgs) (any, error) {
+				return s.ReorderScenes(a.ChapterID, a.Order)
+			}).Idempotent(),
+		),
+		tool.NewActions("eventHelper", "事件管理",
+			tool.Handle("create", "创建事件，引用可用 ID 或名称指定", func(_ context.Context, a eventCreateArgs) (any, error) {
+				return s.createEvent(a)
+			}),
+			tool.Handle("update", "修改事件", func(_ context.Context, a eventUpdateArgs) (any, error) {
+				return s.UpdateEvent(a.ID, patch(a), participants(a.Characters, a.Participants), itemLinks(a.Items, a.ItemLinks))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除事件及其参与记录，并解除记忆、物品流转与能力使用对它的引用", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("event", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("byCharacter", "列出人物参与的事件", func(_ context.Context, a characterEventsArgs) (any, error) {
+				return s.CharacterEvents(a.CharacterID, string(a.Role))
+			}).ReadOnly(),
+			tool.Handle("move", "把事件移到另一事件之前或之后", func(_ context.Context, a eventMoveArgs) (any, error) {
+				return s.MoveEvent(a.ID, Placement{Before: a.Before, After: a.After})
+			}).Idempotent(),
+			tool.Handle("reorder", "按给定顺序重排章节内的事件", func(_ context.Context, a eventReorderArgs) (any, error) {
+				return s.ReorderEvents(a.ChapterID, a.Order)
+			}).Idempotent(),
+			tool.Handle("timeline", "按故事内时间列出小说的全部事件", func(_ context.Context, a novelRefArgs) (any, error) {
+				id, err := s.novelID(a.ID, a.NovelTitle)
+				if err != nil {
+					return nil, err
+				}
+				return s.Timeline(id)
+			}).ReadOnly(),
+		),
+		tool.NewActions("worldHelper", "世界管理",
+			tool.Handle("create", "创建世界", func(_ context.Context, a worldCreateArgs) (any, error) {
+				return s.CreateWorld(a.Name, a.Description, a.NovelID)
+			}),
+			tool.Handle("update", "修改世界", func(_ context.Context, a worldUpdateArgs) (any, error) {
+				return s.UpdateEntity("world", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除世界及其时期、时间段与地点，并解除事件对它的引用", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("world", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("periodHelper", "时期管理",
+			tool.Handle("create", "创建时期", func(_ context.Context, a periodCreateArgs) (any, error) {
+				return s.CreatePeriod(a.WorldID, a.Name, a.Index)
+			}),
+			tool.Handle("update", "修改时期", func(_ context.Context, a periodUpdateArgs) (any, error) {
+				return s.UpdateEntity("period", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除时期及其时间段", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("period", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("timeSegmentHelper", "时间段管理",
+			tool.Handle("create", "创建时间段", func(_ context.Context, a timeSegmentCreateArgs) (any, error) {
+				if a.End.Before(a.Start) {
+					return nil, &tool.FieldError{Field: "end", Msg: "must not be before start"}
+				}
+				return s.CreateTimeSegment(a.PeriodID, a.Name, a.Start, a.End)
+			}),
+			tool.Handle("update", "修改时间段", func(_ context.Context, a timeSegmentUpdateArgs) (any, error) {
+				return s.UpdateEntity("timeSegment", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除时间段，并解除事件对它的引用", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("timeSegment", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("characterHelper", "人物管理",
+			tool.Handle("create", "创建人物", func(_ context.Context, a characterCreateArgs) (any, error) {
+				return s.CreateCharacter(a.Name, a.Bio, a.BirthTimeSegmentID, a.NovelID)
+			}),
+			tool.Handle("update", "修改人物", func(_ context.Context, a characterUpdateArgs) (any, error) {
+				return s.UpdateEntity("character", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除人物及其别名、关系、能力与记忆，持有物品解除持有或一并删除", func(_ context.Context, a characterDeleteArgs) (any, error) {
+				return s.DeleteEntity("character", a.ID, DeleteOptions{Items: a.Items})
+			}).Destructive(),
+			tool.Handle("addAlias", "为人物添加字、号、绰号等别名；已有的别名只更新类别", func(_ context.Context, a characterAliasArgs) (any, error) {
+				return s.AddCharacterAlias(a.CharacterID, a.Name, a.Kind)
+			}).Idempotent(),
+			tool.Handle("removeAlias", "删除人物别名", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("characterAlias", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("aliases", "列出人物的别名", func(_ context.Context, a characterRefArgs) (any, error) {
+				return s.CharacterAliases(a.CharacterID)
+			}).ReadOnly(),
+			tool.Handle("setStatus", "记录人物在某事件中的生死状态变化，如死亡、失踪、封印、复活；同一事件只保留一条", func(_ context.Context, a characterStatusArgs) (any, error) {
+				return s.SetCharacterStatus(a.CharacterID, a.EventID, string(a.Status), a.Note)
+			}).Idempotent(),
+			tool.Handle("removeStatus", "删除人物状态变化", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("characterStatus", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("lifecycle", "查看人物的出生时间段与按故事顺序排列的状态变化", func(_ context.Context, a characterRefArgs) (any, error) {
+				return s.CharacterLifecycle(a.CharacterID)
+			}).ReadOnly(),
+			tool.Handle("statusAt", "查询人物在某事件时的生死状态", func(_ context.Context, a characterStatusAtArgs) (any, error) {
+				return s.CharacterStatusAt(a.CharacterID, a.EventID)
+			}).ReadOnly(),
+		),
+		tool.NewActions("characterRelationshipHelper", "人物关系管理",
+			tool.Handle("set", "设置人物 A 对 B 的关系，记为在该事件发生的变化；对称类型同时设置 B 对 A", func(_ context.Context, a relationshipSetArgs) (any, error) {
+				if a.AID == a.BID {
+					return nil, &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+				}
+				return s.SetCharacterRelationship(a.AID, a.BID, a.Type, a.Intimacy, a.EventID, a.Note)
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除人物关系及其变化记录；对称类型连同反向关系", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("characterRelationship", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("removeChange", "删除一条关系变化记录", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.RemoveRelationshipChange(a.ID)
+			}).Destructive(),
+			tool.Handle("at", "查询两人在某事件时彼此的关系", func(_ context.Context, a relationshipAtArgs) (any, error) {
+				return s.RelationshipAt(a.AID, a.BID, a.EventID)
+			}).ReadOnly(),
+			tool.Handle("history", "按故事顺序列出两人关系与亲密度的变化", func(_ context.Context, a relationshipPairArgs) (any, error) {
+				return s.RelationshipHistory(a.AID, a.BID)
+			}).ReadOnly(),
+			tool.Handle("setType", "登记关系类型及其是否对称", func(_ context.Context, a relationshipTypeArgs) (any, error) {
+				return s.SetRelationshipType(a.Name, a.Symmetric, a.Description)
+			}).Destructive().Idempotent(),
+			tool.Handle("types", "列出已登记的关系类型", func(_ context.Context, _ noArgs) (any, error) {
+				return s.ListRelationshipTypes()
+			}).ReadOnly(),
+		),
+		tool.NewActions("locationHelper", "地点管理",
+			tool.Handle("create", "创建地点", func(_ context.Context, a locationCreateArgs) (any, error) {
+				return s.CreateLocation(a.WorldID, a.ParentID, a.Name, a.Description)
+			}),
+			tool.Handle("update", "修改地点", func(_ context.Context, a locationUpdateArgs) (any, error) {
+				return s.UpdateLocation(a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除地点及其所辖地点与地点关系，并解除事件与物品对它的引用", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("location", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("get", "查看地点的上下级与地点关系", func(_ context.Context, a idArgs) (any, error) {
+				return s.GetLocation(a.ID)
+			}).ReadOnly(),
+			tool.Handle("link", "连接两个地点并记录距离与通行时间；同一对地点的同类连接只保留一条", func(_ context.Context, a locationLinkArgs) (any, error) {
+				if a.AID == a.BID {
+					return nil, &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+				}
+				return s.SetLocationLink(&models.LocationRelationship{AID: a.AID, BID: a.BID, Type: string(a.Type), Distance: a.Distance, TravelHours: a.TravelHours, OneWay: a.OneWay})
+			}).Destructive().Idempotent(),
+			tool.Handle("unlink", "删除地点关系", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("locationRelationship", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("route", "按已知通行时间求两地之间最快的路线", func(_ context.Context, a routeArgs) (any, error) {
+				return s.FindRoute(a.FromID, a.ToID)
+			}).ReadOnly(),
+		),
+		tool.NewActions("organizationHelper", "组织管理",
+			tool.Handle("create", "创建组织，可指定上级组织", func(_ context.Context, a organizationCreateArgs) (any, error) {
+				return s.CreateOrganization(&models.Organization{WorldID: a.WorldID, ParentID: a.ParentID, Name: a.Name, Description: a.Description})
+			}),
+			tool.Handle("update", "修改组织", func(_ context.Context, a organizationUpdateArgs) (any, error) {
+				return s.UpdateOrganization(a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除组织及其下级组织、成员记录与组织关系", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("organization", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("get", "查看组织的上下级与组织关系", func(_ context.Context, a idArgs) (any, error) {
+				return s.GetOrganization(a.ID)
+			}).ReadOnly(),
+			tool.Handle("join", "记录人物加入组织及其身份", func(_ context.Context, a membershipCreateArgs) (any, error) {
+				return s.AddMembership(&models.OrganizationMembership{OrganizationID: a.OrganizationID, CharacterID: a.CharacterID, Rank: a.Rank, JoinEventID: a.JoinEventID, LeaveEventID: a.LeaveEventID, Note: a.Note})
+			}),
+			tool.Handle("updateMembership", "修改成员记录，如记下离开的事件", func(_ context.Context, a membershipUpdateArgs) (any, error) {
+				return s.UpdateMembership(a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("removeMembership", "删除成员记录", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("organizationMembership", a.ID, DeleteOptions{})
+			}).Destructive(),
+			tool.Handle("members", "列出组织在某事件时的成员", func(_ context.Context, a organizationMembersArgs) (any, error) {
+				return s.OrganizationMembers(a.OrganizationID, a.EventID, a.WithSub)
+			}).ReadOnly(),
+			tool.Handle("memberships", "列出人物在某事件时所属的组织", func(_ context.Context, a characterMembershipsArgs) (any, error) {
+				return s.CharacterMemberships(a.CharacterID, a.EventID)
+			}).ReadOnly(),
+			tool.Handle("relate", "设置两个组织之间的关系，不分方向", func(_ context.Context, a organizationRelationArgs) (any, error) {
+				if a.AID == a.BID {
+					return nil, &tool.FieldError{Field: "bid", Msg: "must differ from aid"}
+				}
+				return s.SetOrganizationRelationship(a.AID, a.BID, a.Type, a.Exclusive)
+			}).Destructive().Idempotent(),
+			tool.Handle("removeRelationship", "删除组织关系", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("organizationRelationship", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("itemHelper", "物品管理",
+			tool.Handle("create", "创建物品，并记为在该事件出现", func(_ context.Context, a itemCreateArgs) (any, error) {
+				return s.CreateItem(a.Name, a.holder(), a.Quantity, a.Status, a.EventID)
+			}),
+			tool.Handle("transfer", "在人物、地点和容器物品之间流转物品，转出方须在该事件时持有足够数量", func(_ context.Context, a itemTransferArgs) (any, error) {
+				return s.TransferItem(a.transfer("transfer"))
+			}),
+			tool.Handle("destroy", "记录物品在某事件被销毁或消耗", func(_ context.Context, a itemDestroyArgs) (any, error) {
+				return s.TransferItem(itemTransferArgs{ItemID: a.ItemID, FromID: a.FromID, FromLocationID: a.FromLocationID, FromContainerID: a.FromContainerID, Quantity: a.Quantity, EventID: a.EventID}.transfer("destroy"))
+			}),
+			tool.Handle("custody", "查询物品在某事件时由谁持有多少", func(_ context.Context, a itemCustodyArgs) (any, error) {
+				return s.ItemCustody(a.ItemID, a.EventID)
+			}).ReadOnly(),
+			tool.Handle("update", "修改物品", func(_ context.Context, a itemUpdateArgs) (any, error) {
+				return s.UpdateEntity("item", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除物品及其流转记录", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("item", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("characterAbilityHelper", "人物能力管理",
+			tool.Handle("create", "创建能力", func(_ context.Context, a abilityCreateArgs) (any, error) {
+				return s.CreateAbility(a.CharacterID, a.Name, a.Level, a.EventID)
+			}),
+			tool.Handle("upgrade", "在某事件调整能力等级并留下记录", func(_ context.Context, a abilityUpgradeArgs) (any, error) {
+				return s.UpgradeAbility(a.AbilityID, a.Level, a.EventID)
+			}).Destructive().Idempotent(),
+			tool.Handle("use", "记录能力使用", func(_ context.Context, a abilityUseArgs) (any, error) {
+				return s.UseAbility(a.AbilityID, a.EventID, a.Note)
+			}),
+			tool.Handle("update", "修改能力", func(_ context.Context, a abilityUpdateArgs) (any, error) {
+				return s.UpdateEntity("ability", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除能力及其使用记录", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("ability", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("plotThreadHelper", "情节线索管理",
+			tool.Handle("create", "创建线索", func(_ context.Context, a plotCreateArgs) (any, error) {
+				return s.CreatePlotThread(a.NovelID, a.Name, string(a.Stage))
+			}),
+			tool.Handle("update", "修改线索名称或阶段", func(_ context.Context, a plotUpdateArgs) (any, error) {
+				return s.UpdateEntity("plotThread", a.PlotID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除线索", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("plotThread", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("characterMemoryHelper", "人物记忆管理",
+			tool.Handle("create", "创建人物记忆", func(_ context.Context, a memoryCreateArgs) (any, error) {
+				return s.CreateMemory(a.CharacterID, a.EventID, a.Content, a.Trigger)
+			}),
+			tool.Handle("update", "修改人物记忆", func(_ context.Context, a memoryUpdateArgs) (any, error) {
+				return s.UpdateEntity("memory", a.ID, patch(a))
+			}).Destructive().Idempotent(),
+			tool.Handle("delete", "删除人物记忆", func(_ context.Context, a deleteArgs) (any, error) {
+				return s.DeleteEntity("memory", a.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("articleExportHelper", "文章导出",
+			tool.Handle("chapter", "导出章节", func(_ context.Context, a idArgs) (any, error) {
+				return s.ExportChapter(a.ID)
+			}).ReadOnly(),
+			tool.Handle("volume", "导出分卷", func(_ context.Context, a idArgs) (any, error) {
+				return s.ExportVolume(a.ID)
+			}).ReadOnly(),
+			tool.Handle("novel", "导出整本小说", func(ctx context.Context, a novelRefArgs) (any, error) {
+				id, err := s.novelID(a.ID, a.NovelTitle)
+				if err != nil {
+					return nil, err
+				}
+				return s.ExportNovel(ctx, id)
+			}).ReadOnly(),
+		),
+		tool.NewActions("styleHelper", "文笔风格参考",
+			tool.Handle("set", "设置文风参考正文", func(_ context.Context, a styleSetArgs) (any, error) {
+				id, err := s.novelID(a.NovelID, a.NovelTitle)
+				if err != nil {
+					return nil, err
+				}
+				return s.SetStyleRef(id, a.Content)
+			}).Destructive().Idempotent(),
+			tool.Handle("get", "获取文风参考正文", func(_ context.Context, a styleGetArgs) (any, error) {
+				id, err := s.novelID(a.NovelID, a.NovelTitle)
+				if err != nil {
+					return nil, err
+				}
+				return s.GetStyleRef(id)
+			}).ReadOnly(),
+			tool.Handle("delete", "删除文风参考", func(_ context.Context, a styleGetArgs) (any, error) {
+				id, err := s.novelID(a.NovelID, a.NovelTitle)
+				if err != nil {
+					return nil, err
+				}
+				sr, err := s.GetStyleRef(id)
+				if err != nil {
+					return nil, err
+				}
+				return s.DeleteEntity("styleRef", sr.ID, DeleteOptions{})
+			}).Destructive(),
+		),
+		tool.NewActions("trashHelper", "回收站：查看、恢复与清除已删除的实体",
+			tool.Handle("list", "列出删除记录及随之删除、解除引用与移动的实体，最新的在前", func(_ context.Context, a trashListArgs) (any, error) {
+				return s.ListTrash(string(a.Entity), a.Limit)
+			}).ReadOnly(),
+			tool.Handle("restore", "恢复一条删除记录中的全部实体，并还原被解除或移动的引用", func(_ context.Context, a trashRestoreArgs) (any, error) {
+				return s.RestoreTrash(a.ID)
+			}),
+			tool.Handle("purge", "永久清除早于指定天数的删除记录及其实体", func(_ context.Context, a trashPurgeArgs) (any, error) {
+				age := DefaultTrashRetention
+				if a.OlderThanDays != nil {
+					age = time.Duration(*a.OlderThanDays * float64(24*time.Hour))
+				}
+				return s.PurgeTrash(age)
+			}).Destructive().Idempotent(),
+		),
+		tool.NewActions("resolveHelper", "按名称解析或创建实体",
+			tool.Handle("ensure", "按名称查找，不存在则创建", func(_ context.Context, a resolveArgs) (any, error) {
+				return s.resolve("ensure", a)
+			}).Idempotent(),
+			tool.Handle("find", "按名称查找", func(_ context.Context, a resolveArgs) (any, error) {
+				return s.resolve("find", a)
+			}).ReadOnly(),
+		),
+		tool.NewActions("contextHelper", "获取小说上下文",
+			tool.Handle("novel", "获取小说的分卷、章节、事件与设定", func(_ context.Context, a contextNovelArgs) (any, error) {
+				return s.GetNovelContext(a.NovelID)
+			}).ReadOnly(),
+			tool.Handle("character", "获取人物在某事件或时间段结束时的状态：生死、所在、持有物品、能力、记忆、关系与所属组织", func(_ context.Context, a contextCharacterArgs) (any, error) {
+				return s.CharacterSnapshot(a.CharacterID, a.EventID, a.TimeSegmentID)
+			}).ReadOnly(),
+			tool.Handle("location", "获取地点在某事件或时间段结束时的状态：在场人物与存放的物品", func(_ context.Context, a contextLocationArgs) (any, error) {
+				return s.LocationSnapshot(a.LocationID, a.EventID, a.TimeSegmentID)
+			}).ReadOnly(),
+		),
+	}
+}
+
+func (s *Services) createEvent(a eventCreateArgs) (*models.Event, error) {
+	chapterID := a.ChapterID
+	if chapterID == 0 && a.NovelTitle != "" && a.VolumeTitle != "" && a.ChapterTitle != "" {
+		n, err := s.GetNovelByTitle(a.NovelTitle)
+		if err != nil {
+			return nil, err
+		}
+		v, err := s.GetVolumeByTitle(n.ID, a.VolumeTitle)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := s.GetChapterByTitle(v.ID, a.ChapterTitle)
+		if err != nil {
+			return nil, err
+		}
+		chapterID = ch.ID
+	}
+	if chapterID == 0 && a.SceneID == 0 && a.Before == 0 && a.After == 0 {
+		return nil, &tool.FieldError{Field: "chapterID", Msg: "required unless novelTitle, volumeTitle and chapterTitle, sceneID, or before or after, are given"}
+	}
+	// Names are looked up among the worlds and characters of the novel the
+	// event goes into.
+	ref := a.Before
+	if ref == 0 {
+		ref = a.After
+	}
+	novelID, err := s.eventNovel(chapterID, a.SceneID, ref)
+	if err != nil {
+		return nil, err
+	}
+	chars := a.Characters
+	if len(chars) == 0 {
+		// resolve by names or aliases if provided
+		for i, name := range a.CharacterNames {
+			if name == "" {
+				continue
+			}
+			c, err := s.resolveCharacter(fmt.Sprintf("characterNames[%d]", i), novelID, name, a.PreferName)
+			if err != nil {
+				return nil, err
+			}
+			chars = append(chars, c.ID)
+		}
+	}
+	var world *models.World
+	if a.WorldName != "" && (a.WorldID == 0 || (a.LocationID == 0 && a.LocationName != "") || (a.TimeSegmentID == 0 && a.PeriodName != "" && a.TimeSegmentName != "")) {
+		if world, err = s.namedWorld("worldName", novelID, a.WorldName); err != nil {
+			return nil, err
+		}
+	}
+	worldID := a.WorldID
+	if worldID == 0 && world != nil {
+		worldID = world.ID
+	}
+	locationID := a.LocationID
+	if locationID == 0 && a.LocationName != "" && world != nil {
+		l, err := s.GetLocationByName(world.ID, a.LocationName)
+		if err != nil {
+			return nil, err
+		}
+		locationID = l.ID
+	}
+	timeSegmentID := a.TimeSegmentID
+	if timeSegmentID == 0 && a.PeriodName != "" && a.TimeSegmentName != "" && world != nil {
+		p, err := s.GetPeriodByName(world.ID, a.PeriodName)
+		if err != nil {
+			return nil, err
+		}
+		ts, err := s.GetTimeSegmentByName(p.ID, a.TimeSegmentName)
+		if err != nil {
+			return nil, err
+		}
+		timeSegmentID = ts.ID
+	}
+	return s.CreateEvent(chapterID, a.SceneID, worldID, locationID, timeSegmentID, a.StoryTime, a.Description, participants(chars, a.Participants), itemLinks(a.Items, a.ItemLinks), Placement{Before: a.Before, After: a.After})
+}
+
+// eventNovel is the novel of a new event's chapter, which is chapterID or
+// else that of its scene or of the event ref it is placed next to. Missing
+// rows give 0 here and are reported by CreateEvent.
+func (s *Services) eventNovel(chapterID, sceneID, ref uint) (uint, error) {
+	if chapterID == 0 && sceneID != 0 {
+		chapterID, _ = s.sceneChapter(sceneID)
+	}
+	if chapterID == 0 && ref != 0 {
+		var e models.Event
+		if s.DB.First(&e, ref).Error == nil {
+			chapterID = e.ChapterID
+		}
+	}
+	return s.chapterNovel(chapterID)
+}
+
+func (s *Services) resolve(act string, a resolveArgs) (any, error) {
+	entity := string(a.Entity)
+	if err := a.validate(act); err != nil {
+		return nil, err
+	}
+	if act == "find" {
+		return s.FindByName(entity, a.label(), a.parent(entity), a.NovelID, a.PreferName)
+	}
+	switch entity {
+	case "world":
+		return s.EnsureWorld(a.NovelID, a.Name, a.Description)
+	case "period":
+		return s.EnsurePeriod(a.WorldID, a.Name, a.Index)
+	case "timeSegment":
+		return s.EnsureTimeSegment(a.PeriodID, a.Name, a.Start, a.End)
+	case "location":
+		return s.EnsureLocation(a.WorldID, a.Name, a.Description)
+	case "character":
+		return s.EnsureCharacter(a.NovelID, a.Name, a.Bio, a.PreferName)
+	case "novel":
+		return s.EnsureNovel(a.Title, a.Description)
+	case "volume":
+		return s.EnsureVolume(a.NovelID, a.Title, a.Index)
+	case "chapter":
+		return s.EnsureChapter(a.VolumeID, a.Title, a.Index, string(a.Status))
+	}
+	return nil, fmt.Errorf("unknown entity %q", entity)
+}
+
+// label is the name or title that identifies a of its entity kind.
+func (a resolveArgs) label() string {
+	switch a.Entity {
+	case "novel", "volume", "chapter":
+		return a.Title
+	}
+	return a.Name
+}
+
+// validate checks the arguments resolveHelper needs for entity beyond what
+// the schema can express, so ensure never creates unnamed or orphaned rows.
+func (a resolveArgs) validate(act string) error {
+	switch a.Entity {
+	case "novel", "volume", "chapter":
+		if a.Title == "" {
+			return &tool.FieldError{Field: "title", Msg: fmt.Sprintf("required for entity %s", a.Entity)}
+		}
+	default:
+		if a.Name == "" {
+			return &tool.FieldError{Field: "name", Msg: fmt.Sprintf("required for entity %s", a.Entity)}
+		}
+	}
+	if act != "ensure" {
+		return nil
+	}
+	var parent string
+	var id uint
+	switch a.Entity {
+	case "period", "location":
+		parent, id = "worldID", a.WorldID
+	case "timeSegment":
+		parent, id = "periodID", a.PeriodID
+	case "volume":
+		parent, id = "novelID", a.NovelID
+	case "chapter":
+		parent, id = "volumeID", a.VolumeID
+	}
+	if parent != "" && id == 0 {
+		return &tool.FieldError{Field: parent, Msg: fmt.Sprintf("required when ensuring %s", a.Entity)}
+	}
+	if a.Entity == "timeSegment" {
+		switch {
+		case a.Start.IsZero():
+			return &tool.FieldError{Field: "start", Msg: "required when ensuring timeSegment"}
+		case a.End.IsZero():
+			return &tool.FieldError{Field: "end", Msg: "required when ensuring timeSegment"}
+		case a.End.Before(a.Start):
+			return &tool.FieldError{Field: "end", Msg: "must not be before start"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcpnovel/internal/models"
+	"reflect"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTrashRetention is how old trash must be before purge removes it
+// when no age is given.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+type TrashItem struct {
+	ID        uint
+	Entity    string
+	EntityID  uint
+	Label     string
+	DeletedAt time.Time
+	Deleted   map[string][]uint
+	Detached  map[string][]uint
+	Moved     map[string][]uint
+}
+
+type PurgeReport struct {
+	Entries []uint
+	Purged  map[string][]uint
+}
+
+// label is the title or name of a model, for listing it in the trash.
+func label(m any) string {
+	rv := reflect.ValueOf(m).Elem()
+	for _, name := range []string{"Title", "Name", "Description", "Content"} {
+		if f := rv.FieldByName(name); f.IsValid() && f.String() != "" {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+func trashItem(te models.TrashEntry) (TrashItem, []change, error) {
+	it := TrashItem{ID: te.ID, Entity: te.Entity, EntityID: te.EntityID, Label: te.Label, DeletedAt: te.CreatedAt, Detached: map[string][]uint{}, Moved: map[string][]uint{}}
+	if err := json.Unmarshal([]byte(te.Deleted), &it.Deleted); err != nil {
+		return it, nil, err
+	}
+	var changes []change
+	if err := json.Unmarshal([]byte(te.Changes), &changes); err != nil {
+		return it, nil, err
+	}
+	for _, c := range changes {
+		into := it.Detached
+		if c.Moved {
+			into = it.Moved
+		}
+		if !slices.Contains(into[c.Kind], c.ID) {
+			into[c.Kind] = append(into[c.Kind], c.ID)
+		}
+	}
+	return it, changes, nil
+}
+
+// ListTrash returns the most recent deletes first, optionally only those
+// of one entity kind, with the dependents each one took along.
+func (s *Services) ListTrash(entity string, limit int) ([]TrashItem, error) {
+	q := s.DB.Order("id desc")
+	if entity != "" {
+		q = q.Where("entity = ?", entity)
+	}
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	var entries []models.TrashEntry
+	if err := q.Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	out := []TrashItem{}
+	for _, te := range entries {
+		it, _, err := trashItem(te)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+// refKind is the entity kind a reference field of entity points at.
+func refKind(entity string, field string) string {
+	switch field {
+	case "NovelID":
+		return "novel"
+	case "VolumeID":
+		return "volume"
+	case "ChapterID":
+		return "chapter"
+	case "EventID":
+		return "event"
+	case "WorldID":
+		return "world"
+	case "PeriodID":
+		return "period"
+	case "ItemID":
+		return "item"
+	case "CharacterID":
+		return "character"
+	case "AbilityID":
+		return "ability"
+	case "OrganizationID":
+		return "organization"
+	case "RelationshipID":
+		return "characterRelationship"
+	case "AID", "BID":
+		switch entity {
+		case "locationRelationship":
+			return "location"
+		case "organizationRelationship":
+			return "organization"
+		}
+		return "character"
+	}
+	return ""
+}
+
+// uintValue undoes JSON's float64 decoding of an ID.
+func uintValue(v any) any {
+	if f, ok := v.(float64); ok {
+		return uint(f)
+	}
+	return v
+}
+
+// RestoreTrash revives everything one delete removed and puts back the
+// references it cleared or moved, unless they have been changed since.
+// The deleted entity's parents must not be in the trash themselves.
+func (s *Services) RestoreTrash(trashID uint) (*TrashItem, error) {
+	var te models.TrashEntry
+	if err := s.DB.First(&te, trashID).Error; err != nil {
+		return nil, err
+	}
+	it, changes, err := trashItem(te)
+	if err != nil {
+		return nil, err
+	}
+	root, err := newModel(te.Entity)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Unscoped().First(root, te.EntityID).Error; err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(root).Elem()
+	for _, name := range requiredRefs[te.Entity] {
+		kind := refKind(te.Entity, name)
+		pid := uint(rv.FieldByName(name).Uint())
+		parent, _ := newModel(kind)
+		if err := s.DB.First(parent, pid).Error; err != nil {
+			return nil, fmt.Errorf("%s %d of %s %d is missing or in the trash; restore it first", kind, pid, te.Entity, te.EntityID)
+		}
+	}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for kind, ids := range it.Deleted {
+			m, err := newModel(kind)
+			if err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(m).Where("id IN ?", ids).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		for i := len(changes) - 1; i >= 0; i-- {
+			c := changes[i]
+			m, err := newModel(c.Kind)
+			if err != nil {
+				return err
+			}
+			// Entries written before a migration may name dropped columns.
+			if !tx.Migrator().HasColumn(m, c.Column) {
+				continue
+			}
+			if err := tx.Model(m).Where("id = ? AND "+c.Column+" = ?", c.ID, uintValue(c.To)).Update(c.Column, uintValue(c.From)).Error; err != nil {
+				return err
+			}
+		}
+		if err := (&Services{DB: tx}).resettle(it.Deleted, it.Detached); err != nil {
+			return err
+		}
+		return tx.Delete(&te).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// PurgeTrash permanently removes the rows of every delete older than
+// olderThan, along with their trash entries.
+func (s *Services) PurgeTrash(olderThan time.Duration) (*PurgeReport, error) {
+	var entries []models.TrashEntry
+	if err := s.DB.Where("created_at < ?", time.Now().Add(-olderThan)).Order("id asc").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	r := &PurgeReport{Entries: []uint{}, Purged: map[string][]uint{}}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		for _, te := range entries {
+			var deleted map[string][]uint
+			if err := json.Unmarshal([]byte(te.Deleted), &deleted); err != nil {
+				return err
+			}
+			for kind, ids := range deleted {
+				m, err := newModel(kind)
+				if err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Where("id IN ? AND deleted_at IS NOT NULL", ids).Delete(m).Error; err != nil {
+					return err
+				}
+				if kind == "chapter" {
+					if err := tx.Where("chapter_id IN ?", ids).Delete(&models.ChapterRevision{}).Error; err != nil {
+						return err
+					}
+				}
+				r.Purged[kind] = append(r.Purged[kind], ids...)
+			}
+			if err := tx.Delete(&te).Error; err != nil {
+				return err
+			}
+			r.Entries = append(r.Entries, te.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+    "time"
+
+    "gorm.io/gorm"
+)
 
 type Novel struct {
     ID uint `gorm:"primaryKey"`
@@ -8,6 +12,7 @@ type Novel struct {
     Description string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Volume struct {
@@ -17,6 +22,7 @@ type Volume struct {
     Index int
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Chapter struct {
@@ -28,6 +34,21 @@ type Chapter struct {
     Content string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// ChapterRevision is one saved version of a chapter's content, numbered
+// from 1 per chapter. A snapshot revision holds the full text in Data; the
+// others hold a line delta against the revision before them, as JSON.
+type ChapterRevision struct {
+    ID uint `gorm:"primaryKey"`
+    ChapterID uint `gorm:"index"`
+    Number int
+    Snapshot bool
+    Data string
+    WordCount int
+    Message string
+    CreatedAt time.Time
 }
 
 type World struct {
@@ -36,6 +57,28 @@ type World struct {
     Description string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// NovelWorld registers a world with a novel. A world shared by several
+// novels, as in a shared universe, has one row for each.
+type NovelWorld struct {
+    ID uint `gorm:"primaryKey"`
+    NovelID uint `gorm:"index"`
+    WorldID uint `gorm:"index"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// NovelCharacter registers a character with a novel.
+type NovelCharacter struct {
+    ID uint `gorm:"primaryKey"`
+    NovelID uint `gorm:"index"`
+    CharacterID uint `gorm:"index"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Period struct {
@@ -45,6 +88,7 @@ type Period struct {
     Index int
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type TimeSegment struct {
@@ -55,25 +99,70 @@ type TimeSegment struct {
     End time.Time
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Location is a place in a world. ParentID, if set, is the location it
+// lies within, in the same world, as a city lies within a country.
 type Location struct {
     ID uint `gorm:"primaryKey"`
     WorldID uint `gorm:"index"`
+    ParentID uint `gorm:"index"`
     Name string
     Description string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Character is a person of the story. BirthTimeSegmentID, if set, is the
+// time segment the character is born in; later changes of life status are
+// CharacterStatus rows.
 type Character struct {
     ID uint `gorm:"primaryKey"`
     Name string
     Bio string
+    BirthTimeSegmentID uint `gorm:"index"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// CharacterAlias is another name a character goes by: a courtesy name,
+// a title or a nickname. Kind says which, in the novel's own words (字、
+// 号、绰号、封号...). Several characters may share an alias.
+type CharacterAlias struct {
+    ID uint `gorm:"primaryKey"`
+    CharacterID uint `gorm:"index"`
+    Name string `gorm:"index"`
+    Kind string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// LifeStatuses are the states a character can pass into. A character is
+// alive from birth until a CharacterStatus says otherwise; resurrected is
+// alive again after being dead.
+var LifeStatuses = []string{"alive", "dead", "missing", "sealed", "resurrected"}
+
+// CharacterStatus is a change of a character's life status at the event
+// where it happens, such as the character's death. A character has at most
+// one per event.
+type CharacterStatus struct {
+    ID uint `gorm:"primaryKey"`
+    CharacterID uint `gorm:"index"`
+    EventID uint `gorm:"index"`
+    Status string
+    Note string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// CharacterRelationship is how A stands toward B; how B stands toward A is
+// a relationship of its own. Type and Intimacy are those of its latest
+// change in story order.
 type CharacterRelationship struct {
     ID uint `gorm:"primaryKey"`
     AID uint `gorm:"index"`
@@ -82,43 +171,172 @@ type CharacterRelationship struct {
     Intimacy float64
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// CharacterRelationshipChange is a relationship becoming Type with Intimacy
+// at an event, or how it stood before the story when EventID is 0.
+type CharacterRelationshipChange struct {
+    ID uint `gorm:"primaryKey"`
+    RelationshipID uint `gorm:"index"`
+    EventID uint `gorm:"index"`
+    Type string
+    Intimacy float64
+    Note string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// RelationshipType is a kind of relationship between characters. Setting
+// a symmetric type (同盟、结义) from A to B sets it from B to A as well;
+// other types, and those never registered, hold one way only.
+type RelationshipType struct {
+    ID uint `gorm:"primaryKey"`
+    Name string `gorm:"index"`
+    Symmetric bool
+    Description string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// LocationLinkTypes are the ways two locations can be connected.
+var LocationLinkTypes = []string{"adjacent", "road", "portal"}
+
+// LocationRelationship connects two locations, both ways unless OneWay,
+// when it only leads from A to B. Distance is in whatever unit the novel
+// uses, 0 when unknown; TravelHours is the least time the journey takes,
+// nil when unknown.
 type LocationRelationship struct {
     ID uint `gorm:"primaryKey"`
     AID uint `gorm:"index"`
     BID uint `gorm:"index"`
     Type string
+    Distance float64
+    TravelHours *float64
+    OneWay bool
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Organization is a sect, clan, court or any other body characters belong
+// to. ParentID, if set, is the organization it is part of, in the same
+// world, as a peak is part of a sect and a hall part of a peak.
+type Organization struct {
+    ID uint `gorm:"primaryKey"`
+    WorldID uint `gorm:"index"`
+    ParentID uint `gorm:"index"`
+    Name string
+    Description string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// OrganizationMembership is a character's membership of an organization
+// from the event where they join until the one where they leave. A
+// JoinEventID of 0 means from before the story, a LeaveEventID of 0 that
+// they have not left. A change of rank is a new membership joined at the
+// event where the old one is left.
+type OrganizationMembership struct {
+    ID uint `gorm:"primaryKey"`
+    OrganizationID uint `gorm:"index"`
+    CharacterID uint `gorm:"index"`
+    Rank string
+    JoinEventID uint `gorm:"index"`
+    LeaveEventID uint `gorm:"index"`
+    Note string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// OrganizationRelationship is how two organizations stand toward each
+// other, such as alliance or feud; it reads the same both ways. Exclusive
+// means no character may belong to both at once, counting membership of
+// their sub-organizations.
+type OrganizationRelationship struct {
+    ID uint `gorm:"primaryKey"`
+    AID uint `gorm:"index"`
+    BID uint `gorm:"index"`
+    Type string
+    Exclusive bool
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// Item is a thing, or a stack of Quantity like things (100 spirit stones),
+// as there were when it came into being. OwnerCharacterID, LocationID and
+// ContainerItemID say who or what holds it now, one of them at most; all
+// are 0 when nothing does, or while the stack is split between holders.
+// Its ItemTransfers, replayed in story order, say who held how much when.
 type Item struct {
     ID uint `gorm:"primaryKey"`
     Name string
     OwnerCharacterID uint `gorm:"index"`
     LocationID uint `gorm:"index"`
+    ContainerItemID uint `gorm:"index"`
+    Quantity int `gorm:"default:1"`
     Status string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// ItemTransferKinds are the kinds of custody change: an item moving from
+// one holder to another, coming into being, or being destroyed or used up.
+var ItemTransferKinds = []string{"transfer", "create", "destroy"}
+
+// ItemTransfer is a custody change of Quantity of an item at an event. The
+// source is a character, location or container item, or none for a
+// creation or when unknown; the destination likewise, none for a
+// destruction. A Quantity of 0 moves all the source holds. An empty Kind,
+// from before kinds existed, is a transfer.
 type ItemTransfer struct {
     ID uint `gorm:"primaryKey"`
     ItemID uint `gorm:"index"`
+    Kind string
     FromCharacterID uint
+    FromLocationID uint
+    FromContainerItemID uint
     ToCharacterID uint
+    ToLocationID uint
+    ToContainerItemID uint
+    Quantity int
     EventID uint
     CreatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Ability is something a character can do. EventID is the event at which
+// they gained it, 0 when they had it from the start; Level is the level
+// after every upgrade.
 type Ability struct {
     ID uint `gorm:"primaryKey"`
     CharacterID uint `gorm:"index"`
+    EventID uint `gorm:"index"`
     Name string
     Level int
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// AbilityUpgrade is an ability reaching Level at an event, or after every
+// event when EventID is 0. From is the level the ability had when the
+// upgrade was recorded, so the first upgrade recorded keeps the level it
+// started at.
+type AbilityUpgrade struct {
+    ID uint `gorm:"primaryKey"`
+    AbilityID uint `gorm:"index"`
+    EventID uint `gorm:"index"`
+    From int
+    Level int
+    CreatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type AbilityUsage struct {
@@ -127,6 +345,7 @@ type AbilityUsage struct {
     EventID uint
     Note string
     CreatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type PlotThread struct {
@@ -136,19 +355,73 @@ type PlotThread struct {
     Stage string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+// Scene is a stretch of a chapter told from one point of view in one place
+// and time. Index orders it within its chapter; StartParagraph and
+// EndParagraph are the 1-based paragraphs of the chapter's content it
+// spans, both 0 while it is not written yet.
+type Scene struct {
+    ID uint `gorm:"primaryKey"`
+    ChapterID uint `gorm:"index"`
+    Index int
+    Title string
+    POVCharacterID uint `gorm:"index"`
+    LocationID uint `gorm:"index"`
+    TimeSegmentID uint `gorm:"index"`
+    Goal string
+    Conflict string
+    Outcome string
+    StartParagraph int
+    EndParagraph int
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// Event is one happening of the story. Seq orders it within its chapter as
+// narrated; StoryTime, when known, places it in the world's time more
+// precisely than its TimeSegment. SceneID, if set, is a scene of the same
+// chapter.
 type Event struct {
     ID uint `gorm:"primaryKey"`
     ChapterID uint `gorm:"index"`
+    SceneID uint `gorm:"index"`
+    Seq int
     WorldID uint `gorm:"index"`
     LocationID uint `gorm:"index"`
     TimeSegmentID uint `gorm:"index"`
+    StoryTime *time.Time `gorm:"index"`
     Description string
-    Characters string
-    Items string
+    Participants []EventParticipant `gorm:"foreignKey:EventID"`
+    Items []EventItem `gorm:"foreignKey:EventID"`
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// ParticipantRoles are how a character or item figures in an event.
+var ParticipantRoles = []string{"protagonist", "observer", "mentioned", "offscreen"}
+
+type EventParticipant struct {
+    ID uint `gorm:"primaryKey"`
+    EventID uint `gorm:"index"`
+    CharacterID uint `gorm:"index"`
+    Role string
+    CreatedAt time.Time
+    UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+type EventItem struct {
+    ID uint `gorm:"primaryKey"`
+    EventID uint `gorm:"index"`
+    ItemID uint `gorm:"index"`
+    Role string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
 type Memory struct {
@@ -159,8 +432,13 @@ type Memory struct {
     Trigger string
     CreatedAt time.Time
     UpdatedAt time.Time
+    DeletedAt gorm.DeletedAt `gorm:"index"`
 }
 
+var ChapterStatuses = []string{"草稿", "开始", "进行中", "结束", "完成"}
+
+var PlotStages = []string{"开始", "进行中", "关键点", "结束"}
+
 type ExportResult struct {
     Content string
 }
@@ -176,4 +454,18 @@ type StyleRef struct {
     Content string
     CreatedAt time.Time
     UpdatedAt time.Time
-}
\ No newline at end of file
+    DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+// TrashEntry records one delete so it can be listed, restored or purged.
+// Deleted maps entity kinds to the soft-deleted IDs; Changes holds the
+// references the delete cleared or moved, both as JSON.
+type TrashEntry struct {
+    ID uint `gorm:"primaryKey"`
+    Entity string `gorm:"index"`
+    EntityID uint
+    Label string
+    Deleted string
+    Changes string
+    CreatedAt time.Time `gorm:"index"`
+}
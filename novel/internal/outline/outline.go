@@ -1,7 +1,9 @@
 package outline
 
 import (
+	"context"
 	"mcpnovel/internal/models"
+	"mcpnovel/internal/progress"
 	"strings"
 
 	"gorm.io/gorm"
@@ -13,29 +15,148 @@ type Generator struct {
 
 func (g *Generator) ChapterOutline(chapterID uint) (string, error) {
 	var e []models.Event
-	if err := g.DB.Where("chapter_id = ?", chapterID).Order("id asc").Find(&e).Error; err != nil {
+	byID := func(db *gorm.DB) *gorm.DB { return db.Order("id asc") }
+	if err := g.DB.Preload("Participants", byID).Preload("Items", byID).Where("chapter_id = ?", chapterID).Order("seq asc, id asc").Find(&e).Error; err != nil {
+		return "", err
+	}
+	var scenes []models.Scene
+	if err := g.DB.Where("chapter_id = ?", chapterID).Order("`index` asc, id asc").Find(&scenes).Error; err != nil {
 		return "", err
 	}
 	var b strings.Builder
 	b.WriteString("章节细纲\n")
-	for i, ev := range e {
-		b.WriteString("事件")
-		b.WriteString(intToString(i + 1))
-		b.WriteString(": ")
-		b.WriteString(ev.Description)
-		b.WriteString("\n")
+	if len(scenes) == 0 {
+		for i, ev := range e {
+			g.event(&b, i+1, ev)
+		}
+		return b.String(), nil
+	}
+	// Events keep their narrative numbers when grouped by scene.
+	placed := map[uint]bool{}
+	for i, sc := range scenes {
+		g.scene(&b, i+1, sc)
+		for n, ev := range e {
+			if ev.SceneID == sc.ID {
+				g.event(&b, n+1, ev)
+				placed[ev.ID] = true
+			}
+		}
+	}
+	header := false
+	for n, ev := range e {
+		if placed[ev.ID] {
+			continue
+		}
+		if !header {
+			b.WriteString("未分场景\n")
+			header = true
+		}
+		g.event(&b, n+1, ev)
 	}
 	return b.String(), nil
 }
 
-func (g *Generator) VolumeOutline(volumeID uint) (string, error) {
+func (g *Generator) event(b *strings.Builder, n int, ev models.Event) {
+	b.WriteString("事件")
+	b.WriteString(intToString(n))
+	b.WriteString(": ")
+	b.WriteString(ev.Description)
+	if cast := g.cast(ev); cast != "" {
+		b.WriteString("（")
+		b.WriteString(cast)
+		b.WriteString("）")
+	}
+	b.WriteString("\n")
+}
+
+// scene writes a scene break line such as
+// "场景1：夜袭（视角：甲；地点：城门；时间：子夜）" and the scene's goal,
+// conflict and outcome.
+func (g *Generator) scene(b *strings.Builder, n int, sc models.Scene) {
+	b.WriteString("场景")
+	b.WriteString(intToString(n))
+	if sc.Title != "" {
+		b.WriteString("：")
+		b.WriteString(sc.Title)
+	}
+	var setting []string
+	var c models.Character
+	if sc.POVCharacterID != 0 && g.DB.First(&c, sc.POVCharacterID).Error == nil {
+		setting = append(setting, "视角："+c.Name)
+	}
+	var l models.Location
+	if sc.LocationID != 0 && g.DB.First(&l, sc.LocationID).Error == nil {
+		setting = append(setting, "地点："+l.Name)
+	}
+	var ts models.TimeSegment
+	if sc.TimeSegmentID != 0 && g.DB.First(&ts, sc.TimeSegmentID).Error == nil {
+		setting = append(setting, "时间："+ts.Name)
+	}
+	if len(setting) > 0 {
+		b.WriteString("（")
+		b.WriteString(strings.Join(setting, "；"))
+		b.WriteString("）")
+	}
+	b.WriteString("\n")
+	var arc []string
+	for _, f := range [][2]string{{"目标", sc.Goal}, {"冲突", sc.Conflict}, {"结果", sc.Outcome}} {
+		if f[1] != "" {
+			arc = append(arc, f[0]+"："+f[1])
+		}
+	}
+	if len(arc) > 0 {
+		b.WriteString(strings.Join(arc, "；"))
+		b.WriteString("\n")
+	}
+}
+
+// roleLabels mark participants who are not acting on stage.
+var roleLabels = map[string]string{"observer": "旁观", "mentioned": "提及", "offscreen": "幕后"}
+
+// cast lists the characters and items of an event, e.g.
+// "人物：甲、乙〔旁观〕；物品：剑".
+func (g *Generator) cast(ev models.Event) string {
+	var chars, items []string
+	for _, p := range ev.Participants {
+		var c models.Character
+		if err := g.DB.First(&c, p.CharacterID).Error; err == nil {
+			chars = append(chars, c.Name+role(p.Role))
+		}
+	}
+	for _, l := range ev.Items {
+		var it models.Item
+		if err := g.DB.First(&it, l.ItemID).Error; err == nil {
+			items = append(items, it.Name+role(l.Role))
+		}
+	}
+	var parts []string
+	if len(chars) > 0 {
+		parts = append(parts, "人物："+strings.Join(chars, "、"))
+	}
+	if len(items) > 0 {
+		parts = append(parts, "物品："+strings.Join(items, "、"))
+	}
+	return strings.Join(parts, "；")
+}
+
+func role(r string) string {
+	if l := roleLabels[r]; l != "" {
+		return "〔" + l + "〕"
+	}
+	return ""
+}
+
+func (g *Generator) VolumeOutline(ctx context.Context, volumeID uint) (string, error) {
 	var chs []models.Chapter
-	if err := g.DB.Where("volume_id = ?", volumeID).Order("`index` asc").Find(&chs).Error; err != nil {
+	if err := g.DB.WithContext(ctx).Where("volume_id = ?", volumeID).Order("`index` asc, id asc").Find(&chs).Error; err != nil {
 		return "", err
 	}
 	var b strings.Builder
 	b.WriteString("分卷总纲\n")
 	for _, c := range chs {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
 		co, err := g.ChapterOutline(c.ID)
 		if err != nil {
 			return "", err
@@ -48,15 +169,15 @@ func (g *Generator) VolumeOutline(volumeID uint) (string, error) {
 	return b.String(), nil
 }
 
-func (g *Generator) NovelOutline(novelID uint) (string, error) {
+func (g *Generator) NovelOutline(ctx context.Context, novelID uint) (string, error) {
 	var vols []models.Volume
-	if err := g.DB.Where("novel_id = ?", novelID).Order("`index` asc").Find(&vols).Error; err != nil {
+	if err := g.DB.WithContext(ctx).Where("novel_id = ?", novelID).Order("`index` asc, id asc").Find(&vols).Error; err != nil {
 		return "", err
 	}
 	var b strings.Builder
 	b.WriteString("小说总纲\n")
-	for _, v := range vols {
-		vo, err := g.VolumeOutline(v.ID)
+	for i, v := range vols {
+		vo, err := g.VolumeOutline(ctx, v.ID)
 		if err != nil {
 			return "", err
 		}
@@ -64,6 +185,7 @@ func (g *Generator) NovelOutline(novelID uint) (string, error) {
 		b.WriteString("\n")
 		b.WriteString(vo)
 		b.WriteString("\n")
+		progress.Report(ctx, float64(i+1), float64(len(vols)), v.Title)
 	}
 	return b.String(), nil
 }
@@ -75,7 +197,7 @@ func intToString(i int) string {
 	}
 	for i > 0 {
 		d := i % 10
-		s = string('0'+d) + s
+		s = string(rune('0'+d)) + s
 		i = i / 10
 	}
 	return s
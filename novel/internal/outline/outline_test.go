@@ -0,0 +1,57 @@
+package outline
+
+import (
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"testing"
+)
+
+func TestChapterOutlineScenes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scenes []any
+		want   string
+	}{
+		{"no scenes", nil, "章节细纲\n事件1: 潜入（人物：甲、乙〔旁观〕）\n事件2: 交手\n事件3: 撤离\n"},
+		{"scene breaks", []any{
+			&models.Scene{ID: 1, ChapterID: 1, Index: 1, Title: "夜袭", POVCharacterID: 1, LocationID: 1, Goal: "取剑"},
+			&models.Scene{ID: 2, ChapterID: 1, Index: 2},
+		}, "章节细纲\n场景1：夜袭（视角：甲；地点：城门）\n目标：取剑\n事件1: 潜入（人物：甲、乙〔旁观〕）\n事件3: 撤离\n场景2\n未分场景\n事件2: 交手\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := storage.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AutoMigrate(&models.Chapter{}, &models.Scene{}, &models.Event{}, &models.EventParticipant{}, &models.EventItem{},
+				&models.Character{}, &models.Location{}, &models.TimeSegment{}, &models.Item{}); err != nil {
+				t.Fatal(err)
+			}
+			sceneOf := uint(0)
+			if tt.scenes != nil {
+				sceneOf = 1
+			}
+			rows := []any{
+				&models.Chapter{ID: 1}, &models.Character{ID: 1, Name: "甲"}, &models.Character{ID: 2, Name: "乙"}, &models.Location{ID: 1, Name: "城门"},
+				&models.Event{ID: 1, ChapterID: 1, Seq: 1, SceneID: sceneOf, Description: "潜入"},
+				&models.Event{ID: 2, ChapterID: 1, Seq: 2, Description: "交手"},
+				&models.Event{ID: 3, ChapterID: 1, Seq: 3, SceneID: sceneOf, Description: "撤离"},
+				&models.EventParticipant{EventID: 1, CharacterID: 1, Role: "protagonist"},
+				&models.EventParticipant{EventID: 1, CharacterID: 2, Role: "observer"},
+			}
+			for _, r := range append(rows, tt.scenes...) {
+				if err := db.Create(r).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := (&Generator{DB: db}).ChapterOutline(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("outline =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package outline
+
+import (
+	"context"
+	"mcpnovel/internal/models"
+	"mcpnovel/tool"
+)
+
+// Result is an outline returned by a tool; its text content is the outline itself.
+type Result struct {
+	Outline string `json:"outline"`
+}
+
+func (r Result) Text() string { return r.Outline }
+
+type idArgs struct {
+	ID uint `json:"id" schema:"required,minimum=1" desc:"目标 ID"`
+}
+
+type novelRefArgs struct {
+	ID         uint   `json:"id" desc:"小说 ID，与 novelTitle 二选一"`
+	NovelTitle string `json:"novelTitle" desc:"小说标题，id 为空时按标题查找"`
+}
+
+// Tools returns outlineGeneratorHelper and the outline actions of
+// novelHelper and chapterHelper, which the registry merges into those tools.
+func Tools(g *Generator) []tool.Tool {
+	chapter := tool.Handle("chapter", "生成章节细纲", func(_ context.Context, a idArgs) (any, error) {
+		return result(g.ChapterOutline(a.ID))
+	}).ReadOnly()
+	novel := func(ctx context.Context, a novelRefArgs) (any, error) {
+		id := a.ID
+		if id == 0 && a.NovelTitle != "" {
+			var n models.Novel
+			if err := g.DB.Where("title = ?", a.NovelTitle).First(&n).Error; err != nil {
+				return nil, err
+			}
+			id = n.ID
+		}
+		return result(g.NovelOutline(ctx, id))
+	}
+	return []tool.Tool{
+		tool.NewActions("outlineGeneratorHelper", "纲要生成",
+			chapter,
+			tool.Handle("volume", "生成分卷总纲", func(ctx context.Context, a idArgs) (any, error) {
+				return result(g.VolumeOutline(ctx, a.ID))
+			}).ReadOnly(),
+			tool.Handle("novel", "生成小说总纲", novel).ReadOnly(),
+		),
+		tool.NewActions("novelHelper", "小说管理",
+			tool.Handle("outline", "生成小说总纲", func(ctx context.Context, a idArgs) (any, error) {
+				return result(g.NovelOutline(ctx, a.ID))
+			}).ReadOnly(),
+		),
+		tool.NewActions("chapterHelper", "章节管理",
+			tool.Handle("outline", "生成章节细纲", func(_ context.Context, a idArgs) (any, error) {
+				return result(g.ChapterOutline(a.ID))
+			}).ReadOnly(),
+		),
+	}
+}
+
+func result(o string, err error) (any, error) {
+	if err != nil {
+		return nil, err
+	}
+	return Result{Outline: o}, nil
+}
@@ -0,0 +1,19 @@
+package progress
+
+import "context"
+
+// Func receives progress updates; total is 0 when unknown.
+type Func func(progress float64, total float64, message string)
+
+type key struct{}
+
+func With(ctx context.Context, f Func) context.Context {
+	return context.WithValue(ctx, key{}, f)
+}
+
+// Report forwards to the Func attached to ctx, if any.
+func Report(ctx context.Context, progress float64, total float64, message string) {
+	if f, ok := ctx.Value(key{}).(Func); ok && f != nil {
+		f(progress, total, message)
+	}
+}
@@ -0,0 +1,388 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enumer is implemented by string types that only admit a fixed set of values.
+type Enumer interface {
+	Enum() []string
+}
+
+type field struct {
+	Name      string
+	Index     []int
+	Desc      string
+	Required  bool
+	Enum      []string
+	Minimum   *float64
+	Maximum   *float64
+	Format    string
+	MinLength int
+	Type      reflect.Type
+}
+
+func fields(t reflect.Type) []field {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			for _, f := range fields(sf.Type) {
+				f.Index = append([]int{i}, f.Index...)
+				out = append(out, f)
+			}
+			continue
+		}
+		name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+		f := field{Name: name, Index: []int{i}, Desc: sf.Tag.Get("desc"), Type: sf.Type}
+		et := sf.Type
+		for et.Kind() == reflect.Pointer {
+			et = et.Elem()
+		}
+		if e, ok := reflect.Zero(et).Interface().(Enumer); ok {
+			f.Enum = e.Enum()
+		}
+		for _, opt := range strings.Split(sf.Tag.Get("schema"), ",") {
+			k, v, _ := strings.Cut(opt, "=")
+			switch k {
+			case "required":
+				f.Required = true
+			case "enum":
+				f.Enum = strings.Split(v, "|")
+			case "minimum":
+				n, _ := strconv.ParseFloat(v, 64)
+				f.Minimum = &n
+			case "maximum":
+				n, _ := strconv.ParseFloat(v, 64)
+				f.Maximum = &n
+			case "format":
+				f.Format = v
+			case "minLength":
+				f.MinLength, _ = strconv.Atoi(v)
+			}
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// For returns the JSON Schema object describing the struct type of v.
+// Fields are read from their tags:
+//
+//	json:"name"    property name; fields without a json name are skipped
+//	desc:"..."     property description
+//	schema:"required,enum=a|b,minimum=0,maximum=1,format=date-time"
+func For(v any) map[string]any {
+	props := map[string]any{}
+	required := []string{}
+	for _, f := range fields(reflect.TypeOf(v)) {
+		props[f.Name] = property(f)
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	return map[string]any{"type": "object", "properties": props, "required": required, "additionalProperties": false}
+}
+
+func property(f field) map[string]any {
+	p := typeSchema(f.Type)
+	if f.Desc != "" {
+		p["description"] = f.Desc
+	}
+	// The other tags of an array field constrain its elements.
+	c := p
+	if items, ok := p["items"].(map[string]any); ok {
+		f, c = elemField(f, deref(f.Type).Elem()), items
+	}
+	if len(f.Enum) > 0 {
+		c["enum"] = f.Enum
+	}
+	if f.Minimum != nil {
+		c["minimum"] = *f.Minimum
+	}
+	if f.Maximum != nil {
+		c["maximum"] = *f.Maximum
+	}
+	if f.Format != "" {
+		c["format"] = f.Format
+	}
+	if f.MinLength > 0 {
+		c["minLength"] = f.MinLength
+	}
+	return p
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func typeSchema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return For(reflect.New(t).Elem().Interface())
+	case reflect.Map:
+		return map[string]any{"type": "object"}
+	}
+	return map[string]any{}
+}
+
+// Action describes one value of a tool's "action" discriminator.
+type Action struct {
+	Name        string
+	Description string
+	Args        any
+}
+
+// ForActions builds a tool input schema with one oneOf branch per action,
+// each pinning "action" to a const and listing that action's arguments.
+func ForActions(actions []Action) map[string]any {
+	names := make([]string, 0, len(actions))
+	branches := make([]any, 0, len(actions))
+	for _, a := range actions {
+		names = append(names, a.Name)
+		s := For(a.Args)
+		props := s["properties"].(map[string]any)
+		props["action"] = map[string]any{"const": a.Name}
+		s["required"] = append([]string{"action"}, s["required"].([]string)...)
+		if a.Description != "" {
+			s["description"] = a.Description
+		}
+		s["title"] = a.Name
+		branches = append(branches, s)
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{"type": "string", "enum": names, "description": "操作类型"},
+		},
+		"required": []string{"action"},
+		"oneOf":    branches,
+	}
+}
+
+// FieldError reports an argument that does not satisfy its schema.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// Decode validates args against the schema of v's struct type and then
+// decodes them into v. Keys listed in extra are accepted without a field.
+func Decode(args map[string]any, v any, extra ...string) error {
+	if err := checkObject("", fields(reflect.TypeOf(v)), args, extra...); err != nil {
+		return err
+	}
+	b, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// checkObject validates obj against fs, prefixing reported fields with path.
+func checkObject(path string, fs []field, obj map[string]any, extra ...string) error {
+	known := map[string]bool{}
+	for _, k := range extra {
+		known[k] = true
+	}
+	for _, f := range fs {
+		known[f.Name] = true
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !known[k] {
+			return &FieldError{Field: path + k, Msg: "unknown field"}
+		}
+	}
+	for _, f := range fs {
+		val, ok := obj[f.Name]
+		if !ok || val == nil {
+			if f.Required {
+				return &FieldError{Field: path + f.Name, Msg: "missing required field"}
+			}
+			continue
+		}
+		if err := check(path+f.Name, f, f.Type, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func check(path string, f field, t reflect.Type, val any) error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		s, ok := val.(string)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected RFC3339 time string, got %s", jsonType(val))}
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("invalid RFC3339 time %q", s)}
+		}
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		s, ok := val.(string)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected string, got %s", jsonType(val))}
+		}
+		if f.Required && s == "" {
+			return &FieldError{Field: path, Msg: "must not be empty"}
+		}
+		if len([]rune(s)) < f.MinLength {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("must be at least %d characters", f.MinLength)}
+		}
+		if len(f.Enum) > 0 && s != "" && !slices.Contains(f.Enum, s) {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("must be one of %s", strings.Join(f.Enum, ", "))}
+		}
+		if f.Format == "date-time" && s != "" {
+			if _, err := time.Parse(time.RFC3339, s); err != nil {
+				return &FieldError{Field: path, Msg: fmt.Sprintf("invalid RFC3339 time %q", s)}
+			}
+		}
+	case reflect.Bool:
+		if _, ok := val.(bool); !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected boolean, got %s", jsonType(val))}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := val.(float64)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected integer, got %s", jsonType(val))}
+		}
+		if n != math.Trunc(n) {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected integer, got %v", n)}
+		}
+		if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 && n < 0 {
+			return &FieldError{Field: path, Msg: "must not be negative"}
+		}
+		if lo, hi := intRange(t); n < lo || n >= hi {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("out of range for %s", t.Kind())}
+		}
+		return checkRange(path, f, n)
+	case reflect.Float32, reflect.Float64:
+		n, ok := val.(float64)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected number, got %s", jsonType(val))}
+		}
+		return checkRange(path, f, n)
+	case reflect.Map:
+		if _, ok := val.(map[string]any); !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected object, got %s", jsonType(val))}
+		}
+	case reflect.Struct:
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected object, got %s", jsonType(val))}
+		}
+		return checkObject(path+".", fields(t), obj)
+	case reflect.Slice, reflect.Array:
+		a, ok := val.([]any)
+		if !ok {
+			return &FieldError{Field: path, Msg: fmt.Sprintf("expected array, got %s", jsonType(val))}
+		}
+		elem := elemField(f, t.Elem())
+		for i, e := range a {
+			if err := check(fmt.Sprintf("%s[%d]", path, i), elem, t.Elem(), e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elemField is the field each element of the array field f is checked
+// against: f's tags, with the enum of an Enumer element type when f has none.
+func elemField(f field, et reflect.Type) field {
+	elem := f
+	elem.Type = et
+	elem.Required = false
+	elem.Desc = ""
+	if e, ok := reflect.Zero(deref(et)).Interface().(Enumer); ok && len(elem.Enum) == 0 {
+		elem.Enum = e.Enum()
+	}
+	return elem
+}
+
+func deref(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// intRange is the half-open range [lo, hi) of the integer kind t holds.
+func intRange(t reflect.Type) (lo, hi float64) {
+	bits := t.Bits()
+	if t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64 {
+		return 0, math.Ldexp(1, bits)
+	}
+	return -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+}
+
+func checkRange(path string, f field, n float64) error {
+	if f.Minimum != nil && n < *f.Minimum {
+		return &FieldError{Field: path, Msg: fmt.Sprintf("must be >= %v", *f.Minimum)}
+	}
+	if f.Maximum != nil && n > *f.Maximum {
+		return &FieldError{Field: path, Msg: fmt.Sprintf("must be <= %v", *f.Maximum)}
+	}
+	return nil
+}
+
+func jsonType(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "null"
+}
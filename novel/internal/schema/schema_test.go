@@ -0,0 +1,198 @@
+package schema
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+type color string
+
+func (color) Enum() []string { return []string{"red", "blue"} }
+
+type point struct {
+	X int `json:"x" schema:"required"`
+	Y int `json:"y"`
+}
+
+type args struct {
+	ID     uint       `json:"id" schema:"required,minimum=1" desc:"ID"`
+	Name   string     `json:"name" schema:"minLength=2"`
+	Color  color      `json:"color"`
+	Stage  string     `json:"stage" schema:"enum=draft|done"`
+	Weight *float64   `json:"weight" schema:"minimum=0,maximum=1"`
+	At     *time.Time `json:"at"`
+	Day    string     `json:"day" schema:"format=date-time"`
+	Flag   bool       `json:"flag"`
+	Tags   []string   `json:"tags"`
+	Points []point    `json:"points"`
+	Origin *point     `json:"origin"`
+	Fields map[string]any
+	Extra  map[string]any `json:"extra"`
+	Small  int8           `json:"small"`
+	Levels []int          `json:"levels" schema:"minimum=1"`
+	Colors []color        `json:"colors"`
+	Stages []string       `json:"stages" schema:"enum=draft|done"`
+}
+
+// decode parses args from JSON, as they arrive in a tool call.
+func decode(t *testing.T, s string, extra ...string) (args, error) {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	var a args
+	return a, Decode(m, &a, extra...)
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		field string
+		msg   string
+	}{
+		{"valid", `{"id":1,"name":"ab","color":"red","stage":"done","weight":0.5,"at":"2000-01-01T00:00:00Z","flag":true,"tags":["a"],"points":[{"x":1}],"origin":{"x":0,"y":2},"extra":{}}`, "", ""},
+		{"missing required", `{}`, "id", "missing required field"},
+		{"null required", `{"id":null}`, "id", "missing required field"},
+		{"unknown field", `{"id":1,"nope":1}`, "nope", "unknown field"},
+		{"untagged field", `{"id":1,"Fields":{}}`, "Fields", "unknown field"},
+		{"below minimum", `{"id":0}`, "id", "must be >= 1"},
+		{"negative uint", `{"id":-1}`, "id", "must not be negative"},
+		{"fraction", `{"id":1.5}`, "id", "expected integer, got 1.5"},
+		{"string for integer", `{"id":"1"}`, "id", "expected integer, got string"},
+		{"above maximum", `{"id":1,"weight":2}`, "weight", "must be <= 1"},
+		{"too short", `{"id":1,"name":"a"}`, "name", "must be at least 2 characters"},
+		{"enum type", `{"id":1,"color":"green"}`, "color", "must be one of red, blue"},
+		{"enum tag", `{"id":1,"stage":"wip"}`, "stage", "must be one of draft, done"},
+		{"empty enum", `{"id":1,"stage":""}`, "", ""},
+		{"bad time", `{"id":1,"at":"yesterday"}`, "at", `invalid RFC3339 time "yesterday"`},
+		{"time type", `{"id":1,"at":1}`, "at", "expected RFC3339 time string, got number"},
+		{"date-time format", `{"id":1,"day":"1 May"}`, "day", `invalid RFC3339 time "1 May"`},
+		{"bool", `{"id":1,"flag":"yes"}`, "flag", "expected boolean, got string"},
+		{"array", `{"id":1,"tags":"a"}`, "tags", "expected array, got string"},
+		{"array element", `{"id":1,"tags":["a",2]}`, "tags[1]", "expected string, got number"},
+		{"nested required", `{"id":1,"points":[{"x":1},{"y":1}]}`, "points[1].x", "missing required field"},
+		{"nested unknown", `{"id":1,"origin":{"x":1,"z":1}}`, "origin.z", "unknown field"},
+		{"object", `{"id":1,"extra":[]}`, "extra", "expected object, got array"},
+		{"past uint", `{"id":1e30}`, "id", "out of range for uint"},
+		{"past int8", `{"id":1,"small":128}`, "small", "out of range for int8"},
+		{"below int8", `{"id":1,"small":-129}`, "small", "out of range for int8"},
+		{"int8 bounds", `{"id":1,"small":-128}`, "", ""},
+		{"element minimum", `{"id":1,"levels":[1,0]}`, "levels[1]", "must be >= 1"},
+		{"element enum type", `{"id":1,"colors":["red","green"]}`, "colors[1]", "must be one of red, blue"},
+		{"element enum tag", `{"id":1,"stages":["done","wip"]}`, "stages[1]", "must be one of draft, done"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(t, tt.in)
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Decode = %v; want no error", err)
+				}
+				return
+			}
+			fe, ok := err.(*FieldError)
+			if !ok {
+				t.Fatalf("Decode = %v; want a FieldError", err)
+			}
+			if fe.Field != tt.field || fe.Msg != tt.msg {
+				t.Errorf("Decode = %q: %q; want %q: %q", fe.Field, fe.Msg, tt.field, tt.msg)
+			}
+		})
+	}
+}
+
+func TestDecodeValues(t *testing.T) {
+	a, err := decode(t, `{"id":3,"color":"blue","weight":0,"points":[{"x":1,"y":2}],"action":"x"}`, "action")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.ID != 3 || a.Color != "blue" || a.Weight == nil || *a.Weight != 0 || len(a.Points) != 1 || a.Points[0].Y != 2 {
+		t.Errorf("Decode = %+v", a)
+	}
+}
+
+func TestFor(t *testing.T) {
+	s := For(args{})
+	if got, want := s["required"], []string{"id"}; !slices.Equal(got.([]string), want) {
+		t.Errorf("required = %v; want %v", got, want)
+	}
+	props := s["properties"].(map[string]any)
+	if _, ok := props["Fields"]; ok {
+		t.Error("untagged field has a property")
+	}
+	tests := []struct {
+		prop, key string
+		want      any
+	}{
+		{"id", "type", "integer"},
+		{"id", "minimum", 1.0},
+		{"id", "description", "ID"},
+		{"color", "enum", []string{"red", "blue"}},
+		{"stage", "enum", []string{"draft", "done"}},
+		{"weight", "type", "number"},
+		{"weight", "maximum", 1.0},
+		{"at", "format", "date-time"},
+		{"name", "minLength", 2},
+		{"tags", "type", "array"},
+		{"origin", "type", "object"},
+		{"levels", "minimum", nil},
+		{"stages", "enum", nil},
+	}
+	for _, tt := range tests {
+		got := props[tt.prop].(map[string]any)[tt.key]
+		if g, _ := json.Marshal(got); string(g) != mustJSON(t, tt.want) {
+			t.Errorf("%s.%s = %v; want %v", tt.prop, tt.key, got, tt.want)
+		}
+	}
+	items := []struct {
+		prop, key string
+		want      any
+	}{
+		{"levels", "minimum", 1.0},
+		{"colors", "enum", []string{"red", "blue"}},
+		{"stages", "enum", []string{"draft", "done"}},
+	}
+	for _, tt := range items {
+		got := props[tt.prop].(map[string]any)["items"].(map[string]any)[tt.key]
+		if g, _ := json.Marshal(got); string(g) != mustJSON(t, tt.want) {
+			t.Errorf("%s.items.%s = %v; want %v", tt.prop, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestForActions(t *testing.T) {
+	s := ForActions([]Action{{Name: "get", Description: "读取", Args: point{}}, {Name: "list", Args: struct{}{}}})
+	if got := s["properties"].(map[string]any)["action"].(map[string]any)["enum"]; !slices.Equal(got.([]string), []string{"get", "list"}) {
+		t.Errorf("action enum = %v", got)
+	}
+	branches := s["oneOf"].([]any)
+	if len(branches) != 2 {
+		t.Fatalf("got %d branches, want 2", len(branches))
+	}
+	get := branches[0].(map[string]any)
+	if got := get["required"].([]string); !slices.Equal(got, []string{"action", "x"}) {
+		t.Errorf("get required = %v", got)
+	}
+	if get["title"] != "get" || get["description"] != "读取" {
+		t.Errorf("get branch = %v", get)
+	}
+	if c := get["properties"].(map[string]any)["action"].(map[string]any)["const"]; c != "get" {
+		t.Errorf("get action const = %v", c)
+	}
+	if _, ok := branches[1].(map[string]any)["description"]; ok {
+		t.Error("list branch has a description")
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
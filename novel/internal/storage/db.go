@@ -1,10 +1,27 @@
 package storage
 
 import (
+    "log"
+    "os"
+    "strings"
+    "time"
+
     "gorm.io/driver/sqlite"
     "gorm.io/gorm"
+    "gorm.io/gorm/logger"
 )
 
+// Open keeps gorm's log on stderr, since stdout carries the stdio transport,
+// and sets a busy timeout so concurrent HTTP sessions wait instead of failing.
 func Open(path string) (*gorm.DB, error) {
-    return gorm.Open(sqlite.Open(path), &gorm.Config{})
-}
\ No newline at end of file
+    dsn := path
+    if !strings.Contains(dsn, "?") {
+        dsn += "?_busy_timeout=5000&_journal_mode=WAL"
+    }
+    l := logger.New(log.New(os.Stderr, "\r\n", log.LstdFlags), logger.Config{
+        SlowThreshold:             200 * time.Millisecond,
+        LogLevel:                  logger.Warn,
+        IgnoreRecordNotFoundError: true,
+    })
+    return gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: l})
+}
@@ -0,0 +1,156 @@
+// Package travel finds how long it takes to get from one location to
+// another over their relationships, and which locations lie within others.
+package travel
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Leg is one relationship taken in the direction of travel.
+type Leg struct {
+	RelationshipID uint
+	From           uint
+	To             uint
+	Type           string
+	Hours          float64
+	Distance       float64
+}
+
+// Graph holds every location relationship with a known travel time and
+// the parent of every location.
+type Graph struct {
+	legs   map[uint][]Leg
+	parent map[uint]uint
+}
+
+// Load reads the locations and relationships that are not deleted.
+func Load(db *gorm.DB) (*Graph, error) {
+	var rels []struct {
+		ID          uint
+		AID         uint
+		BID         uint
+		Type        string
+		Distance    float64
+		TravelHours *float64
+		OneWay      bool
+	}
+	err := db.Table("location_relationships").
+		Select("id, a_id, b_id, type, distance, travel_hours, one_way").
+		Where("deleted_at IS NULL AND travel_hours IS NOT NULL").
+		Order("id asc").
+		Scan(&rels).Error
+	if err != nil {
+		return nil, err
+	}
+	var locs []struct {
+		ID       uint
+		ParentID uint
+	}
+	if err := db.Table("locations").Select("id, parent_id").Where("deleted_at IS NULL").Scan(&locs).Error; err != nil {
+		return nil, err
+	}
+	g := &Graph{legs: map[uint][]Leg{}, parent: map[uint]uint{}}
+	for _, l := range locs {
+		g.parent[l.ID] = l.ParentID
+	}
+	for _, r := range rels {
+		if _, ok := g.parent[r.AID]; !ok {
+			continue
+		}
+		if _, ok := g.parent[r.BID]; !ok {
+			continue
+		}
+		leg := Leg{RelationshipID: r.ID, From: r.AID, To: r.BID, Type: r.Type, Hours: *r.TravelHours, Distance: r.Distance}
+		g.legs[r.AID] = append(g.legs[r.AID], leg)
+		if !r.OneWay {
+			leg.From, leg.To = r.BID, r.AID
+			g.legs[r.BID] = append(g.legs[r.BID], leg)
+		}
+	}
+	return g, nil
+}
+
+// Shortest is the quickest way from one location to another, as the legs
+// taken in order, and the hours it takes. ok is false when there is no
+// way over relationships with a known travel time.
+func (g *Graph) Shortest(from, to uint) (legs []Leg, hours float64, ok bool) {
+	if from == to {
+		return []Leg{}, 0, true
+	}
+	dist := map[uint]float64{from: 0}
+	via := map[uint]Leg{}
+	done := map[uint]bool{}
+	for {
+		// The graphs of a novel are small enough to scan for the nearest.
+		var at uint
+		found := false
+		for id, d := range dist {
+			if !done[id] && (!found || d < dist[at] || d == dist[at] && id < at) {
+				at, found = id, true
+			}
+		}
+		if !found {
+			return nil, 0, false
+		}
+		if at == to {
+			break
+		}
+		done[at] = true
+		for _, l := range g.legs[at] {
+			d := dist[at] + l.Hours
+			if old, seen := dist[l.To]; !done[l.To] && (!seen || d < old) {
+				dist[l.To] = d
+				via[l.To] = l
+			}
+		}
+	}
+	for id := to; id != from; id = via[id].From {
+		legs = append(legs, via[id])
+	}
+	slices.Reverse(legs)
+	return legs, dist[to], true
+}
+
+// Hours is the least time it takes to get from location a to location b,
+// counting the routes of the locations they lie within. Routes between
+// locations that both lie within the same one are left out, since they
+// say nothing about the way within it. ok is false when no route is known.
+func (g *Graph) Hours(a, b uint) (hours float64, ok bool) {
+	for _, x := range g.lineage(a) {
+		if g.Within(b, x) {
+			break
+		}
+		for _, y := range g.lineage(b) {
+			if g.Within(a, y) {
+				break
+			}
+			if _, h, found := g.Shortest(x, y); found && (!ok || h < hours) {
+				hours, ok = h, true
+			}
+		}
+	}
+	return hours, ok
+}
+
+// lineage is id and the locations it lies within, innermost first.
+func (g *Graph) lineage(id uint) []uint {
+	var out []uint
+	for ; id != 0 && !slices.Contains(out, id); id = g.parent[id] {
+		out = append(out, id)
+	}
+	return out
+}
+
+// Within reports whether location a is b or lies within it.
+func (g *Graph) Within(a, b uint) bool {
+	seen := map[uint]bool{}
+	for id := a; id != 0 && !seen[id]; id = g.parent[id] {
+		if id == b {
+			return true
+		}
+		seen[id] = true
+	}
+	return false
+}
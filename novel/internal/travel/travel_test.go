@@ -0,0 +1,114 @@
+package travel
+
+import (
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/storage"
+	"testing"
+)
+
+// testGraph loads a graph of locations 1..8, where 3 and 4 lie within 2
+// and 6 within 5, and routes 1-2 (2h), 2-5 (3h), 1-5 (10h), 3-4 (1h),
+// 7→8 (1h, one way) and 5-8 without a travel time.
+func testGraph(t *testing.T) *Graph {
+	t.Helper()
+	db, err := storage.Open("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Location{}, &models.LocationRelationship{}); err != nil {
+		t.Fatal(err)
+	}
+	parents := map[uint]uint{3: 2, 4: 2, 6: 5}
+	for id := uint(1); id <= 8; id++ {
+		if err := db.Create(&models.Location{ID: id, ParentID: parents[id]}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	hours := func(h float64) *float64 { return &h }
+	for _, r := range []models.LocationRelationship{
+		{AID: 1, BID: 2, TravelHours: hours(2)},
+		{AID: 2, BID: 5, TravelHours: hours(3)},
+		{AID: 1, BID: 5, TravelHours: hours(10)},
+		{AID: 3, BID: 4, TravelHours: hours(1)},
+		{AID: 7, BID: 8, TravelHours: hours(1), OneWay: true},
+		{AID: 5, BID: 8},
+	} {
+		if err := db.Create(&r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := Load(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestShortest(t *testing.T) {
+	g := testGraph(t)
+	tests := []struct {
+		from, to uint
+		hours    float64
+		legs     int
+		ok       bool
+	}{
+		{1, 1, 0, 0, true},
+		{1, 5, 5, 2, true},
+		{5, 1, 5, 2, true},
+		{7, 8, 1, 1, true},
+		{8, 7, 0, 0, false},
+		{5, 8, 0, 0, false},
+	}
+	for _, tt := range tests {
+		legs, hours, ok := g.Shortest(tt.from, tt.to)
+		if ok != tt.ok || hours != tt.hours || len(legs) != tt.legs {
+			t.Errorf("Shortest(%d, %d) = %d legs, %g, %v; want %d legs, %g, %v", tt.from, tt.to, len(legs), hours, ok, tt.legs, tt.hours, tt.ok)
+		}
+		for i := 1; i < len(legs); i++ {
+			if legs[i-1].To != legs[i].From {
+				t.Errorf("Shortest(%d, %d): leg %d does not start where leg %d ends", tt.from, tt.to, i, i-1)
+			}
+		}
+	}
+}
+
+func TestHours(t *testing.T) {
+	g := testGraph(t)
+	tests := []struct {
+		a, b  uint
+		hours float64
+		ok    bool
+	}{
+		{3, 6, 3, true},
+		{6, 3, 3, true},
+		{3, 4, 1, true},
+		{3, 2, 0, false},
+		{1, 6, 5, true},
+		{6, 7, 0, false},
+	}
+	for _, tt := range tests {
+		if hours, ok := g.Hours(tt.a, tt.b); hours != tt.hours || ok != tt.ok {
+			t.Errorf("Hours(%d, %d) = %g, %v; want %g, %v", tt.a, tt.b, hours, ok, tt.hours, tt.ok)
+		}
+	}
+}
+
+func TestWithin(t *testing.T) {
+	g := testGraph(t)
+	tests := []struct {
+		a, b uint
+		want bool
+	}{
+		{3, 2, true},
+		{2, 2, true},
+		{2, 3, false},
+		{6, 5, true},
+		{6, 2, false},
+		{9, 9, true},
+	}
+	for _, tt := range tests {
+		if got := g.Within(tt.a, tt.b); got != tt.want {
+			t.Errorf("Within(%d, %d) = %v; want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mcp
+
+import (
+	"context"
+	"mcpnovel/internal/storage"
+	"mcpnovel/tool"
+
+	"gorm.io/gorm"
+)
+
+type noArgs struct{}
+
+const dbToolName = "dbHelper"
+
+type dbInitArgs struct {
+	Path string `json:"path" desc:"数据库文件路径，为空时对当前数据库重新迁移"`
+}
+
+// dbTool manages the database file itself, so it lives with the server
+// rather than with the services that use the database. Its calls run with
+// no other request in flight (see hold).
+func (s *Server) dbTool() tool.Tool {
+	return tool.NewActions(dbToolName, "数据库管理",
+		tool.Handle("init", "打开并迁移数据库", func(_ context.Context, a dbInitArgs) (any, error) {
+			if a.Path != "" {
+				ndb, err := storage.Open(a.Path)
+				if err != nil {
+					return nil, err
+				}
+				if err := autoMigrate(ndb); err != nil {
+					closeDB(ndb)
+					return nil, err
+				}
+				// Tools hold the services, detector and generator, so
+				// switch their handle in place instead of replacing them.
+				old := s.DB
+				s.DB = ndb
+				s.DBPath = a.Path
+				s.Services.DB = ndb
+				s.Detector.DB = ndb
+				s.Generator.DB = ndb
+				closeDB(old)
+			} else if err := autoMigrate(s.DB); err != nil {
+				return nil, err
+			}
+			return map[string]any{"ok": true, "path": s.DBPath}, nil
+		}).Idempotent(),
+		tool.Handle("export", "返回当前数据库路径", func(context.Context, noArgs) (any, error) {
+			return map[string]any{"path": s.DBPath}, nil
+		}).ReadOnly(),
+	)
+}
+
+// closeDB closes the connections behind a handle no longer in use.
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
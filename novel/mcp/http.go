@@ -0,0 +1,390 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	sessionHeader     = "Mcp-Session-Id"
+	maxRequestBody    = 16 << 20
+	sseKeepAlive      = 25 * time.Second
+	sessionBufferSize = 64
+	// Sessions without a request, a running request or an open stream for
+	// sessionIdleTimeout are dropped by a sweep every sessionSweepInterval.
+	sessionIdleTimeout   = 30 * time.Minute
+	sessionSweepInterval = time.Minute
+	shutdownTimeout      = 10 * time.Second
+)
+
+type httpSession struct {
+	id       string
+	events   chan []byte
+	done     chan struct{}
+	inflight *inflight
+	// lastSeen and streams are guarded by httpTransport.mu.
+	lastSeen time.Time
+	streams  int
+}
+
+// close ends the session's streams and cancels its in-flight requests.
+func (sess *httpSession) close() {
+	close(sess.done)
+	sess.inflight.cancelAll()
+}
+
+// send queues a server-initiated message for the session's SSE stream,
+// dropping it when no client is draining the stream.
+func (sess *httpSession) send(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	select {
+	case <-sess.done:
+	case sess.events <- b:
+	default:
+	}
+}
+
+type httpTransport struct {
+	srv      *Server
+	mu       sync.Mutex
+	sessions map[string]*httpSession
+}
+
+// RunHTTP serves the HTTP transport on addr until SIGINT or SIGTERM, then
+// closes every session and waits up to shutdownTimeout for requests to end.
+func RunHTTP(addr string) {
+	s, err := newServer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: addr, Handler: s.HTTPHandler(ctx)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdown); err != nil {
+			log.Print(err)
+		}
+	}()
+	log.Printf("mcp-novel listening on http://%s/mcp", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+}
+
+// HTTPHandler serves the MCP Streamable HTTP transport on /mcp. When ctx
+// is done the idle-session sweep stops and every session is closed, ending
+// its streams and cancelling its requests.
+func (s *Server) HTTPHandler(ctx context.Context) http.Handler {
+	t := &httpTransport{srv: s, sessions: map[string]*httpSession{}}
+	go t.sweep(ctx, sessionSweepInterval, sessionIdleTimeout)
+	mux := http.NewServeMux()
+	mux.Handle("/mcp", t)
+	return mux
+}
+
+func (t *httpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedOrigin(r) {
+		http.Error(w, "forbidden origin", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		t.post(w, r)
+	case http.MethodGet:
+		t.stream(w, r)
+	case http.MethodDelete:
+		t.mu.Lock()
+		sess, ok := t.sessions[r.Header.Get(sessionHeader)]
+		delete(t.sessions, r.Header.Get(sessionHeader))
+		t.mu.Unlock()
+		if !ok {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+		sess.close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (t *httpTransport) post(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	batch := len(body) > 0 && body[0] == '['
+	var reqs []jsonrpcRequest
+	if batch {
+		err = json.Unmarshal(body, &reqs)
+	} else {
+		var req jsonrpcRequest
+		err = json.Unmarshal(body, &req)
+		reqs = append(reqs, req)
+	}
+	if err != nil {
+		writeHTTPJSON(w, http.StatusBadRequest, jsonrpcResponse{JSONRPC: "2.0", Error: &jsonrpcError{Code: -32700, Message: "Parse error"}})
+		return
+	}
+
+	var sess *httpSession
+	for _, req := range reqs {
+		if req.Method != "initialize" {
+			continue
+		}
+		if len(reqs) != 1 {
+			writeHTTPJSON(w, http.StatusBadRequest, jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &jsonrpcError{Code: -32600, Message: "initialize must not be batched"}})
+			return
+		}
+		sess = t.newSession()
+		w.Header().Set(sessionHeader, sess.id)
+	}
+	if sess == nil {
+		var status int
+		sess, status = t.session(r)
+		if sess == nil {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+	}
+
+	// Requests answered over an SSE response get their progress
+	// notifications on that stream; otherwise they go to the GET stream.
+	c := &conn{inflight: sess.inflight, notify: sess.send}
+	var sse *sseWriter
+	if hasRequests(reqs) && acceptsEventStream(r) {
+		sse = newSSEWriter(w)
+		if sse != nil {
+			c.notify = sse.write
+		}
+	}
+	var resps []*jsonrpcResponse
+	for _, req := range reqs {
+		// Responses to server-initiated requests carry no method.
+		if req.Method == "" {
+			continue
+		}
+		if resp := t.srv.handle(r.Context(), c, req); resp != nil {
+			resps = append(resps, resp)
+		}
+	}
+	if sse != nil {
+		for _, resp := range resps {
+			sse.write(resp)
+		}
+		return
+	}
+	switch {
+	case len(resps) == 0:
+		w.WriteHeader(http.StatusAccepted)
+	case batch:
+		writeHTTPJSON(w, http.StatusOK, resps)
+	default:
+		writeHTTPJSON(w, http.StatusOK, resps[0])
+	}
+}
+
+func hasRequests(reqs []jsonrpcRequest) bool {
+	for _, req := range reqs {
+		if req.Method != "" && req.ID != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+type sseWriter struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEWriter starts an SSE response, or returns nil when w cannot stream.
+func newSSEWriter(w http.ResponseWriter) *sseWriter {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseWriter{w: w, flusher: flusher}
+}
+
+func (sw *sseWriter) write(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	fmt.Fprintf(sw.w, "event: message\ndata: %s\n\n", b)
+	sw.flusher.Flush()
+}
+
+func (t *httpTransport) stream(w http.ResponseWriter, r *http.Request) {
+	sess, status := t.session(r)
+	if sess == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set(sessionHeader, sess.id)
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	t.mu.Lock()
+	sess.streams++
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		sess.streams--
+		sess.lastSeen = time.Now()
+		t.mu.Unlock()
+	}()
+	tick := time.NewTicker(sseKeepAlive)
+	defer tick.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-tick.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-sess.done:
+			return
+		case b := <-sess.events:
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", b)
+			flusher.Flush()
+		}
+	}
+}
+
+func (t *httpTransport) newSession() *httpSession {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	sess := &httpSession{id: hex.EncodeToString(buf), events: make(chan []byte, sessionBufferSize), done: make(chan struct{}), inflight: newInflight(), lastSeen: time.Now()}
+	t.mu.Lock()
+	t.sessions[sess.id] = sess
+	t.mu.Unlock()
+	return sess
+}
+
+// session looks up the request's session and marks it as seen, returning
+// the HTTP status to answer with when it is missing (400) or
+// unknown/expired (404).
+func (t *httpTransport) session(r *http.Request) (*httpSession, int) {
+	id := r.Header.Get(sessionHeader)
+	if id == "" {
+		return nil, http.StatusBadRequest
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sess, ok := t.sessions[id]
+	if !ok {
+		return nil, http.StatusNotFound
+	}
+	sess.lastSeen = time.Now()
+	return sess, 0
+}
+
+// sweep drops, every interval, the sessions idle for longer than idle,
+// and all of them once ctx is done.
+func (t *httpTransport) sweep(ctx context.Context, interval, idle time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		var now time.Time
+		select {
+		case <-ctx.Done():
+			t.closeAll()
+			return
+		case now = <-tick.C:
+		}
+		var expired []*httpSession
+		t.mu.Lock()
+		for id, sess := range t.sessions {
+			if sess.streams == 0 && now.Sub(sess.lastSeen) > idle && !sess.inflight.busy() {
+				delete(t.sessions, id)
+				expired = append(expired, sess)
+			}
+		}
+		t.mu.Unlock()
+		for _, sess := range expired {
+			sess.close()
+		}
+	}
+}
+
+// closeAll drops and closes every session.
+func (t *httpTransport) closeAll() {
+	t.mu.Lock()
+	sessions := t.sessions
+	t.sessions = map[string]*httpSession{}
+	t.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+}
+
+// allowedOrigin rejects browser requests from non-local origins to guard
+// against DNS rebinding; requests without an Origin header are allowed.
+func allowedOrigin(r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	if o == "" {
+		return true
+	}
+	u, err := url.Parse(o)
+	if err != nil {
+		return false
+	}
+	host := u.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeHTTPJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
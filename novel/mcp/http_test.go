@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServer opens a server on an in-memory database.
+func testServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := NewServer("file:" + t.Name() + "?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// post sends one JSON-RPC message to /mcp under session (none when empty).
+func post(t *testing.T, url, session, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url+"/mcp", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session != "" {
+		req.Header.Set(sessionHeader, session)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestHTTPSession(t *testing.T) {
+	ts := httptest.NewServer(testServer(t).HTTPHandler(context.Background()))
+	defer ts.Close()
+	const ping = `{"jsonrpc":"2.0","id":2,"method":"ping"}`
+
+	resp := post(t, ts.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`)
+	id := resp.Header.Get(sessionHeader)
+	if resp.StatusCode != http.StatusOK || id == "" {
+		t.Fatalf("initialize = %d with session %q", resp.StatusCode, id)
+	}
+	steps := []struct {
+		name    string
+		method  string
+		session string
+		body    string
+		want    int
+	}{
+		{"request", http.MethodPost, id, ping, http.StatusOK},
+		{"notification", http.MethodPost, id, `{"jsonrpc":"2.0","method":"notifications/initialized"}`, http.StatusAccepted},
+		{"no session", http.MethodPost, "", ping, http.StatusBadRequest},
+		{"unknown session", http.MethodPost, "nope", ping, http.StatusNotFound},
+		{"batched initialize", http.MethodPost, "", `[{"jsonrpc":"2.0","id":1,"method":"initialize"},` + ping + `]`, http.StatusBadRequest},
+		{"end", http.MethodDelete, id, "", http.StatusNoContent},
+		{"request after end", http.MethodPost, id, ping, http.StatusNotFound},
+		{"end again", http.MethodDelete, id, "", http.StatusNotFound},
+		{"put", http.MethodPut, id, "", http.StatusMethodNotAllowed},
+	}
+	for _, st := range steps {
+		req, err := http.NewRequest(st.method, ts.URL+"/mcp", strings.NewReader(st.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.session != "" {
+			req.Header.Set(sessionHeader, st.session)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != st.want {
+			t.Errorf("%s = %d; want %d", st.name, resp.StatusCode, st.want)
+		}
+	}
+}
+
+func TestHTTPForeignOrigin(t *testing.T) {
+	ts := httptest.NewServer(testServer(t).HTTPHandler(context.Background()))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"initialize"}`))
+	req.Header.Set("Origin", "http://example.com")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("foreign origin = %d; want 403", resp.StatusCode)
+	}
+}
+
+func TestHTTPShutdownEndsSessions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ts := httptest.NewServer(testServer(t).HTTPHandler(ctx))
+	defer ts.Close()
+	id := post(t, ts.URL, "", `{"jsonrpc":"2.0","id":1,"method":"initialize"}`).Header.Get(sessionHeader)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/mcp", nil)
+	req.Header.Set(sessionHeader, id)
+	req.Header.Set("Accept", "text/event-stream")
+	stream, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	ended := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, stream.Body)
+		close(ended)
+	}()
+
+	cancel()
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open after shutdown")
+	}
+	if resp := post(t, ts.URL, id, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("request after shutdown = %d; want 404", resp.StatusCode)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	tr := &httpTransport{sessions: map[string]*httpSession{}}
+	idle, streaming, fresh := tr.newSession(), tr.newSession(), tr.newSession()
+	idle.lastSeen = time.Now().Add(-time.Hour)
+	streaming.lastSeen = idle.lastSeen
+	streaming.streams = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		tr.sweep(ctx, time.Millisecond, time.Minute)
+		close(stopped)
+	}()
+	select {
+	case <-idle.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle session not swept")
+	}
+	tr.mu.Lock()
+	_, kept := tr.sessions[streaming.id]
+	_, keptFresh := tr.sessions[fresh.id]
+	tr.mu.Unlock()
+	if !kept || !keptFresh {
+		t.Errorf("swept a session with a stream (%v) or a recent request (%v)", !kept, !keptFresh)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sweep still running after its context ended")
+	}
+	for _, sess := range []*httpSession{streaming, fresh} {
+		select {
+		case <-sess.done:
+		default:
+			t.Errorf("session %s still open after the sweep stopped", sess.id)
+		}
+	}
+}
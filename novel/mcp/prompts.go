@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"mcpnovel/internal/models"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const previousEndingRunes = 800
+
+type prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Arguments   []promptArgument `json:"arguments"`
+}
+
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+}
+
+type promptMessage struct {
+	Role    string       `json:"role"`
+	Content contentBlock `json:"content"`
+}
+
+var chapterIDArgument = promptArgument{Name: "chapterID", Description: "章节 ID", Required: true}
+
+func prompts() []prompt {
+	return []prompt{
+		{Name: "draftChapter", Description: "根据章节事件、出场人物与文风参考起草章节正文", Arguments: []promptArgument{chapterIDArgument}},
+		{Name: "continueChapter", Description: "在章节已有正文之后继续写作", Arguments: []promptArgument{chapterIDArgument}},
+		{Name: "reviseForStyle", Description: "按文风参考修订章节正文", Arguments: []promptArgument{chapterIDArgument}},
+	}
+}
+
+func (s *Server) getPrompt(name string, args map[string]string) (map[string]any, error) {
+	var known bool
+	for _, p := range prompts() {
+		if p.Name == name {
+			known = true
+		}
+	}
+	if !known {
+		return nil, &invalidParamsError{msg: fmt.Sprintf("unknown prompt: %s", name)}
+	}
+	id, err := strconv.ParseUint(args["chapterID"], 10, 64)
+	if err != nil || id == 0 {
+		return nil, &invalidParamsError{msg: "chapterID: must be a positive integer"}
+	}
+	var ch models.Chapter
+	if err := s.DB.First(&ch, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &invalidParamsError{msg: fmt.Sprintf("chapterID: chapter %d not found", id)}
+		}
+		return nil, err
+	}
+	var vol models.Volume
+	if err := s.DB.First(&vol, ch.VolumeID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var msgs []promptMessage
+	add := func(text string) {
+		msgs = append(msgs, promptMessage{Role: "user", Content: contentBlock{Type: "text", Text: text}})
+	}
+	sr, err := s.Services.GetStyleRef(vol.NovelID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if sr != nil && sr.Content != "" {
+		add("【文风参考】\n" + sr.Content)
+	}
+	o, err := s.Generator.ChapterOutline(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	add(fmt.Sprintf("【%s · 第%d章 %s】\n%s", vol.Title, ch.Index, ch.Title, o))
+	chars, err := s.Services.ChapterCharacters(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(chars) > 0 {
+		var b strings.Builder
+		b.WriteString("【出场人物】\n")
+		for _, c := range chars {
+			b.WriteString(c.Name)
+			if c.Bio != "" {
+				b.WriteString("：")
+				b.WriteString(c.Bio)
+			}
+			b.WriteString("\n")
+		}
+		add(b.String())
+	}
+	prev, err := s.Services.PreviousChapter(ch.ID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case prev == nil:
+		add("【上一章】\n本章是全书第一章，没有上一章，请从故事开端写起。")
+	case prev.Content == "":
+		add(fmt.Sprintf("【上一章】\n上一章《%s》尚无正文。", prev.Title))
+	default:
+		add(fmt.Sprintf("【上一章《%s》结尾】\n%s", prev.Title, tailRunes(prev.Content, previousEndingRunes)))
+	}
+
+	var desc string
+	switch name {
+	case "draftChapter":
+		desc = "起草章节"
+		add("请依据以上细纲与人物设定，承接上一章结尾，按文风参考写出本章完整正文。")
+	case "continueChapter":
+		desc = "续写章节"
+		if ch.Content != "" {
+			add("【本章已有正文】\n" + ch.Content)
+		}
+		add("请紧接本章已有正文继续写作，保持人物、情节与文风一致，只输出新增部分。")
+	case "reviseForStyle":
+		desc = "按文风修订章节"
+		add("【待修订正文】\n" + ch.Content)
+		add("请在不改变情节与事件顺序的前提下，按文风参考修订待修订正文，输出修订后的全文。")
+	}
+	return map[string]any{"description": fmt.Sprintf("%s：%s", desc, ch.Title), "messages": msgs}, nil
+}
+
+func tailRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[len(r)-n:])
+}
@@ -0,0 +1,44 @@
+package mcp
+
+import (
+	"mcpnovel/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestPromptPreviousChapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		chapter string
+		want    string
+	}{
+		{"first chapter", "1", "本章是全书第一章，没有上一章"},
+		{"previous without text", "2", "上一章《一》尚无正文"},
+		{"previous ending", "3", "【上一章《二》结尾】\n雪夜上梁山"},
+	}
+	s := testServer(t)
+	for _, r := range []any{
+		&models.Novel{ID: 1, Title: "N"}, &models.Volume{ID: 1, NovelID: 1},
+		&models.Chapter{ID: 1, VolumeID: 1, Title: "一"}, &models.Chapter{ID: 2, VolumeID: 1, Title: "二", Content: "雪夜上梁山"},
+		&models.Chapter{ID: 3, VolumeID: 1, Title: "三"},
+	} {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := s.getPrompt("draftChapter", map[string]string{"chapterID": tt.chapter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var texts []string
+			for _, m := range p["messages"].([]promptMessage) {
+				texts = append(texts, m.Content.Text)
+			}
+			if all := strings.Join(texts, "\n"); !strings.Contains(all, tt.want) {
+				t.Errorf("prompt = %q; want it to contain %q", all, tt.want)
+			}
+		})
+	}
+}
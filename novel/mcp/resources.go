@@ -0,0 +1,250 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mcpnovel/internal/models"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const resourcePageSize = 100
+
+type resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type resourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type resourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type resourceNotFoundError struct {
+	uri string
+}
+
+func (e *resourceNotFoundError) Error() string {
+	return fmt.Sprintf("resource not found: %s", e.uri)
+}
+
+type invalidParamsError struct {
+	msg string
+}
+
+func (e *invalidParamsError) Error() string {
+	return e.msg
+}
+
+// resourceKinds fixes the order resources/list walks through; the cursor
+// records a position in this order plus the last ID returned.
+var resourceKinds = []string{"novel", "chapter", "world", "character", "style"}
+
+func resourceTemplates() []resourceTemplate {
+	return []resourceTemplate{
+		{URITemplate: "novel://{novelID}", Name: "novel", Description: "小说概要与分卷列表", MimeType: "application/json"},
+		{URITemplate: "novel://{novelID}/chapter/{chapterID}", Name: "chapter", Description: "章节正文", MimeType: "text/plain"},
+		{URITemplate: "world://{worldID}", Name: "world", Description: "世界设定：时期、时间段与地点", MimeType: "application/json"},
+		{URITemplate: "character://{characterID}", Name: "character", Description: "人物卡：关系、能力、物品与记忆", MimeType: "application/json"},
+		{URITemplate: "style://{novelID}", Name: "style", Description: "小说文风参考正文", MimeType: "text/plain"},
+	}
+}
+
+type resourceCursor struct {
+	Kind  int  `json:"k"`
+	After uint `json:"a"`
+}
+
+func encodeCursor(c resourceCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (resourceCursor, error) {
+	var c resourceCursor
+	if s == "" {
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, &invalidParamsError{msg: "invalid cursor"}
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.Kind < 0 || c.Kind >= len(resourceKinds) {
+		return c, &invalidParamsError{msg: "invalid cursor"}
+	}
+	return c, nil
+}
+
+func (s *Server) listResources(cursor string) (map[string]any, error) {
+	cur, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	out := []resource{}
+	for cur.Kind < len(resourceKinds) {
+		page, last, err := s.resourcePage(resourceKinds[cur.Kind], cur.After, resourcePageSize-len(out))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, page...)
+		if len(out) >= resourcePageSize {
+			return map[string]any{"resources": out, "nextCursor": encodeCursor(resourceCursor{Kind: cur.Kind, After: last})}, nil
+		}
+		cur = resourceCursor{Kind: cur.Kind + 1}
+	}
+	return map[string]any{"resources": out}, nil
+}
+
+// resourcePage returns up to limit resources of one kind with IDs above after,
+// together with the last ID it returned.
+func (s *Server) resourcePage(kind string, after uint, limit int) ([]resource, uint, error) {
+	var out []resource
+	last := after
+	switch kind {
+	case "novel":
+		var a []models.Novel
+		if err := s.DB.Where("id > ?", after).Order("id asc").Limit(limit).Find(&a).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, n := range a {
+			out = append(out, resource{URI: fmt.Sprintf("novel://%d", n.ID), Name: n.Title, Description: n.Description, MimeType: "application/json"})
+			last = n.ID
+		}
+	case "chapter":
+		var a []struct {
+			ID      uint
+			Title   string
+			NovelID uint
+		}
+		err := s.DB.Table("chapters").
+			Select("chapters.id, chapters.title, volumes.novel_id").
+			Joins("JOIN volumes ON volumes.id = chapters.volume_id").
+			Where("chapters.id > ? AND chapters.deleted_at IS NULL AND volumes.deleted_at IS NULL", after).Order("chapters.id asc").Limit(limit).Scan(&a).Error
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, c := range a {
+			out = append(out, resource{URI: fmt.Sprintf("novel://%d/chapter/%d", c.NovelID, c.ID), Name: c.Title, MimeType: "text/plain"})
+			last = c.ID
+		}
+	case "world":
+		var a []models.World
+		if err := s.DB.Where("id > ?", after).Order("id asc").Limit(limit).Find(&a).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, w := range a {
+			out = append(out, resource{URI: fmt.Sprintf("world://%d", w.ID), Name: w.Name, Description: w.Description, MimeType: "application/json"})
+			last = w.ID
+		}
+	case "character":
+		var a []models.Character
+		if err := s.DB.Where("id > ?", after).Order("id asc").Limit(limit).Find(&a).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, c := range a {
+			out = append(out, resource{URI: fmt.Sprintf("character://%d", c.ID), Name: c.Name, Description: c.Bio, MimeType: "application/json"})
+			last = c.ID
+		}
+	case "style":
+		var a []models.StyleRef
+		if err := s.DB.Where("id > ?", after).Order("id asc").Limit(limit).Find(&a).Error; err != nil {
+			return nil, 0, err
+		}
+		for _, sr := range a {
+			out = append(out, resource{URI: fmt.Sprintf("style://%d", sr.NovelID), Name: fmt.Sprintf("文风参考 %d", sr.NovelID), MimeType: "text/plain"})
+			last = sr.ID
+		}
+	}
+	return out, last, nil
+}
+
+type novelResource struct {
+	Novel   models.Novel
+	Volumes []models.Volume
+}
+
+func (s *Server) readResource(uri string) (map[string]any, error) {
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return nil, &invalidParamsError{msg: fmt.Sprintf("invalid resource uri: %s", uri)}
+	}
+	parts := strings.Split(rest, "/")
+	ids := make([]uint, 0, 2)
+	for i, p := range parts {
+		if i == 1 {
+			if p != "chapter" {
+				return nil, &resourceNotFoundError{uri: uri}
+			}
+			continue
+		}
+		id, err := strconv.ParseUint(p, 10, 64)
+		if err != nil {
+			return nil, &resourceNotFoundError{uri: uri}
+		}
+		ids = append(ids, uint(id))
+	}
+	var (
+		v        any
+		mimeType = "application/json"
+		err      error
+	)
+	switch {
+	case scheme == "novel" && len(parts) == 1:
+		v, err = s.Services.GetByID("novel", ids[0])
+		if err == nil {
+			var vols []models.Volume
+			err = s.DB.Where("novel_id = ?", ids[0]).Order("`index` asc, id asc").Find(&vols).Error
+			v = novelResource{Novel: v.(models.Novel), Volumes: vols}
+		}
+	case scheme == "novel" && len(parts) == 3:
+		v, err = s.Services.GetByID("chapter", ids[1])
+		if err == nil {
+			ch := v.(models.Chapter)
+			var vol models.Volume
+			if e := s.DB.First(&vol, ch.VolumeID).Error; e != nil || vol.NovelID != ids[0] {
+				return nil, &resourceNotFoundError{uri: uri}
+			}
+			mimeType = "text/plain"
+			v = ch.Title + "\n\n" + ch.Content
+		}
+	case scheme == "world" && len(parts) == 1:
+		v, err = s.Services.GetWorldBible(ids[0])
+	case scheme == "character" && len(parts) == 1:
+		v, err = s.Services.GetCharacterSheet(ids[0])
+	case scheme == "style" && len(parts) == 1:
+		var sr *models.StyleRef
+		sr, err = s.Services.GetStyleRef(ids[0])
+		if err == nil {
+			mimeType = "text/plain"
+			v = sr.Content
+		}
+	default:
+		return nil, &resourceNotFoundError{uri: uri}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, &resourceNotFoundError{uri: uri}
+	}
+	if err != nil {
+		return nil, err
+	}
+	text, ok := v.(string)
+	if !ok {
+		b, _ := json.MarshalIndent(v, "", "  ")
+		text = string(b)
+	}
+	return map[string]any{"contents": []resourceContents{{URI: uri, MimeType: mimeType, Text: text}}}, nil
+}
@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"fmt"
+	"mcpnovel/internal/models"
+	"strings"
+	"testing"
+)
+
+// resourceServer seeds novels 1 and 2, a chapter of novel 1, a world, a
+// style reference for novel 1 and n characters.
+func resourceServer(t *testing.T, n int) *Server {
+	t.Helper()
+	s := testServer(t)
+	rows := []any{
+		&models.Novel{ID: 1, Title: "N1"}, &models.Novel{ID: 2, Title: "N2"},
+		&models.Volume{ID: 1, NovelID: 1, Title: "卷一"},
+		&models.Chapter{ID: 1, VolumeID: 1, Title: "一", Content: "雪夜上梁山"},
+		&models.World{ID: 1, Name: "W"},
+		&models.StyleRef{NovelID: 1, Content: "简洁"},
+	}
+	for i := 1; i <= n; i++ {
+		rows = append(rows, &models.Character{ID: uint(i), Name: fmt.Sprintf("c%d", i)})
+	}
+	for _, r := range rows {
+		if err := s.DB.Create(r).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestListResourcesPages(t *testing.T) {
+	const characters = 2 * resourcePageSize
+	s := resourceServer(t, characters)
+	var uris []string
+	cursor, pages := "", 0
+	for {
+		res, err := s.listResources(cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, r := range res["resources"].([]resource) {
+			uris = append(uris, r.URI)
+		}
+		next, ok := res["nextCursor"].(string)
+		if !ok {
+			break
+		}
+		cursor = next
+	}
+	if want := 2 + 1 + 1 + characters + 1; len(uris) != want || pages != 3 {
+		t.Fatalf("listed %d resources on %d pages; want %d on 3", len(uris), pages, want)
+	}
+	seen := map[string]bool{}
+	for _, u := range uris {
+		if seen[u] {
+			t.Errorf("%s listed twice", u)
+		}
+		seen[u] = true
+	}
+	for _, u := range []string{"novel://2", "novel://1/chapter/1", "world://1", "character://1", fmt.Sprintf("character://%d", characters), "style://1"} {
+		if !seen[u] {
+			t.Errorf("%s not listed", u)
+		}
+	}
+	if uris[0] != "novel://1" || uris[len(uris)-1] != "style://1" {
+		t.Errorf("listing runs %s … %s; want novels first and style references last", uris[0], uris[len(uris)-1])
+	}
+}
+
+func TestResourceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		params string
+		code   int
+	}{
+		{"cursor not base64", "resources/list", `{"cursor":"!!"}`, -32602},
+		{"cursor kind out of range", "resources/list", fmt.Sprintf(`{"cursor":%q}`, encodeCursor(resourceCursor{Kind: len(resourceKinds)})), -32602},
+		{"uri without scheme", "resources/read", `{"uri":"novel-1"}`, -32602},
+		{"missing novel", "resources/read", `{"uri":"novel://9"}`, -32002},
+		{"chapter of another novel", "resources/read", `{"uri":"novel://2/chapter/1"}`, -32002},
+		{"unknown path", "resources/read", `{"uri":"novel://1/volume/1"}`, -32002},
+		{"unknown scheme", "resources/read", `{"uri":"item://1"}`, -32002},
+		{"missing style", "resources/read", `{"uri":"style://2"}`, -32002},
+	}
+	s := resourceServer(t, 1)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if resp := request(t, s, tt.method, tt.params); resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("error = %+v; want code %d", resp.Error, tt.code)
+			}
+		})
+	}
+}
+
+func TestReadResource(t *testing.T) {
+	tests := []struct {
+		uri      string
+		mimeType string
+		want     string
+	}{
+		{"novel://1", "application/json", "卷一"},
+		{"novel://1/chapter/1", "text/plain", "一\n\n雪夜上梁山"},
+		{"world://1", "application/json", `"W"`},
+		{"character://1", "application/json", `"c1"`},
+		{"style://1", "text/plain", "简洁"},
+	}
+	s := resourceServer(t, 1)
+	for _, tt := range tests {
+		t.Run(tt.uri, func(t *testing.T) {
+			res, err := s.readResource(tt.uri)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := res["contents"].([]resourceContents)[0]
+			if c.URI != tt.uri || c.MimeType != tt.mimeType || !strings.Contains(c.Text, tt.want) {
+				t.Errorf("contents = %+v; want %s containing %q", c, tt.mimeType, tt.want)
+			}
+		})
+	}
+	resp := request(t, s, "resources/templates/list", `{}`)
+	if ts := resp.Result.(map[string]any)["resourceTemplates"].([]resourceTemplate); len(ts) != len(resourceKinds) {
+		t.Errorf("%d templates; want one per kind (%d)", len(ts), len(resourceKinds))
+	}
+}
@@ -0,0 +1,158 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"mcpnovel/internal/progress"
+	"mcpnovel/tool"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stepArgs struct {
+	Steps int `json:"steps"`
+}
+
+// slowTool blocks "wait" calls until they are cancelled, closing started,
+// if set, once the first one runs; "count" calls report one progress
+// notification per step.
+func slowTool(started chan struct{}) tool.Tool {
+	var once sync.Once
+	return tool.NewActions("slowHelper", "",
+		tool.Handle("wait", "", func(ctx context.Context, _ stepArgs) (any, error) {
+			if started != nil {
+				once.Do(func() { close(started) })
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}),
+		tool.Handle("count", "", func(ctx context.Context, a stepArgs) (any, error) {
+			for i := 1; i <= a.Steps; i++ {
+				progress.Report(ctx, float64(i), float64(a.Steps), "")
+			}
+			return a.Steps, nil
+		}),
+	)
+}
+
+func TestServeConcurrently(t *testing.T) {
+	s := testServer(t)
+	started := make(chan struct{})
+	if err := s.Register(slowTool(started)); err != nil {
+		t.Fatal(err)
+	}
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	served := make(chan struct{})
+	go func() {
+		s.Serve(inR, outW)
+		outW.Close()
+		close(served)
+	}()
+	out := bufio.NewScanner(outR)
+	send := func(msg string) {
+		if _, err := io.WriteString(inW, msg+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"slowHelper","arguments":{"action":"wait"}}}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	if !out.Scan() {
+		t.Fatal("no response to ping")
+	}
+	var resp jsonrpcResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil || resp.ID != float64(2) {
+		t.Fatalf("first response = %s; want the ping answered while the call blocks", out.Bytes())
+	}
+	<-started
+	send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":1}}`)
+	inW.Close()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the call was cancelled")
+	}
+	if out.Scan() {
+		t.Errorf("cancelled call answered with %s", out.Bytes())
+	}
+}
+
+func TestProgressNotifications(t *testing.T) {
+	tests := []struct {
+		name  string
+		meta  string
+		count int
+	}{
+		{"with token", `,"_meta":{"progressToken":"p"}`, 3},
+		{"without token", ``, 0},
+	}
+	s := testServer(t)
+	if err := s.Register(slowTool(nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []jsonrpcNotification
+			c := &conn{inflight: newInflight(), notify: func(msg any) { got = append(got, msg.(jsonrpcNotification)) }}
+			params := `{"name":"slowHelper","arguments":{"action":"count","steps":3}` + tt.meta + `}`
+			resp := s.handle(context.Background(), c, jsonrpcRequest{JSONRPC: "2.0", ID: 1, Method: "tools/call", Params: json.RawMessage(params)})
+			if resp == nil || resp.Error != nil {
+				t.Fatalf("response = %+v", resp)
+			}
+			if len(got) != tt.count {
+				t.Fatalf("%d notifications; want %d", len(got), tt.count)
+			}
+			for i, n := range got {
+				p := n.Params.(map[string]any)
+				if n.Method != "notifications/progress" || p["progressToken"] != "p" || p["progress"] != float64(i+1) || p["total"] != float64(3) {
+					t.Errorf("notification %d = %+v", i, n)
+				}
+			}
+		})
+	}
+}
+
+func TestSwapLock(t *testing.T) {
+	s := testServer(t)
+	ping := jsonrpcRequest{Method: "ping"}
+	swap := jsonrpcRequest{Method: "tools/call", Params: json.RawMessage(`{"name":"` + dbToolName + `"}`)}
+	// acquired reports when hold(req) gets the lock, releasing it at once.
+	acquired := func(req jsonrpcRequest) <-chan struct{} {
+		ch := make(chan struct{})
+		go func() {
+			s.hold(req)()
+			close(ch)
+		}()
+		return ch
+	}
+	const wait = 50 * time.Millisecond
+
+	unlock := s.hold(ping)
+	select {
+	case <-acquired(ping):
+	case <-time.After(5 * time.Second):
+		t.Fatal("a request waited for another request")
+	}
+	blocked := acquired(swap)
+	select {
+	case <-blocked:
+		t.Fatal("dbHelper ran alongside a request")
+	case <-time.After(wait):
+	}
+	unlock()
+	<-blocked
+
+	unlock = s.hold(swap)
+	blocked = acquired(ping)
+	select {
+	case <-blocked:
+		t.Fatal("a request ran alongside dbHelper")
+	case <-time.After(wait):
+	}
+	unlock()
+	<-blocked
+}
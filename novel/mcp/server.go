@@ -0,0 +1,523 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mcpnovel/internal/conflict"
+	"mcpnovel/internal/helpers"
+	"mcpnovel/internal/models"
+	"mcpnovel/internal/outline"
+	"mcpnovel/internal/progress"
+	"mcpnovel/internal/storage"
+	"mcpnovel/tool"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+type Server struct {
+	DB        *gorm.DB
+	Services  *helpers.Services
+	Detector  *conflict.Detector
+	Generator *outline.Generator
+	DBPath    string
+	Tools     *tool.Registry
+
+	// swap is held shared by every request and exclusively by dbHelper,
+	// which may replace the handles above.
+	swap sync.RWMutex
+}
+
+type jsonrpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      any             `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type jsonrpcResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      any           `json:"id"`
+	Result  any           `json:"result,omitempty"`
+	Error   *jsonrpcError `json:"error,omitempty"`
+}
+
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+type contentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type toolResult struct {
+	Content           []contentBlock `json:"content"`
+	IsError           bool           `json:"isError"`
+	StructuredContent any            `json:"structuredContent,omitempty"`
+}
+
+type unknownToolError struct {
+	name string
+}
+
+func (e *unknownToolError) Error() string {
+	return fmt.Sprintf("unknown tool: %s", e.name)
+}
+
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+type toolInfo struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	InputSchema map[string]any   `json:"inputSchema"`
+	Annotations tool.Annotations `json:"annotations"`
+}
+
+func Run() {
+	s, err := newServer()
+	if err != nil {
+		os.Exit(1)
+	}
+	s.Serve(os.Stdin, os.Stdout)
+}
+
+func newServer() (*Server, error) {
+	p := os.Getenv("MCP_NOVEL_DB")
+	if p == "" {
+		wd, _ := os.Getwd()
+		p = wd + "/novel.db"
+	}
+	return NewServer(p)
+}
+
+// NewServer opens and migrates the database at path and registers the
+// built-in tools. Embedders can add their own with Register before serving.
+func NewServer(path string) (*Server, error) {
+	db, err := storage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := autoMigrate(db); err != nil {
+		return nil, err
+	}
+	s := &Server{DB: db, DBPath: path, Tools: tool.NewRegistry()}
+	s.Services = &helpers.Services{DB: db}
+	s.Detector = &conflict.Detector{DB: db}
+	s.Generator = &outline.Generator{DB: db}
+	if err := s.Register(s.dbTool()); err != nil {
+		return nil, err
+	}
+	if err := s.Register(helpers.Tools(s.Services)...); err != nil {
+		return nil, err
+	}
+	if err := s.Register(conflict.Tools(s.Detector)...); err != nil {
+		return nil, err
+	}
+	if err := s.Register(outline.Tools(s.Generator)...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// conn is one client connection: a stdio stream or an HTTP session.
+type conn struct {
+	inflight *inflight
+	notify   func(msg any)
+}
+
+type inflight struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+func newInflight() *inflight {
+	return &inflight{cancels: map[string]context.CancelFunc{}}
+}
+
+func requestKey(id any) string {
+	b, _ := json.Marshal(id)
+	return string(b)
+}
+
+func (f *inflight) start(parent context.Context, id any) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	k := requestKey(id)
+	f.mu.Lock()
+	f.cancels[k] = cancel
+	f.mu.Unlock()
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.cancels, k)
+		f.mu.Unlock()
+		cancel()
+	}
+}
+
+// busy reports whether any request is still running.
+func (f *inflight) busy() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.cancels) > 0
+}
+
+func (f *inflight) cancelAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, cancel := range f.cancels {
+		cancel()
+	}
+}
+
+func (f *inflight) cancel(id any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cancel, ok := f.cancels[requestKey(id)]; ok {
+		cancel()
+	}
+}
+
+type jsonrpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type syncWriter struct {
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+func (sw *syncWriter) write(v any) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	writeJSON(sw.w, v)
+}
+
+// Serve speaks newline-delimited JSON-RPC over in and out until in ends.
+func (s *Server) Serve(in io.Reader, out io.Writer) {
+	r := bufio.NewReader(in)
+	w := &syncWriter{w: bufio.NewWriter(out)}
+	c := &conn{inflight: newInflight(), notify: w.write}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var req jsonrpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			resp := jsonrpcResponse{JSONRPC: "2.0", ID: nil, Error: &jsonrpcError{Code: -32700, Message: "Parse error"}}
+			w.write(resp)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := s.handle(context.Background(), c, req); resp != nil {
+				w.write(resp)
+			}
+		}()
+	}
+}
+
+// handle runs one message under its own cancellable context. Cancelled
+// requests get no response, as the cancellation notification requires.
+func (s *Server) handle(parent context.Context, c *conn, req jsonrpcRequest) *jsonrpcResponse {
+	if req.Method == "notifications/cancelled" {
+		var p struct {
+			RequestID any `json:"requestId"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		c.inflight.cancel(p.RequestID)
+		return nil
+	}
+	if req.ID == nil && strings.HasPrefix(req.Method, "notifications/") {
+		return nil
+	}
+	ctx, done := c.inflight.start(parent, req.ID)
+	defer done()
+	unlock := s.hold(req)
+	resp := s.dispatch(ctx, c, req)
+	unlock()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return resp
+}
+
+// hold locks the database handles for a request: shared for everything but
+// dbHelper, which runs alone so that no request sees a handle swapped
+// halfway through it.
+func (s *Server) hold(req jsonrpcRequest) (unlock func()) {
+	var p struct {
+		Name string `json:"name"`
+	}
+	if req.Method == "tools/call" && json.Unmarshal(req.Params, &p) == nil && p.Name == dbToolName {
+		s.swap.Lock()
+		return s.swap.Unlock
+	}
+	s.swap.RLock()
+	return s.swap.RUnlock
+}
+
+func (s *Server) dispatch(ctx context.Context, c *conn, req jsonrpcRequest) *jsonrpcResponse {
+	switch req.Method {
+	case "initialize":
+		var p struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{
+			"protocolVersion": negotiateProtocolVersion(p.ProtocolVersion),
+			"capabilities": map[string]any{
+				"tools": map[string]any{
+					"listChanged": false,
+				},
+				"resources": map[string]any{
+					"subscribe":   false,
+					"listChanged": false,
+				},
+				"prompts": map[string]any{
+					"listChanged": false,
+				},
+			},
+			"serverInfo": map[string]any{
+				"name":    "mcp-novel",
+				"version": "0.1.0",
+			},
+		}}
+	case "ping":
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{}}
+	case "tools/list":
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{"tools": s.tools()}}
+	case "tools/call":
+		var p struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+			Meta      struct {
+				ProgressToken any `json:"progressToken"`
+			} `json:"_meta"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		if token := p.Meta.ProgressToken; token != nil {
+			ctx = progress.With(ctx, func(done float64, total float64, message string) {
+				params := map[string]any{"progressToken": token, "progress": done, "message": message}
+				if total > 0 {
+					params["total"] = total
+				}
+				c.notify(jsonrpcNotification{JSONRPC: "2.0", Method: "notifications/progress", Params: params})
+			})
+		}
+		res, err := s.call(ctx, p.Name, p.Arguments)
+		var ute *unknownToolError
+		var fe *tool.FieldError
+		if errors.As(err, &ute) || errors.As(err, &fe) {
+			return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcError(err)}
+		}
+		if err != nil {
+			return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: errorResult(err)}
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: successResult(res)}
+	case "resources/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		res, err := s.listResources(p.Cursor)
+		if err != nil {
+			return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcError(err)}
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: res}
+	case "resources/templates/list":
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{"resourceTemplates": resourceTemplates()}}
+	case "resources/read":
+		var p struct {
+			URI string `json:"uri"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		res, err := s.readResource(p.URI)
+		if err != nil {
+			return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcError(err)}
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: res}
+	case "prompts/list":
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: map[string]any{"prompts": prompts()}}
+	case "prompts/get":
+		var p struct {
+			Name      string            `json:"name"`
+			Arguments map[string]string `json:"arguments"`
+		}
+		_ = json.Unmarshal(req.Params, &p)
+		res, err := s.getPrompt(p.Name, p.Arguments)
+		if err != nil {
+			return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: rpcError(err)}
+		}
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Result: res}
+	default:
+		return &jsonrpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &jsonrpcError{Code: -32601, Message: "Method not found"}}
+	}
+}
+
+func rpcError(err error) *jsonrpcError {
+	var ipe *invalidParamsError
+	var ute *unknownToolError
+	var fe *tool.FieldError
+	var rnf *resourceNotFoundError
+	switch {
+	case errors.As(err, &fe):
+		return &jsonrpcError{Code: -32602, Message: "Invalid params: " + err.Error(), Data: map[string]any{"field": fe.Field, "reason": fe.Msg}}
+	case errors.As(err, &ipe), errors.As(err, &ute):
+		return &jsonrpcError{Code: -32602, Message: err.Error()}
+	case errors.As(err, &rnf):
+		return &jsonrpcError{Code: -32002, Message: err.Error()}
+	}
+	return &jsonrpcError{Code: -32603, Message: err.Error()}
+}
+
+func negotiateProtocolVersion(requested string) string {
+	for _, v := range supportedProtocolVersions {
+		if v == requested {
+			return v
+		}
+	}
+	return supportedProtocolVersions[0]
+}
+
+func successResult(v any) toolResult {
+	return toolResult{
+		Content:           []contentBlock{{Type: "text", Text: renderText(v)}},
+		StructuredContent: structuredContent(v),
+	}
+}
+
+func errorResult(err error) toolResult {
+	return toolResult{
+		Content: []contentBlock{{Type: "text", Text: err.Error()}},
+		IsError: true,
+	}
+}
+
+// renderText gives prose payloads (exports, outlines) as-is and everything else as indented JSON.
+func renderText(v any) string {
+	switch t := v.(type) {
+	case *models.ExportResult:
+		return t.Content
+	case tool.Texter:
+		return t.Text()
+	}
+	b, _ := json.MarshalIndent(v, "", "  ")
+	return string(b)
+}
+
+// structuredContent must be a JSON object, so lists are wrapped under "items".
+func structuredContent(v any) any {
+	if v == nil {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		return map[string]any{"items": v}
+	}
+	return v
+}
+
+func writeJSON(w *bufio.Writer, v any) {
+	b, _ := json.Marshal(v)
+	w.WriteString(string(b))
+	w.WriteByte('\n')
+	w.Flush()
+}
+
+func (s *Server) tools() []toolInfo {
+	ts := s.Tools.Tools()
+	out := make([]toolInfo, 0, len(ts))
+	for _, t := range ts {
+		out = append(out, toolInfo{Name: t.Name(), Description: t.Description(), InputSchema: t.InputSchema(), Annotations: t.Annotations()})
+	}
+	return out
+}
+
+func (s *Server) call(ctx context.Context, name string, args map[string]any) (any, error) {
+	t, ok := s.Tools.Lookup(name)
+	if !ok {
+		return nil, &unknownToolError{name: name}
+	}
+	return t.Call(ctx, args)
+}
+
+// Register adds tools alongside the built-in ones; see tool.Registry.Register.
+func (s *Server) Register(tools ...tool.Tool) error {
+	return s.Tools.Register(tools...)
+}
+
+func autoMigrate(db *gorm.DB) error {
+	// Membership is new: register the worlds and characters novels already
+	// use so that scoping them to novels does not hide anything.
+	members := !db.Migrator().HasTable(&models.NovelCharacter{})
+	err := db.AutoMigrate(
+		&models.Novel{},
+		&models.NovelWorld{},
+		&models.NovelCharacter{},
+		&models.Volume{},
+		&models.Chapter{},
+		&models.ChapterRevision{},
+		&models.Scene{},
+		&models.World{},
+		&models.Period{},
+		&models.TimeSegment{},
+		&models.Location{},
+		&models.Character{},
+		&models.CharacterAlias{},
+		&models.CharacterStatus{},
+		&models.CharacterRelationship{},
+		&models.CharacterRelationshipChange{},
+		&models.RelationshipType{},
+		&models.LocationRelationship{},
+		&models.Organization{},
+		&models.OrganizationMembership{},
+		&models.OrganizationRelationship{},
+		&models.Item{},
+		&models.ItemTransfer{},
+		&models.Ability{},
+		&models.AbilityUsage{},
+		&models.AbilityUpgrade{},
+		&models.PlotThread{},
+		&models.Event{},
+		&models.Memory{},
+		&models.StyleRef{},
+		&models.TrashEntry{},
+		&models.EventParticipant{},
+		&models.EventItem{},
+	)
+	if err != nil {
+		return err
+	}
+	if err := helpers.MigrateEventLinks(db); err != nil {
+		return err
+	}
+	if members {
+		return helpers.BackfillNovelMembers(db)
+	}
+	return nil
+}
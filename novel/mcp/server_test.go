@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mcpnovel/tool"
+	"testing"
+)
+
+type failArgs struct {
+	Reason string `json:"reason" schema:"required"`
+}
+
+// failTool fails every call with its reason as a plain error.
+func failTool() tool.Tool {
+	return tool.NewActions("failHelper", "", tool.Handle("fail", "", func(ctx context.Context, a failArgs) (any, error) {
+		return nil, errors.New(a.Reason)
+	}))
+}
+
+// request runs one JSON-RPC request through s on a fresh connection.
+func request(t *testing.T, s *Server, method, params string) *jsonrpcResponse {
+	t.Helper()
+	c := &conn{inflight: newInflight(), notify: func(any) {}}
+	return s.handle(context.Background(), c, jsonrpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: json.RawMessage(params)})
+}
+
+func TestToolsCallErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		code   int
+		field  string
+		result string
+	}{
+		{"unknown tool", `{"name":"nope"}`, -32602, "", ""},
+		{"missing action", `{"name":"failHelper","arguments":{}}`, -32602, "action", ""},
+		{"unknown action", `{"name":"failHelper","arguments":{"action":"pass"}}`, -32602, "action", ""},
+		{"missing argument", `{"name":"failHelper","arguments":{"action":"fail"}}`, -32602, "reason", ""},
+		{"wrong argument type", `{"name":"failHelper","arguments":{"action":"fail","reason":1}}`, -32602, "reason", ""},
+		{"tool failure", `{"name":"failHelper","arguments":{"action":"fail","reason":"boom"}}`, 0, "", "boom"},
+		{"built-in tool", `{"name":"novelHelper","arguments":{"action":"export","id":"x"}}`, -32602, "id", ""},
+	}
+	s := testServer(t)
+	if err := s.Register(failTool()); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := request(t, s, "tools/call", tt.params)
+			if tt.code == 0 {
+				res, ok := resp.Result.(toolResult)
+				if resp.Error != nil || !ok || !res.IsError || res.Content[0].Text != tt.result {
+					t.Fatalf("response = %+v, %+v; want an error result %q", resp.Result, resp.Error, tt.result)
+				}
+				return
+			}
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Fatalf("error = %+v; want code %d", resp.Error, tt.code)
+			}
+			if tt.field == "" {
+				return
+			}
+			data, _ := resp.Error.Data.(map[string]any)
+			if data["field"] != tt.field || data["reason"] == "" {
+				t.Errorf("error data = %v; want field %s with a reason", data, tt.field)
+			}
+		})
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	if resp := request(t, testServer(t), "tools/nope", `{}`); resp.Error == nil || resp.Error.Code != -32601 {
+		t.Errorf("error = %+v; want -32601", resp.Error)
+	}
+}
+
+func TestToolsListRegistered(t *testing.T) {
+	s := testServer(t)
+	if err := s.Register(failTool()); err != nil {
+		t.Fatal(err)
+	}
+	resp := request(t, s, "tools/list", `{}`)
+	ts := resp.Result.(map[string]any)["tools"].([]toolInfo)
+	if ts[0].Name != dbToolName || ts[len(ts)-1].Name != "failHelper" {
+		t.Errorf("tools run %s … %s; want %s first and the registered tool last", ts[0].Name, ts[len(ts)-1].Name, dbToolName)
+	}
+	if err := s.Register(failTool()); err == nil {
+		t.Error("registering an action twice succeeded")
+	}
+}
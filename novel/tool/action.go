@@ -0,0 +1,135 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"mcpnovel/internal/schema"
+	"sync"
+)
+
+// Action is one value of an ActionTool's "action" discriminator.
+type Action struct {
+	Name        string
+	Description string
+	// Args is the zero value of the argument struct; its schema tags
+	// describe the action's arguments.
+	Args        any
+	readOnly    bool
+	destructive bool
+	idempotent  bool
+	call        func(ctx context.Context, args map[string]any) (any, error)
+}
+
+// Handle builds an action whose arguments are validated against T's schema
+// and decoded into a T before fn runs.
+func Handle[T any](name, description string, fn func(ctx context.Context, a T) (any, error)) Action {
+	var zero T
+	return Action{
+		Name:        name,
+		Description: description,
+		Args:        zero,
+		call: func(ctx context.Context, args map[string]any) (any, error) {
+			var a T
+			if err := Decode(args, &a); err != nil {
+				return nil, err
+			}
+			return fn(ctx, a)
+		},
+	}
+}
+
+// ReadOnly marks the action as not modifying any data.
+func (a Action) ReadOnly() Action {
+	a.readOnly, a.idempotent = true, true
+	return a
+}
+
+// Destructive marks the action as overwriting or removing existing data.
+func (a Action) Destructive() Action {
+	a.destructive = true
+	return a
+}
+
+// Idempotent marks the action as having no further effect when repeated
+// with the same arguments.
+func (a Action) Idempotent() Action {
+	a.idempotent = true
+	return a
+}
+
+// ActionTool is a tool whose operations are selected by an "action"
+// argument, with one input schema branch per action.
+type ActionTool struct {
+	name        string
+	description string
+	mu          sync.RWMutex
+	actions     []Action
+}
+
+// NewActions builds an ActionTool from its actions.
+func NewActions(name, description string, actions ...Action) *ActionTool {
+	return &ActionTool{name: name, description: description, actions: actions}
+}
+
+func (t *ActionTool) Name() string        { return t.name }
+func (t *ActionTool) Description() string { return t.description }
+
+// Add appends actions, failing when one of them is already defined.
+func (t *ActionTool) Add(actions ...Action) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, a := range actions {
+		for _, b := range t.actions {
+			if a.Name == b.Name {
+				return fmt.Errorf("tool %s: action %s already registered", t.name, a.Name)
+			}
+		}
+	}
+	t.actions = append(t.actions, actions...)
+	return nil
+}
+
+func (t *ActionTool) list() []Action {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]Action(nil), t.actions...)
+}
+
+func (t *ActionTool) InputSchema() map[string]any {
+	actions := t.list()
+	specs := make([]schema.Action, 0, len(actions))
+	for _, a := range actions {
+		specs = append(specs, schema.Action{Name: a.Name, Description: a.Description, Args: a.Args})
+	}
+	return schema.ForActions(specs)
+}
+
+// Annotations summarise the actions: the tool is read-only or idempotent
+// only if every action is, and destructive if any action is.
+func (t *ActionTool) Annotations() Annotations {
+	actions := t.list()
+	an := Annotations{ReadOnlyHint: true, IdempotentHint: true}
+	for _, a := range actions {
+		an.ReadOnlyHint = an.ReadOnlyHint && a.readOnly
+		an.IdempotentHint = an.IdempotentHint && a.idempotent
+		an.DestructiveHint = an.DestructiveHint || a.destructive
+	}
+	return an
+}
+
+func (t *ActionTool) Call(ctx context.Context, args map[string]any) (any, error) {
+	v, ok := args["action"]
+	if !ok || v == nil {
+		return nil, &FieldError{Field: "action", Msg: "missing required field"}
+	}
+	name, ok := v.(string)
+	if !ok {
+		return nil, &FieldError{Field: "action", Msg: "expected string"}
+	}
+	for _, a := range t.list() {
+		if a.Name == name {
+			return a.call(ctx, args)
+		}
+	}
+	return nil, &FieldError{Field: "action", Msg: fmt.Sprintf("unknown action %q for tool %s", name, t.name)}
+}
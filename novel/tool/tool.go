@@ -0,0 +1,104 @@
+// Package tool defines the MCP tools served by mcp-novel and the registry
+// they are collected in. Packages contribute tools through constructors
+// such as helpers.Tools; programs embedding the server register their own
+// with mcp.Server.Register.
+package tool
+
+import (
+	"context"
+	"fmt"
+	"mcpnovel/internal/schema"
+	"sync"
+)
+
+// Annotations are the behaviour hints advertised in tools/list.
+type Annotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
+}
+
+// Tool is one entry of tools/list and the handler behind tools/call.
+//
+// Call returns a JSON-encodable result. Returning a *FieldError makes the
+// server answer with JSON-RPC invalid params; any other error is reported
+// as a tool result with isError set.
+type Tool interface {
+	Name() string
+	Description() string
+	InputSchema() map[string]any
+	Annotations() Annotations
+	Call(ctx context.Context, args map[string]any) (any, error)
+}
+
+// FieldError reports an argument that does not satisfy the tool's schema.
+type FieldError = schema.FieldError
+
+// Texter is implemented by results whose text content is prose, such as
+// outlines, rather than their JSON encoding.
+type Texter interface {
+	Text() string
+}
+
+// Decode validates args against the schema of v's struct type and decodes
+// them into v; "action" is always accepted.
+func Decode(args map[string]any, v any) error {
+	return schema.Decode(args, v, "action")
+}
+
+// Registry holds tools in registration order. It is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	order []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]Tool{}}
+}
+
+// Register adds tools to the registry. Registering an *ActionTool under a
+// name already held by an *ActionTool adds its actions to the existing tool,
+// which is how packages extend each other's tools; any other name clash is
+// an error.
+func (r *Registry) Register(tools ...Tool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, t := range tools {
+		old, ok := r.tools[t.Name()]
+		if !ok {
+			r.tools[t.Name()] = t
+			r.order = append(r.order, t.Name())
+			continue
+		}
+		oa, ok1 := old.(*ActionTool)
+		na, ok2 := t.(*ActionTool)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("tool %s already registered", t.Name())
+		}
+		if err := oa.Add(na.list()...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Lookup returns the tool registered under name.
+func (r *Registry) Lookup(name string) (Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Tools lists the registered tools in registration order.
+func (r *Registry) Tools() []Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]Tool, 0, len(r.order))
+	for _, name := range r.order {
+		out = append(out, r.tools[name])
+	}
+	return out
+}
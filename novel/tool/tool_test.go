@@ -0,0 +1,135 @@
+package tool
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type echoArgs struct {
+	Text  string `json:"text" schema:"required"`
+	Times int    `json:"times" schema:"minimum=1"`
+}
+
+func echo(name string) Action {
+	return Handle(name, "echo", func(ctx context.Context, a echoArgs) (any, error) {
+		return strings.Repeat(a.Text, max(a.Times, 1)), nil
+	})
+}
+
+// plain is a tool without actions.
+type plain struct{ name string }
+
+func (p plain) Name() string                { return p.name }
+func (p plain) Description() string         { return "" }
+func (p plain) InputSchema() map[string]any { return map[string]any{"type": "object"} }
+func (p plain) Annotations() Annotations    { return Annotations{} }
+func (p plain) Call(ctx context.Context, args map[string]any) (any, error) {
+	return p.name, nil
+}
+
+func names(ts []Tool) string {
+	var out []string
+	for _, t := range ts {
+		out = append(out, t.Name())
+	}
+	return strings.Join(out, ",")
+}
+
+func TestRegister(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(NewActions("b", "", echo("one")), plain{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(NewActions("b", "", echo("two"))); err != nil {
+		t.Fatalf("merging actions: %v", err)
+	}
+	if got := names(r.Tools()); got != "b,a" {
+		t.Errorf("tools = %s; want registration order b,a", got)
+	}
+	b, ok := r.Lookup("b")
+	if !ok {
+		t.Fatal("lookup b failed")
+	}
+	if _, err := b.Call(context.Background(), map[string]any{"action": "two", "text": "x"}); err != nil {
+		t.Errorf("merged action: %v", err)
+	}
+	if _, ok := r.Lookup("c"); ok {
+		t.Error("lookup of an unregistered tool succeeded")
+	}
+
+	clashes := []struct {
+		name string
+		tool Tool
+		want string
+	}{
+		{"plain over actions", plain{"b"}, "tool b already registered"},
+		{"actions over plain", NewActions("a", "", echo("one")), "tool a already registered"},
+		{"plain over plain", plain{"a"}, "tool a already registered"},
+		{"same action", NewActions("b", "", echo("one")), "tool b: action one already registered"},
+	}
+	for _, tt := range clashes {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Register(tt.tool)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Register = %v; want %q", err, tt.want)
+			}
+		})
+	}
+	if got := names(r.Tools()); got != "b,a" {
+		t.Errorf("tools after clashes = %s; want b,a", got)
+	}
+}
+
+func TestActionCall(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  map[string]any
+		want  string
+		field string
+	}{
+		{"dispatch", map[string]any{"action": "two", "text": "ab", "times": float64(2)}, "abab", ""},
+		{"missing action", map[string]any{"text": "ab"}, "", "action"},
+		{"non-string action", map[string]any{"action": float64(1)}, "", "action"},
+		{"unknown action", map[string]any{"action": "three"}, "", "action"},
+		{"missing argument", map[string]any{"action": "one"}, "", "text"},
+		{"unknown argument", map[string]any{"action": "one", "text": "a", "colour": "red"}, "", "colour"},
+		{"argument out of range", map[string]any{"action": "one", "text": "a", "times": float64(0)}, "", "times"},
+	}
+	at := NewActions("echo", "", echo("one"), echo("two"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := at.Call(context.Background(), tt.args)
+			if tt.field == "" {
+				if err != nil || got != tt.want {
+					t.Errorf("Call = %v, %v; want %q", got, err, tt.want)
+				}
+				return
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Field != tt.field {
+				t.Errorf("Call error = %v; want a FieldError on %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	tests := []struct {
+		name    string
+		actions []Action
+		want    Annotations
+	}{
+		{"read-only", []Action{echo("a").ReadOnly(), echo("b").ReadOnly()}, Annotations{ReadOnlyHint: true, IdempotentHint: true}},
+		{"one write", []Action{echo("a").ReadOnly(), echo("b").Idempotent()}, Annotations{IdempotentHint: true}},
+		{"one destructive", []Action{echo("a").ReadOnly(), echo("b").Destructive()}, Annotations{DestructiveHint: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewActions("t", "", tt.actions...).Annotations(); got != tt.want {
+				t.Errorf("Annotations = %+v; want %+v", got, tt.want)
+			}
+		})
+	}
+}